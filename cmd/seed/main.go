@@ -14,14 +14,14 @@ import (
 )
 
 func main() {
-	dbPath := getenv("SQLITE_PATH", "app.db")
+	dsn := getenv("DATABASE_URL", getenv("SQLITE_PATH", "app.db"))
 	count := getenvInt("SEED_COUNT", 1000)
 
-	sqlDB, err := db.Open(dbPath)
+	sqlDB, err := db.Open(dsn)
 	must(err)
 	defer sqlDB.Close()
 
-	ctx := context.Background()
+	ctx := jobs.WithActor(context.Background(), "seed")
 	must(db.Migrate(ctx, sqlDB))
 	repo := &jobs.Repo{DB: sqlDB}
 
@@ -114,6 +114,10 @@ func main() {
 	rowsAffected, _ := result.RowsAffected()
 	log.Printf("Updated %d past jobs to enqueued status", rowsAffected)
 
+	_, err = repo.DB.ExecContext(ctx,
+		"UPDATE job_reminders SET status = 'enqueued' WHERE job_id IN (SELECT id FROM jobs WHERE status = 'enqueued')")
+	must(err)
+
 	stats, err := getStats(ctx, repo)
 	must(err)
 
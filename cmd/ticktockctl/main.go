@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yplog/ticktockbox/internal/db"
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+const usage = `usage: ticktockctl <command> [flags]
+
+commands:
+  import   import jobs from a CSV, NDJSON or iCalendar file
+  export   export jobs from the database as CSV or NDJSON
+  migrate  show, apply or roll back database migrations
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ticktockctl:", err)
+		os.Exit(1)
+	}
+}
+
+type importReport struct {
+	Rows     int  `json:"rows"`
+	Imported int  `json:"imported"`
+	Failed   int  `json:"failed"`
+	DryRun   bool `json:"dry_run"`
+	Errors   []struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	} `json:"errors"`
+	ErrorsTruncated bool   `json:"errors_truncated"`
+	Error           string `json:"error"`
+}
+
+type icsReport struct {
+	Events    int  `json:"events"`
+	Jobs      int  `json:"jobs"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+	Cancelled int  `json:"cancelled"`
+	Skipped   int  `json:"skipped"`
+	Failed    int  `json:"failed"`
+	DryRun    bool `json:"dry_run"`
+	Errors    []struct {
+		UID   string `json:"uid"`
+		Error string `json:"error"`
+	} `json:"errors"`
+	Error string `json:"error"`
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	server := fs.String("server", getenv("TICKTOCKBOX_URL", "http://localhost:3000"), "server base URL")
+	format := fs.String("format", "", "csv, ndjson or ics (default: from the file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate rows without importing them")
+	tz := fs.String("tz", "", "ics: time zone of floating and all-day times (default UTC)")
+	labels := fs.String("labels", "", "ics: labels added to every job, e.g. source=calendar")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ticktockctl import [flags] <file|->")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	name := fs.Arg(0)
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			*format = "csv"
+		case ".ndjson", ".jsonl", ".json":
+			*format = "ndjson"
+		case ".ics", ".ical":
+			*format = "ics"
+		default:
+			return fmt.Errorf("cannot tell the format of %q, use -format", name)
+		}
+	}
+
+	var body io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		body = f
+	}
+
+	base := strings.TrimRight(*server, "/")
+
+	if *format == "ics" {
+		q := url.Values{}
+		for k, v := range map[string]string{"tz": *tz, "labels": *labels} {
+			if v != "" {
+				q.Set(k, v)
+			}
+		}
+
+		if *dryRun {
+			q.Set("dry_run", "true")
+		}
+
+		return importICS(base+"/api/jobs/import/ics?"+q.Encode(), body)
+	}
+
+	q := url.Values{"format": {*format}}
+	if *dryRun {
+		q.Set("dry_run", "true")
+	}
+
+	resp, err := http.Post(base+"/api/jobs/import?"+q.Encode(), "application/octet-stream", body)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	var rep importReport
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+
+	for _, e := range rep.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", e.Line, e.Error)
+	}
+
+	if rep.ErrorsTruncated {
+		fmt.Fprintln(os.Stderr, "(more errors omitted)")
+	}
+
+	verb := "imported"
+	if rep.DryRun {
+		verb = "valid"
+	}
+
+	fmt.Printf("%d rows, %d %s, %d failed\n", rep.Rows, rep.Imported, verb, rep.Failed)
+
+	if rep.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, rep.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	if rep.Failed > 0 {
+		return fmt.Errorf("%d rows failed", rep.Failed)
+	}
+
+	return nil
+}
+
+// importICS posts an iCalendar file and prints the import report.
+func importICS(u string, body io.Reader) error {
+	resp, err := http.Post(u, "text/calendar", body)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	var rep icsReport
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+
+	for _, e := range rep.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", e.UID, e.Error)
+	}
+
+	if rep.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, rep.Error)
+	}
+
+	if rep.DryRun {
+		fmt.Printf("%d events, %d jobs, %d skipped, %d failed\n", rep.Events, rep.Jobs, rep.Skipped, rep.Failed)
+	} else {
+		fmt.Printf("%d events: %d created, %d updated, %d unchanged, %d cancelled, %d skipped, %d failed\n",
+			rep.Events, rep.Created, rep.Updated, rep.Unchanged, rep.Cancelled, rep.Skipped, rep.Failed)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	if rep.Failed > 0 {
+		return fmt.Errorf("%d events failed", rep.Failed)
+	}
+
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dsn := fs.String("db", getenv("DATABASE_URL", getenv("SQLITE_PATH", "app.db")), "SQLite database path or postgres:// URL")
+	format := fs.String("format", jobs.FormatCSV, "csv or ndjson")
+	out := fs.String("o", "-", "output file")
+	filter := fs.String("filter", "status=all", "job filter as a query string, e.g. 'status=pending&labels=team=ops'")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ticktockctl export [flags]")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if *format != jobs.FormatCSV && *format != jobs.FormatNDJSON {
+		return fmt.Errorf("format must be csv or ndjson")
+	}
+
+	q, err := url.ParseQuery(*filter)
+	if err != nil {
+		return err
+	}
+
+	f, err := jobs.ParseFilter(q)
+	if err != nil {
+		return err
+	}
+
+	// Export only reads: it neither creates a missing SQLite file nor
+	// migrates, and refuses a schema other than the one it was built for.
+	sqlDB, err := openExisting(*dsn)
+	if err != nil {
+		return err
+	}
+
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	if err := db.CheckSchema(ctx, sqlDB); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		w = file
+	}
+
+	bw := bufio.NewWriter(w)
+
+	n, err := (&jobs.Repo{DB: sqlDB}).Export(ctx, bw, *format, f)
+	if err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d jobs\n", n)
+
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dsn := fs.String("db", getenv("DATABASE_URL", getenv("SQLITE_PATH", "app.db")), "SQLite database path or postgres:// URL")
+	steps := fs.Int("steps", 1, "down: number of migrations to roll back")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ticktockctl migrate [flags] status|up|down")
+		fs.PrintDefaults()
+	}
+
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 || !slices.Contains([]string{"status", "up", "down"}, fs.Arg(0)) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Only up may create the database; a mistyped path for the others
+	// fails instead of leaving an empty file behind.
+	open := openExisting
+	if fs.Arg(0) == "up" {
+		open = db.Open
+	}
+
+	sqlDB, err := open(*dsn)
+	if err != nil {
+		return err
+	}
+
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+
+	switch fs.Arg(0) {
+	case "status":
+	case "up":
+		if err := db.Migrate(ctx, sqlDB); err != nil {
+			return err
+		}
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("steps must be at least 1")
+		}
+
+		done, err := db.Rollback(ctx, sqlDB, *steps)
+		for _, m := range done {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	st, err := db.Status(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range st {
+		state := "pending"
+		if s.Applied {
+			state = "applied " + s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+
+		if s.Up == "" {
+			state += " (unknown to this build)"
+		}
+
+		fmt.Printf("%04d_%-20s %s\n", s.Version, s.Name, state)
+	}
+
+	return nil
+}
+
+func getenv(k, d string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+
+	return d
+}
+
+// openExisting opens a database like db.Open, but fails for a SQLite file
+// that does not exist rather than creating it.
+func openExisting(dsn string) (*sql.DB, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		if _, err := os.Stat(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	return db.Open(dsn)
+}
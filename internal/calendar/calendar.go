@@ -0,0 +1,230 @@
+package calendar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ActionShift = "shift"
+	ActionSkip  = "skip"
+)
+
+// searchDays bounds how far ahead Next looks for an allowed instant.
+const searchDays = 400
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Calendar describes when reminders may be delivered. Hours lists allowed
+// "HH:MM-HH:MM" ranges per weekday ("mon".."sun"); a day without an entry
+// is closed, and an empty Hours allows every day around the clock. Holidays
+// are "YYYY-MM-DD" dates that are closed all day. Times are evaluated in
+// the job's own time zone.
+type Calendar struct {
+	Name      string              `json:"name"`
+	Hours     map[string][]string `json:"hours,omitempty"`
+	Holidays  []string            `json:"holidays,omitempty"`
+	OnBlocked string              `json:"on_blocked,omitempty"` // shift (default) | skip
+
+	days     map[time.Weekday][]span
+	holidays map[string]bool
+}
+
+// span is an allowed range in minutes after midnight, end exclusive.
+type span struct{ start, end int }
+
+// Compile validates the calendar and prepares it for Next.
+func (c *Calendar) Compile() error {
+	if c.Name == "" {
+		return errors.New("calendar name is required")
+	}
+
+	switch c.OnBlocked {
+	case "":
+		c.OnBlocked = ActionShift
+	case ActionShift, ActionSkip:
+	default:
+		return fmt.Errorf("on_blocked must be %q or %q", ActionShift, ActionSkip)
+	}
+
+	c.days = make(map[time.Weekday][]span)
+	for day, ranges := range c.Hours {
+		wd, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", day)
+		}
+
+		for _, r := range ranges {
+			sp, err := parseSpan(r)
+			if err != nil {
+				return err
+			}
+
+			c.days[wd] = append(c.days[wd], sp)
+		}
+
+		sort.Slice(c.days[wd], func(i, j int) bool { return c.days[wd][i].start < c.days[wd][j].start })
+	}
+
+	c.holidays = make(map[string]bool, len(c.Holidays))
+	for _, d := range c.Holidays {
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return fmt.Errorf("invalid holiday %q: %w", d, err)
+		}
+
+		c.holidays[d] = true
+	}
+
+	return nil
+}
+
+func parseSpan(s string) (span, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return span{}, fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return span{}, err
+	}
+
+	end, err := parseClock(to)
+	if err != nil {
+		return span{}, err
+	}
+
+	if end <= start {
+		return span{}, fmt.Errorf("invalid hours %q, end must be after start", s)
+	}
+
+	return span{start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Next returns the earliest allowed instant at or after t in loc. It
+// reports false if nothing is allowed within searchDays.
+func (c *Calendar) Next(t time.Time, loc *time.Location) (time.Time, bool) {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	for i := 0; i < searchDays; i++ {
+		d := day.AddDate(0, 0, i)
+
+		if c.holidays[d.Format(time.DateOnly)] {
+			continue
+		}
+
+		spans := []span{{0, 24 * 60}}
+		if len(c.days) > 0 {
+			spans = c.days[d.Weekday()]
+		}
+
+		for _, sp := range spans {
+			start := time.Date(d.Year(), d.Month(), d.Day(), 0, sp.start, 0, 0, loc)
+			end := time.Date(d.Year(), d.Month(), d.Day(), 0, sp.end, 0, 0, loc)
+
+			if t.Before(end) {
+				if t.Before(start) {
+					return start, true
+				}
+
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Registry holds the compiled calendars by name.
+type Registry struct {
+	mu   sync.RWMutex
+	cals map[string]*Calendar
+}
+
+func NewRegistry() *Registry {
+	return &Registry{cals: make(map[string]*Calendar)}
+}
+
+// Put compiles c and stores it, replacing any calendar with the same name.
+func (r *Registry) Put(c *Calendar) error {
+	if err := c.Compile(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cals[c.Name] = c
+
+	return nil
+}
+
+func (r *Registry) Get(name string) (*Calendar, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.cals[name]
+
+	return c, ok
+}
+
+func (r *Registry) Delete(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cals, name)
+}
+
+// List returns the calendars sorted by name.
+func (r *Registry) List() []*Calendar {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]*Calendar, 0, len(r.cals))
+	for _, c := range r.cals {
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// LoadFile reads a JSON array of calendars.
+func LoadFile(path string) ([]*Calendar, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cals []*Calendar
+	if err := json.Unmarshal(b, &cals); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cals, nil
+}
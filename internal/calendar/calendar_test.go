@@ -0,0 +1,116 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	c := &Calendar{Name: "office", Hours: map[string][]string{"Mon": {"13:00-17:00", "09:00-12:00"}}}
+	if err := c.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.OnBlocked != ActionShift {
+		t.Errorf("on_blocked = %q, want %q by default", c.OnBlocked, ActionShift)
+	}
+
+	if got := c.days[time.Monday]; len(got) != 2 || got[0].start != 9*60 {
+		t.Errorf("monday spans = %v, want them sorted", got)
+	}
+
+	for _, bad := range []Calendar{
+		{},
+		{Name: "x", OnBlocked: "drop"},
+		{Name: "x", Hours: map[string][]string{"someday": {"09:00-17:00"}}},
+		{Name: "x", Hours: map[string][]string{"mon": {"09:00"}}},
+		{Name: "x", Hours: map[string][]string{"mon": {"17:00-09:00"}}},
+		{Name: "x", Hours: map[string][]string{"mon": {"9am-5pm"}}},
+		{Name: "x", Holidays: []string{"2030-02-30"}},
+	} {
+		if err := bad.Compile(); err == nil {
+			t.Errorf("Compile(%+v) accepted", bad)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	istanbul, err := time.LoadLocation("Europe/Istanbul")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	office := &Calendar{
+		Name: "office",
+		Hours: map[string][]string{
+			"mon": {"09:00-12:00", "13:00-17:00"},
+			"sun": {"09:00-10:00"},
+			"sat": {"22:00-24:00"},
+		},
+		Holidays: []string{"2030-01-14"},
+	}
+	if err := office.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	open := &Calendar{Name: "open", Holidays: []string{"2030-01-07"}}
+	if err := open.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2030-01-07 is a Monday.
+	at := func(loc *time.Location, month time.Month, day, h, m int) time.Time {
+		return time.Date(2030, month, day, h, m, 0, 0, loc)
+	}
+
+	for _, tc := range []struct {
+		name string
+		c    *Calendar
+		t    time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{"inside hours", office, at(time.UTC, 1, 7, 10, 30), time.UTC, at(time.UTC, 1, 7, 10, 30)},
+		{"before opening", office, at(time.UTC, 1, 7, 8, 0), time.UTC, at(time.UTC, 1, 7, 9, 0)},
+		{"lunch break", office, at(time.UTC, 1, 7, 12, 0), time.UTC, at(time.UTC, 1, 7, 13, 0)},
+		{"closing is exclusive", office, at(time.UTC, 1, 7, 17, 0), time.UTC, at(time.UTC, 1, 12, 22, 0)},
+		{"until midnight", office, at(time.UTC, 1, 12, 23, 59), time.UTC, at(time.UTC, 1, 12, 23, 59)},
+		{"closed day", office, at(time.UTC, 1, 8, 9, 0), time.UTC, at(time.UTC, 1, 12, 22, 0)},
+		{"holiday", office, at(time.UTC, 1, 14, 10, 0), time.UTC, at(time.UTC, 1, 19, 22, 0)},
+		// 07:30 UTC is 10:30 in Istanbul, inside its Monday hours.
+		{"job's time zone", office, at(time.UTC, 1, 7, 7, 30), istanbul, at(istanbul, 1, 7, 10, 30)},
+		{"wrong zone", office, at(time.UTC, 1, 7, 16, 0), istanbul, at(istanbul, 1, 12, 22, 0)},
+		// DST starts on 2030-03-10: opening is 09:00 EDT, 13:00 UTC.
+		{"across DST", office, at(ny, 3, 9, 23, 59).Add(time.Minute), ny, at(ny, 3, 10, 9, 0)},
+		{"open calendar", open, at(time.UTC, 1, 6, 3, 0), time.UTC, at(time.UTC, 1, 6, 3, 0)},
+		{"open calendar holiday", open, at(time.UTC, 1, 7, 3, 0), time.UTC, at(time.UTC, 1, 8, 0, 0)},
+	} {
+		got, ok := tc.c.Next(tc.t, tc.loc)
+		if !ok || !got.Equal(tc.want) {
+			t.Errorf("%s: Next(%v) = %v, %v, want %v", tc.name, tc.t, got, ok, tc.want)
+		}
+
+		if ok && got.Location() != tc.loc {
+			t.Errorf("%s: Next returned %v, want it in %v", tc.name, got, tc.loc)
+		}
+	}
+
+	// Holidays on every day it could search leave nothing allowed.
+	closed := &Calendar{Name: "closed", Hours: map[string][]string{"mon": {"09:00-17:00"}}}
+	for d := at(time.UTC, 1, 7, 0, 0); d.Year() < 2032; d = d.AddDate(0, 0, 7) {
+		closed.Holidays = append(closed.Holidays, d.Format(time.DateOnly))
+	}
+
+	if err := closed.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := closed.Next(at(time.UTC, 1, 7, 10, 0), time.UTC); ok {
+		t.Errorf("Next on a closed calendar = %v", got)
+	}
+}
@@ -0,0 +1,48 @@
+// Package db opens the SQLite or PostgreSQL database and keeps its schema
+// up to date.
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Dialect is the SQL flavour of a database opened by Open. Queries are
+// written for SQLite with ? placeholders; PostgreSQL connections rewrite
+// the placeholders, and callers switch on the dialect for the few
+// statements that differ.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	if d == Postgres {
+		return "postgres"
+	}
+
+	return "sqlite"
+}
+
+// Open opens a PostgreSQL database for a postgres:// or postgresql:// URL
+// and an SQLite file for anything else.
+func Open(dsn string) (*sql.DB, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return openPostgres(dsn)
+	}
+
+	return openSQLite(dsn)
+}
+
+// DialectOf reports the dialect of a database opened by Open.
+func DialectOf(sqlDB *sql.DB) Dialect {
+	if _, ok := sqlDB.Driver().(*stdlib.Driver); ok {
+		return Postgres
+	}
+
+	return SQLite
+}
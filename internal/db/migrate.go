@@ -0,0 +1,391 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the PostgreSQL advisory lock that serializes Migrate
+// and Rollback across replicas.
+const migrationLock = 7307617479
+
+// Migration is a numbered schema change read from migrations/<dialect>/,
+// as NNNN_name.up.sql and an optional NNNN_name.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty if the migration cannot be rolled back
+}
+
+// MigrationStatus is a known or applied migration. Migrations applied by
+// a newer build are listed with only Version, Name and AppliedAt set.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the embedded migrations of a dialect ordered by
+// version.
+func Migrations(d Dialect) ([]Migration, error) {
+	dir := "migrations/" + d.String()
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("%s/%s: name must be NNNN_name.up.sql or NNNN_name.down.sql", dir, e.Name())
+		}
+
+		v, _ := strconv.Atoi(m[1])
+
+		b, err := migrationFiles.ReadFile(dir + "/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[v]
+		if mig == nil {
+			mig = &Migration{Version: v, Name: m[2]}
+			byVersion[v] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", v, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+
+		res = append(res, *m)
+	}
+
+	slices.SortFunc(res, func(a, b Migration) int { return a.Version - b.Version })
+
+	return res, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+	  CREATE TABLE IF NOT EXISTS schema_migrations(
+	    version INTEGER PRIMARY KEY,
+	    name TEXT NOT NULL,
+	    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	  )`)
+
+	return err
+}
+
+// hasMigrationsTable reports whether schema_migrations exists, that is
+// whether the database has ever been migrated by this series.
+func hasMigrationsTable(ctx context.Context, conn *sql.Conn, d Dialect) (bool, error) {
+	q := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	if d == Postgres {
+		q = `SELECT COUNT(*) FROM pg_tables WHERE schemaname = current_schema() AND tablename = 'schema_migrations'`
+	}
+
+	var n int
+	err := conn.QueryRowContext(ctx, q).Scan(&n)
+
+	return n > 0, err
+}
+
+// Migrate applies every migration the database has not seen yet, each in
+// its own transaction together with its schema_migrations row. It refuses
+// to run against a database migrated by a newer build.
+func Migrate(ctx context.Context, sqlDB *sql.DB) error {
+	d := DialectOf(sqlDB)
+
+	migs, err := Migrations(d)
+	if err != nil {
+		return err
+	}
+
+	conn, unlock, err := lockMigrations(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if d == SQLite {
+		if err := adoptLegacy(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+
+	st, err := status(ctx, conn, d, migs)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range st {
+		if s.Applied && s.Up == "" {
+			return fmt.Errorf("database has migration %04d_%s, which this build does not know; roll it back with a newer build", s.Version, s.Name)
+		}
+	}
+
+	for _, m := range migs {
+		if err := apply(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// lockMigrations takes a connection for migrating, holding the advisory
+// lock on PostgreSQL; SQLite serializes writers itself.
+func lockMigrations(ctx context.Context, sqlDB *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if DialectOf(sqlDB) != Postgres {
+		return conn, func() { conn.Close() }, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(?)`, migrationLock); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(?)`, migrationLock)
+		conn.Close()
+	}, nil
+}
+
+// apply runs an up migration unless it was already applied.
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.Version).Scan(&n); err != nil {
+		return err
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations(version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Status lists the embedded migrations and any unknown applied ones, by
+// version. It does not change the database: one that was never migrated,
+// including one from before versioned migrations, has nothing applied.
+func Status(ctx context.Context, sqlDB *sql.DB) ([]MigrationStatus, error) {
+	d := DialectOf(sqlDB)
+
+	migs, err := Migrations(d)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return status(ctx, conn, d, migs)
+}
+
+func status(ctx context.Context, conn *sql.Conn, d Dialect, migs []Migration) ([]MigrationStatus, error) {
+	res := make([]MigrationStatus, len(migs))
+	for i, m := range migs {
+		res[i] = MigrationStatus{Migration: m}
+	}
+
+	ok, err := hasMigrationsTable(ctx, conn, d)
+	if err != nil || !ok {
+		return res, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s MigrationStatus
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+
+		s.Applied = true
+
+		i := slices.IndexFunc(res, func(k MigrationStatus) bool { return k.Version == s.Version })
+		if i < 0 {
+			res = append(res, s)
+			continue
+		}
+
+		res[i].Applied, res[i].AppliedAt = true, s.AppliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(res, func(a, b MigrationStatus) int { return a.Version - b.Version })
+
+	return res, nil
+}
+
+// ErrSchemaMismatch is returned by CheckSchema for a database whose
+// applied migrations are not the ones this build embeds.
+var ErrSchemaMismatch = errors.New("database schema does not match this build")
+
+// CheckSchema fails with ErrSchemaMismatch unless every embedded migration,
+// and no other, is applied. Like Status it does not change the database,
+// for tools that only read it.
+func CheckSchema(ctx context.Context, sqlDB *sql.DB) error {
+	st, err := Status(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	var pending, unknown []string
+	for _, s := range st {
+		switch {
+		case s.Up == "":
+			unknown = append(unknown, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		case !s.Applied:
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: applied by a newer build: %s", ErrSchemaMismatch, strings.Join(unknown, ", "))
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s; run ticktockctl migrate up", ErrSchemaMismatch, strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// Rollback reverts the last steps applied migrations, newest first, each in
+// its own transaction, and returns the ones it reverted. It stops at a
+// migration that has no down file or is unknown to this build.
+func Rollback(ctx context.Context, sqlDB *sql.DB, steps int) ([]Migration, error) {
+	d := DialectOf(sqlDB)
+
+	migs, err := Migrations(d)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, unlock, err := lockMigrations(ctx, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	st, err := status(ctx, conn, d, migs)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	for i := len(st) - 1; i >= 0 && len(done) < steps; i-- {
+		s := st[i]
+		if !s.Applied {
+			continue
+		}
+
+		if s.Down == "" {
+			return done, fmt.Errorf("migration %04d_%s cannot be rolled back", s.Version, s.Name)
+		}
+
+		if err := revert(ctx, conn, s.Migration); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", s.Version, s.Name, err)
+		}
+
+		done = append(done, s.Migration)
+	}
+
+	return done, nil
+}
+
+var errNotApplied = errors.New("not applied")
+
+func revert(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotApplied
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
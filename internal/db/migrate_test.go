@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testDatabases returns fresh, empty databases to migrate: an SQLite file
+// and, when TICKTOCK_TEST_POSTGRES holds a postgres:// URL, a new schema on
+// that server that is dropped afterwards.
+func testDatabases(t *testing.T) map[string]*sql.DB {
+	t.Helper()
+
+	res := map[string]*sql.DB{}
+
+	lite, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { lite.Close() })
+	res["sqlite"] = lite
+
+	dsn := os.Getenv("TICKTOCK_TEST_POSTGRES")
+	if dsn == "" {
+		return res
+	}
+
+	admin, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("ticktock_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	pg, err := Open(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { pg.Close() })
+	res["postgres"] = pg
+
+	return res
+}
+
+// tables lists the tables of the current schema other than
+// schema_migrations and SQLite's own.
+func tables(t *testing.T, sqlDB *sql.DB) []string {
+	t.Helper()
+
+	q := `SELECT name FROM sqlite_master WHERE type = 'table'
+	  AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'jobs_fts%' AND name <> 'schema_migrations'
+	  ORDER BY name`
+	if DialectOf(sqlDB) == Postgres {
+		q = `SELECT tablename FROM pg_tables WHERE schemaname = current_schema()
+		  AND tablename <> 'schema_migrations' ORDER BY tablename`
+	}
+
+	rows, err := sqlDB.Query(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+
+		res = append(res, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	ctx := context.Background()
+
+	for name, sqlDB := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			migs, err := Migrations(DialectOf(sqlDB))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := sqlDB.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer conn.Close()
+
+			if err := ensureMigrationsTable(ctx, conn); err != nil {
+				t.Fatal(err)
+			}
+
+			// Each migration must apply on top of the previous ones, revert
+			// cleanly, and apply again.
+			for _, m := range migs {
+				if m.Down == "" {
+					t.Fatalf("%04d_%s has no down file", m.Version, m.Name)
+				}
+
+				before := tables(t, sqlDB)
+
+				if err := apply(ctx, conn, m); err != nil {
+					t.Fatalf("up %04d_%s: %v", m.Version, m.Name, err)
+				}
+
+				if err := revert(ctx, conn, m); err != nil {
+					t.Fatalf("down %04d_%s: %v", m.Version, m.Name, err)
+				}
+
+				if after := tables(t, sqlDB); fmt.Sprint(after) != fmt.Sprint(before) {
+					t.Fatalf("down %04d_%s left tables %v, want %v", m.Version, m.Name, after, before)
+				}
+
+				if err := apply(ctx, conn, m); err != nil {
+					t.Fatalf("up again %04d_%s: %v", m.Version, m.Name, err)
+				}
+			}
+
+			done, err := Rollback(ctx, sqlDB, len(migs))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(done) != len(migs) {
+				t.Fatalf("rolled back %d migrations, want %d", len(done), len(migs))
+			}
+
+			if left := tables(t, sqlDB); len(left) > 0 {
+				t.Fatalf("tables left after rolling back everything: %v", left)
+			}
+
+			if err := Migrate(ctx, sqlDB); err != nil {
+				t.Fatal(err)
+			}
+
+			st, err := Status(ctx, sqlDB)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, s := range st {
+				if !s.Applied {
+					t.Errorf("%04d_%s not applied after Migrate", s.Version, s.Name)
+				}
+			}
+		})
+	}
+}
+
+// legacySchema is the schema of the first release, which created its
+// tables without versioned migrations.
+const legacySchema = `
+CREATE TABLE jobs(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  tz TEXT NOT NULL,
+  run_at_utc TIMESTAMP NOT NULL,
+  due_at_utc TIMESTAMP NOT NULL,
+  remind_before_minutes INTEGER NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_jobs_status_due ON jobs(status, due_at_utc);
+INSERT INTO jobs(title, tz, run_at_utc, due_at_utc, remind_before_minutes)
+VALUES ('legacy', 'UTC', '2030-01-01 12:00:00', '2030-01-01 11:55:00', 5);
+`
+
+func TestStatusLeavesLegacyDatabaseAlone(t *testing.T) {
+	ctx := context.Background()
+
+	sqlDB, err := Open(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sqlDB.Close()
+
+	if _, err := sqlDB.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Status(ctx, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range st {
+		if s.Applied {
+			t.Errorf("%04d_%s reported applied on a legacy database", s.Version, s.Name)
+		}
+	}
+
+	// Status must not have created schema_migrations, or the legacy
+	// columns would never be added.
+	if err := Migrate(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+
+	var title, external string
+	if err := sqlDB.QueryRow(`SELECT title, external_id FROM jobs`).Scan(&title, &external); err != nil {
+		t.Fatal(err)
+	}
+
+	if title != "legacy" {
+		t.Fatalf("title = %q after adopting, want legacy", title)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	ctx := context.Background()
+
+	for name, sqlDB := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := CheckSchema(ctx, sqlDB); !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("empty database: %v", err)
+			}
+
+			if left := tables(t, sqlDB); len(left) > 0 {
+				t.Fatalf("CheckSchema created tables %v", left)
+			}
+
+			if err := Migrate(ctx, sqlDB); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := CheckSchema(ctx, sqlDB); err != nil {
+				t.Fatalf("migrated database: %v", err)
+			}
+
+			if _, err := Rollback(ctx, sqlDB, 1); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := CheckSchema(ctx, sqlDB); !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("one migration behind: %v", err)
+			}
+
+			if err := Migrate(ctx, sqlDB); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := sqlDB.Exec(`INSERT INTO schema_migrations(version, name) VALUES (9999, 'future')`); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := CheckSchema(ctx, sqlDB); !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("migrated by a newer build: %v", err)
+			}
+		})
+	}
+}
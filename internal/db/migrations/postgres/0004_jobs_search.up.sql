@@ -0,0 +1,8 @@
+-- search indexes job titles and payloads; a match in the title ranks
+-- above one in the payload.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', payload), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_search ON jobs USING GIN (search);
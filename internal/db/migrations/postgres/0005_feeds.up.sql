@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS feeds(
+  token TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  filter TEXT NOT NULL, -- query string, see jobs.ParseFilter
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE job_reminders DROP COLUMN IF EXISTS claimed_at;
@@ -0,0 +1,5 @@
+-- The history of deleted jobs goes with the foreign key.
+DELETE FROM job_events e WHERE NOT EXISTS (SELECT 1 FROM jobs j WHERE j.id = e.job_id);
+ALTER TABLE job_events DROP COLUMN IF EXISTS actor_note;
+ALTER TABLE job_events ADD CONSTRAINT job_events_job_id_fkey
+  FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE;
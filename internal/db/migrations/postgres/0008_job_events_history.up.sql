@@ -0,0 +1,6 @@
+-- A job's history outlives it: job_events no longer cascades from jobs,
+-- and deleting a job records a deleted event instead. actor_note keeps the
+-- name a client gave for itself, unverified, next to the actor the server
+-- determined.
+ALTER TABLE job_events DROP CONSTRAINT IF EXISTS job_events_job_id_fkey;
+ALTER TABLE job_events ADD COLUMN IF NOT EXISTS actor_note TEXT NOT NULL DEFAULT '';
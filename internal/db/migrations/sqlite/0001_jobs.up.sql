@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS jobs(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  tz TEXT NOT NULL,
+  run_at_utc TIMESTAMP NOT NULL,
+  due_at_utc TIMESTAMP NOT NULL, -- next pending reminder
+  remind_before_minutes INTEGER NOT NULL DEFAULT 0, -- largest reminder offset
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|enqueued|cancelled|missed|skipped
+  misfire_policy TEXT NOT NULL DEFAULT '',
+  tenant TEXT NOT NULL DEFAULT '',
+  max_delay_seconds INTEGER NOT NULL DEFAULT 0,
+  calendar TEXT NOT NULL DEFAULT '',
+  payload TEXT NOT NULL DEFAULT '',
+  external_id TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_due ON jobs(status, due_at_utc);
+
+-- Imported jobs are matched by their external id on re-import.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_external_id ON jobs(external_id) WHERE external_id != '';
+
+CREATE TABLE IF NOT EXISTS job_reminders(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+  offset_minutes INTEGER NOT NULL,
+  due_at_utc TIMESTAMP NOT NULL, -- run_at - offset
+  status TEXT NOT NULL DEFAULT 'pending', -- pending|enqueued|missed|skipped|cancelled
+  snoozed_from INTEGER REFERENCES job_reminders(id) ON DELETE SET NULL,
+  snooze_count INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_reminders_status_due ON job_reminders(status, due_at_utc);
+CREATE INDEX IF NOT EXISTS idx_job_reminders_job ON job_reminders(job_id);
+
+-- Jobs created before reminders moved to their own table get a single
+-- reminder that mirrors the job.
+INSERT INTO job_reminders(job_id, offset_minutes, due_at_utc, status)
+SELECT id, remind_before_minutes, due_at_utc, status FROM jobs j
+WHERE NOT EXISTS (SELECT 1 FROM job_reminders r WHERE r.job_id = j.id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS job_labels(
+  job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+  PRIMARY KEY(job_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_labels_key_value ON job_labels(key, value);
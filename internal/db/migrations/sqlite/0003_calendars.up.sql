@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS calendars(
+  name TEXT PRIMARY KEY,
+  spec TEXT NOT NULL, -- JSON calendar.Calendar
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS jobs_fts_au;
+DROP TRIGGER IF EXISTS jobs_fts_ad;
+DROP TRIGGER IF EXISTS jobs_fts_ai;
+DROP TABLE IF EXISTS jobs_fts;
@@ -0,0 +1,23 @@
+-- jobs_fts is an external content FTS5 index over job titles and payloads,
+-- kept in sync by triggers.
+CREATE VIRTUAL TABLE IF NOT EXISTS jobs_fts USING fts5(
+  title, payload,
+  content='jobs', content_rowid='id',
+  tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS jobs_fts_ai AFTER INSERT ON jobs BEGIN
+  INSERT INTO jobs_fts(rowid, title, payload) VALUES (new.id, new.title, new.payload);
+END;
+
+CREATE TRIGGER IF NOT EXISTS jobs_fts_ad AFTER DELETE ON jobs BEGIN
+  INSERT INTO jobs_fts(jobs_fts, rowid, title, payload) VALUES ('delete', old.id, old.title, old.payload);
+END;
+
+CREATE TRIGGER IF NOT EXISTS jobs_fts_au AFTER UPDATE OF title, payload ON jobs BEGIN
+  INSERT INTO jobs_fts(jobs_fts, rowid, title, payload) VALUES ('delete', old.id, old.title, old.payload);
+  INSERT INTO jobs_fts(rowid, title, payload) VALUES (new.id, new.title, new.payload);
+END;
+
+-- Index the jobs that already exist.
+INSERT INTO jobs_fts(jobs_fts) VALUES ('rebuild');
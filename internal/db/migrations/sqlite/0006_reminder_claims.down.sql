@@ -0,0 +1 @@
+ALTER TABLE job_reminders DROP COLUMN claimed_at;
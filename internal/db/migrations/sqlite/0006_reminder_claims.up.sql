@@ -0,0 +1,3 @@
+-- claimed_at is set while a scheduler delivers a pending reminder, so
+-- other schedulers sharing the database leave it alone.
+ALTER TABLE job_reminders ADD COLUMN claimed_at TIMESTAMP;
@@ -0,0 +1,19 @@
+-- Every transition of a job, oldest first: created, edited, snoozed,
+-- enqueued, retried, missed, skipped, cancelled, acked.
+CREATE TABLE IF NOT EXISTS job_events(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+  reminder_id INTEGER REFERENCES job_reminders(id) ON DELETE SET NULL, -- null for events of the whole job
+  kind TEXT NOT NULL,
+  actor TEXT NOT NULL DEFAULT '', -- who made the change: admin, api, scheduler, ...
+  details TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_events_job ON job_events(job_id, id);
+
+-- Jobs created before their history was recorded start with a created
+-- event by no one in particular.
+INSERT INTO job_events(job_id, kind, created_at)
+SELECT id, 'created', created_at FROM jobs j
+WHERE NOT EXISTS (SELECT 1 FROM job_events e WHERE e.job_id = j.id);
@@ -0,0 +1,19 @@
+-- The history of deleted jobs goes with the foreign key.
+CREATE TABLE job_events_old(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+  reminder_id INTEGER REFERENCES job_reminders(id) ON DELETE SET NULL,
+  kind TEXT NOT NULL,
+  actor TEXT NOT NULL DEFAULT '',
+  details TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO job_events_old(id, job_id, reminder_id, kind, actor, details, created_at)
+SELECT id, job_id, reminder_id, kind, actor, details, created_at FROM job_events
+WHERE job_id IN (SELECT id FROM jobs);
+
+DROP TABLE job_events;
+ALTER TABLE job_events_old RENAME TO job_events;
+
+CREATE INDEX IF NOT EXISTS idx_job_events_job ON job_events(job_id, id);
@@ -0,0 +1,22 @@
+-- A job's history outlives it: job_events no longer cascades from jobs,
+-- and deleting a job records a deleted event instead. actor_note keeps the
+-- name a client gave for itself, unverified, next to the actor the server
+-- determined.
+CREATE TABLE job_events_new(
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  job_id INTEGER NOT NULL, -- the job may have been deleted
+  reminder_id INTEGER REFERENCES job_reminders(id) ON DELETE SET NULL, -- null for events of the whole job
+  kind TEXT NOT NULL,
+  actor TEXT NOT NULL DEFAULT '', -- who made the change: admin, api, scheduler, ...
+  actor_note TEXT NOT NULL DEFAULT '', -- the client's X-Actor header
+  details TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO job_events_new(id, job_id, reminder_id, kind, actor, details, created_at)
+SELECT id, job_id, reminder_id, kind, actor, details, created_at FROM job_events;
+
+DROP TABLE job_events;
+ALTER TABLE job_events_new RENAME TO job_events;
+
+CREATE INDEX IF NOT EXISTS idx_job_events_job ON job_events(job_id, id);
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// openPostgres opens a pool of pgx connections whose statements may use ?
+// placeholders like SQLite's. Sessions run in UTC, so text timestamps bound
+// as parameters compare as they do in SQLite.
+func openPostgres(dsn string) (*sql.DB, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.RuntimeParams["timezone"] = "UTC"
+
+	return sql.OpenDB(rebindConnector{stdlib.GetConnector(*cfg)}), nil
+}
+
+type rebindConnector struct{ driver.Connector }
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, ok := conn.(pgConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("db: unexpected pgx connection type %T", conn)
+	}
+
+	return rebindConn{pc}, nil
+}
+
+// pgConn is the part of *stdlib.Conn that database/sql uses.
+type pgConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.NamedValueChecker
+	driver.SessionResetter
+	driver.Validator
+}
+
+// rebindConn rewrites ? placeholders to PostgreSQL's $1, $2, ... before
+// passing statements on.
+type rebindConn struct{ pgConn }
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.pgConn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.pgConn.PrepareContext(ctx, rebind(query))
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.pgConn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.pgConn.QueryContext(ctx, rebind(query), args)
+}
+
+// rebind numbers the ? placeholders of query, leaving string literals,
+// quoted identifiers and comments alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b     strings.Builder
+		n     int
+		quote byte // the open quote, if any
+	)
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+
+			b.WriteString(query[i : i+end])
+			i += end - 1
+
+			continue
+		case ch == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+
+			continue
+		}
+
+		b.WriteByte(ch)
+	}
+
+	return b.String()
+}
@@ -7,29 +7,53 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-func Open(path string) (*sql.DB, error) {
+func openSQLite(path string) (*sql.DB, error) {
 	// Busy timeout, WAL ve foreign_keys
 	dsn := "file:" + path + "?cache=shared&mode=rwc&_pragma=busy_timeout=5000&_pragma=journal_mode=WAL&_pragma=foreign_keys=ON"
 	return sql.Open("sqlite", dsn)
 }
 
-func Migrate(ctx context.Context, sqlDB *sql.DB) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS jobs(
-		   id INTEGER PRIMARY KEY AUTOINCREMENT,
-		   title TEXT NOT NULL,
-		   tz TEXT NOT NULL,
-		   run_at_utc TIMESTAMP NOT NULL,
-		   due_at_utc TIMESTAMP NOT NULL, -- run_at - remind_before
-		   remind_before_minutes INTEGER NOT NULL DEFAULT 0,
-           status TEXT NOT NULL DEFAULT 'pending', -- pending|enqueued|cancelled
-		   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		 );`,
-		`CREATE INDEX IF NOT EXISTS idx_jobs_status_due ON jobs(status, due_at_utc);`,
+// adoptLegacy prepares a database created before versioned migrations,
+// which has a jobs table but no schema_migrations. Its tables may lack
+// columns added since the first release; once they are added, the
+// migrations, which only create what is missing, bring it up to date.
+func adoptLegacy(ctx context.Context, conn *sql.Conn) error {
+	var n int
+	err := conn.QueryRowContext(ctx, `
+	  SELECT COUNT(*) FROM sqlite_master
+	  WHERE type = 'table' AND name = 'jobs'
+	  AND NOT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`).Scan(&n)
+	if err != nil || n == 0 {
+		return err
 	}
 
-	for _, s := range stmts {
-		if _, err := sqlDB.ExecContext(ctx, s); err != nil {
+	// ALTER TABLE has no IF NOT EXISTS.
+	columns := []struct{ table, name, def string }{
+		{"jobs", "misfire_policy", `TEXT NOT NULL DEFAULT ''`},
+		{"jobs", "tenant", `TEXT NOT NULL DEFAULT ''`},
+		{"jobs", "max_delay_seconds", `INTEGER NOT NULL DEFAULT 0`},
+		{"jobs", "calendar", `TEXT NOT NULL DEFAULT ''`},
+		{"jobs", "payload", `TEXT NOT NULL DEFAULT ''`},
+		{"jobs", "external_id", `TEXT NOT NULL DEFAULT ''`},
+		{"job_reminders", "snoozed_from", `INTEGER REFERENCES job_reminders(id) ON DELETE SET NULL`},
+		{"job_reminders", "snooze_count", `INTEGER NOT NULL DEFAULT 0`},
+	}
+
+	for _, c := range columns {
+		var cols, has int
+		err := conn.QueryRowContext(ctx, `
+		  SELECT COUNT(*), COUNT(*) FILTER (WHERE name = ?) FROM pragma_table_info(?)`,
+			c.name, c.table).Scan(&cols, &has)
+		if err != nil {
+			return err
+		}
+
+		// A missing table is created whole by its migration.
+		if cols == 0 || has > 0 {
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE `+c.table+` ADD COLUMN `+c.name+` `+c.def); err != nil {
 			return err
 		}
 	}
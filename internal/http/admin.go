@@ -3,9 +3,11 @@ package httpx
 import (
 	"context"
 	"embed"
+	"errors"
 	"html/template"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -15,7 +17,7 @@ import (
 )
 
 type AdminHandlers struct {
-	Repo        *jobs.Repo
+	Repo        jobs.Store
 	Scheduler   *jobs.Scheduler
 	TemplatesFS embed.FS
 	Assets      embed.FS
@@ -26,34 +28,74 @@ type createJobForm struct {
 	Title               string `validate:"required,min=3"`
 	TZ                  string `validate:"required"`
 	RunAt               string `validate:"required"`
-	RemindBeforeMinutes int    `validate:"min=0,max=10080"`
+	RemindBeforeMinutes []int  `validate:"required,max=10,dive,min=0,max=10080"`
+	MisfirePolicy       string `validate:"omitempty,oneof=fire_now coalesce skip window"`
+	Tenant              string `validate:"max=64"`
+	MaxDelaySeconds     int    `validate:"min=0,max=86400"`
+	Calendar            string `validate:"max=64"`
+	Labels              map[string]string
+	Payload             string `validate:"max=65536"`
 }
 
 func (a *AdminHandlers) Index(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	status := r.URL.Query().Get("status")
-	if status == "" {
-		status = "pending"
+	filter, err := jobs.ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if filter.Status == "" {
+		filter.Status = "pending"
+	}
+
+	if filter.Limit < 1 {
+		filter.Limit = 25
+	}
+
+	filter.Limit = min(filter.Limit, maxPageLimit)
+
+	// Relevance-ranked searches are paged by number, everything else by
+	// cursor.
+	var (
+		list    []jobs.Job
+		jobPage *jobs.JobPage
+		cursor  *jobs.CursorPage
+	)
+
+	if filter.Ranked() {
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+
+		jobPage, err = a.Repo.GetJobsPaginated(ctx, filter)
+		if jobPage != nil {
+			list = jobPage.Jobs
+		}
+	} else {
+		cursor, err = a.Repo.ListJobs(ctx, filter)
+		if cursor != nil {
+			list = cursor.Jobs
+		}
 	}
 
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+	if errors.Is(err, jobs.ErrInvalidCursor) {
+		http.Error(w, err.Error(), 400)
+		return
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 {
-		limit = 25
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
 	}
 
-	filter := jobs.JobFilter{
-		Status: status,
-		Page:   page,
-		Limit:  limit,
+	ids := make([]int64, len(list))
+	for i, j := range list {
+		ids[i] = j.ID
 	}
 
-	jobPage, err := a.Repo.GetJobsPaginated(ctx, filter)
+	reminders, err := a.Repo.RemindersFor(ctx, ids)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -61,13 +103,14 @@ func (a *AdminHandlers) Index(w http.ResponseWriter, r *http.Request) {
 
 	type row struct {
 		jobs.Job
-		RunAtLocal string
-		DueAtLocal string
-		DueIn      string
+		RunAtLocal      string
+		DueAtLocal      string
+		DueIn           string
+		AdjustedAtLocal string
 	}
 
 	var rows []row
-	for _, j := range jobPage.Jobs {
+	for _, j := range list {
 		loc, _ := time.LoadLocation(j.TZ)
 		dueIn := "-"
 
@@ -75,19 +118,43 @@ func (a *AdminHandlers) Index(w http.ResponseWriter, r *http.Request) {
 			dueIn = humanizeUntil(j.DueAtUTC)
 		}
 
+		adjusted := ""
+		if j.Calendar != "" && j.Status == "pending" {
+			at, skip := a.Scheduler.Adjust(j, j.DueAtUTC)
+			switch {
+			case skip:
+				adjusted = "skipped"
+			case !at.Equal(j.DueAtUTC):
+				adjusted = at.In(loc).Format("2006-01-02 15:04:05")
+				dueIn = humanizeUntil(at)
+			}
+		}
+
+		j.Reminders = reminders[j.ID]
+
 		rows = append(rows, row{
-			Job:        j,
-			RunAtLocal: j.RunAtUTC.In(loc).Format("2006-01-02 15:04:05"),
-			DueAtLocal: j.DueAtUTC.In(loc).Format("2006-01-02 15:04:05"),
-			DueIn:      dueIn,
+			Job:             j,
+			RunAtLocal:      j.RunAtUTC.In(loc).Format("2006-01-02 15:04:05"),
+			DueAtLocal:      j.DueAtUTC.In(loc).Format("2006-01-02 15:04:05"),
+			DueIn:           dueIn,
+			AdjustedAtLocal: adjusted,
 		})
 	}
 
+	zones, err := a.Repo.TimeZones(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
 	data := map[string]any{
 		"Rows":       rows,
 		"Page":       jobPage,
+		"Cursor":     cursor,
 		"Filter":     filter,
-		"StatusList": []string{"all", "pending", "enqueued", "cancelled"},
+		"StatusList": []string{"all", "pending", "enqueued", "cancelled", "missed", "skipped"},
+		"TimeZones":  zones,
+		"SortFields": jobs.SortFields,
 	}
 
 	tmpl := template.New("index").Funcs(template.FuncMap{
@@ -106,7 +173,15 @@ func (a *AdminHandlers) Index(w http.ResponseWriter, r *http.Request) {
 			}
 			return result
 		},
-		"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+		"rfc3339":   func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+		"pageURL":   pageURL,
+		"cursorURL": cursorURL,
+		"filterQuery": func(f jobs.JobFilter) string {
+			return f.Query().Encode()
+		},
+		"bound":      jobs.FormatBound,
+		"exportURL":  exportURL,
+		"newFeedURL": newFeedURL,
 	})
 
 	tmpl = template.Must(tmpl.ParseFS(a.TemplatesFS, "layout.tmpl", "index.tmpl"))
@@ -114,8 +189,14 @@ func (a *AdminHandlers) Index(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *AdminHandlers) NewForm(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFS(a.TemplatesFS, "layout.tmpl", "new.tmpl"))
-	_ = tmpl.ExecuteTemplate(w, "new", nil)
+	a.renderJobForm(w, jobForm{
+		Heading: "New Job",
+		Action:  "/jobs",
+		Submit:  "Create",
+		TZ:      "Europe/Istanbul",
+		Offsets: "5",
+		Import:  true,
+	})
 }
 
 func humanizeUntil(t time.Time) string {
@@ -197,44 +278,78 @@ func parseTimeInTZ(s, tz string) (time.Time, error) {
 	return time.ParseInLocation(layout, s, loc)
 }
 
-func (a *AdminHandlers) CreateJob(w http.ResponseWriter, r *http.Request) {
+// buildJob validates a job form, from the admin UI or an import row, and
+// turns it into an unsaved job.
+func (a *AdminHandlers) buildJob(form createJobForm) (jobs.Job, error) {
+	if err := a.Validate.Struct(form); err != nil {
+		return jobs.Job{}, err
+	}
+
+	if _, ok := a.Scheduler.Calendars.Get(form.Calendar); form.Calendar != "" && !ok {
+		return jobs.Job{}, errors.New("unknown calendar: " + form.Calendar)
+	}
+
+	runLocal, err := parseTimeInTZ(form.RunAt, form.TZ)
+	if err != nil {
+		return jobs.Job{}, errors.New("invalid time or timezone: " + err.Error())
+	}
+
+	return jobs.Job{
+		Title:           form.Title,
+		TZ:              form.TZ,
+		RunAtUTC:        runLocal.UTC(),
+		Reminders:       jobs.OffsetReminders(form.RemindBeforeMinutes),
+		MisfirePolicy:   jobs.MisfirePolicy(form.MisfirePolicy),
+		Tenant:          form.Tenant,
+		MaxDelaySeconds: form.MaxDelaySeconds,
+		Calendar:        form.Calendar,
+		Labels:          form.Labels,
+		Payload:         form.Payload,
+	}, nil
+}
+
+// parseJobForm reads a job from the fields of new.tmpl.
+func (a *AdminHandlers) parseJobForm(r *http.Request) (jobs.Job, error) {
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, err.Error(), 400)
-		return
+		return jobs.Job{}, err
+	}
+
+	offsets, err := jobs.ParseOffsets(r.PostForm.Get("remind_before_minutes"))
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	labels, err := jobs.ParseLabels(r.PostForm.Get("labels"))
+	if err != nil {
+		return jobs.Job{}, err
 	}
 
-	mins, _ := strconv.Atoi(r.PostForm.Get("remind_before_minutes"))
+	maxDelay, _ := strconv.Atoi(r.PostForm.Get("max_delay_seconds"))
 
 	form := createJobForm{
 		Title:               r.PostForm.Get("title"),
 		TZ:                  r.PostForm.Get("tz"),
 		RunAt:               r.PostForm.Get("run_at"),
-		RemindBeforeMinutes: mins,
+		RemindBeforeMinutes: offsets,
+		MisfirePolicy:       r.PostForm.Get("misfire_policy"),
+		Tenant:              r.PostForm.Get("tenant"),
+		MaxDelaySeconds:     maxDelay,
+		Calendar:            r.PostForm.Get("calendar"),
+		Labels:              labels,
+		Payload:             r.PostForm.Get("payload"),
 	}
 
-	if err := a.Validate.Struct(form); err != nil {
-		http.Error(w, err.Error(), 400)
-		return
-	}
+	return a.buildJob(form)
+}
 
-	runLocal, err := parseTimeInTZ(form.RunAt, form.TZ)
+func (a *AdminHandlers) CreateJob(w http.ResponseWriter, r *http.Request) {
+	j, err := a.parseJobForm(r)
 	if err != nil {
-		http.Error(w, "invalid time or timezone: "+err.Error(), 400)
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	runUTC := runLocal.UTC()
-	dueUTC := runUTC.Add(-time.Duration(form.RemindBeforeMinutes) * time.Minute)
-
-	j := jobs.Job{
-		Title:               form.Title,
-		TZ:                  form.TZ,
-		RunAtUTC:            runUTC,
-		DueAtUTC:            dueUTC,
-		RemindBeforeMinutes: form.RemindBeforeMinutes,
-	}
-
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 
 	id, err := a.Repo.Insert(ctx, &j)
 	if err != nil {
@@ -244,12 +359,20 @@ func (a *AdminHandlers) CreateJob(w http.ResponseWriter, r *http.Request) {
 
 	j.ID = id
 
-	a.Scheduler.ScheduleNew(j)
+	if err := a.Scheduler.ScheduleNew(ctx, j); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (a *AdminHandlers) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
 	idStr := chi.URLParam(r, "id")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
 
@@ -258,21 +381,48 @@ func (a *AdminHandlers) CancelJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	a.Scheduler.Cancel(id)
+
+	http.Redirect(w, r, backTo(r), http.StatusSeeOther)
 }
 
-func (a *AdminHandlers) ReschedulePending(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	since := time.Now().UTC().Add(-24 * time.Hour)
+// backTo is where a form returns after its action: the local path in its
+// back field, such as the job page it was posted from, or the index.
+func backTo(r *http.Request) string {
+	back := r.PostForm.Get("back")
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.HasPrefix(back, "/\\") {
+		return "/"
+	}
+
+	return back
+}
+
+func (a *AdminHandlers) SnoozeJob(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
-	jobs, err := a.Repo.LoadPendingSince(ctx, since)
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	at, err := snoozeUntil(r.PostForm.Get("for"), "")
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := a.Scheduler.Snooze(context.WithoutCancel(r.Context()), id, at); err != nil {
+		http.Error(w, err.Error(), snoozeStatus(err))
 		return
 	}
 
-	for _, j := range jobs {
-		a.Scheduler.ScheduleNew(j)
+	http.Redirect(w, r, backTo(r), http.StatusSeeOther)
+}
+
+func (a *AdminHandlers) ReschedulePending(w http.ResponseWriter, r *http.Request) {
+	if err := a.Scheduler.Reload(r.Context()); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -0,0 +1,297 @@
+package httpx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+type jobJSON struct {
+	ID              int64             `json:"id"`
+	Title           string            `json:"title"`
+	TZ              string            `json:"tz"`
+	RunAtUTC        time.Time         `json:"run_at_utc"`
+	DueAtUTC        time.Time         `json:"due_at_utc"`
+	Status          string            `json:"status"`
+	MisfirePolicy   string            `json:"misfire_policy,omitempty"`
+	Tenant          string            `json:"tenant,omitempty"`
+	MaxDelaySeconds int               `json:"max_delay_seconds,omitempty"`
+	Calendar        string            `json:"calendar,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Payload         string            `json:"payload,omitempty"`
+	ExternalID      string            `json:"external_id,omitempty"`
+	Reminders       []reminderJSON    `json:"reminders"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+func toJobJSON(j jobs.Job) jobJSON {
+	res := jobJSON{
+		ID:              j.ID,
+		Title:           j.Title,
+		TZ:              j.TZ,
+		RunAtUTC:        j.RunAtUTC,
+		DueAtUTC:        j.DueAtUTC,
+		Status:          j.Status,
+		MisfirePolicy:   string(j.MisfirePolicy),
+		Tenant:          j.Tenant,
+		MaxDelaySeconds: j.MaxDelaySeconds,
+		Calendar:        j.Calendar,
+		Labels:          j.Labels,
+		Payload:         j.Payload,
+		ExternalID:      j.ExternalID,
+		Reminders:       make([]reminderJSON, len(j.Reminders)),
+		CreatedAt:       j.CreatedAt,
+	}
+
+	for i, r := range j.Reminders {
+		res.Reminders[i] = toReminderJSON(r)
+	}
+
+	return res
+}
+
+// jobPageJSON carries either page numbers or cursors, depending on how the
+// list was paged.
+type jobPageJSON struct {
+	Jobs       []jobJSON `json:"jobs"`
+	Total      *int      `json:"total,omitempty"`
+	Limit      int       `json:"limit"`
+	Page       int       `json:"page,omitempty"`
+	TotalPages int       `json:"total_pages,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
+}
+
+// maxPageLimit bounds the jobs listed per page.
+const maxPageLimit = 500
+
+// APIListJobs lists jobs matching the filter in the query string; see
+// jobs.ParseFilter for the parameters. It pages by cursor unless ?page= is
+// given or the results are ranked by relevance, which need page numbers;
+// cursor pages include a total only with ?total=true.
+func (a *AdminHandlers) APIListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	filter, err := jobs.ParseFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if filter.Limit < 1 {
+		filter.Limit = 50
+	}
+
+	filter.Limit = min(filter.Limit, maxPageLimit)
+
+	var (
+		list []jobs.Job
+		res  = jobPageJSON{Limit: filter.Limit}
+	)
+
+	if filter.Ranked() || (filter.Page > 0 && filter.Cursor == "") {
+		jobPage, err := a.Repo.GetJobsPaginated(ctx, filter)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		list = jobPage.Jobs
+		res.Total = &jobPage.Total
+		res.Page, res.TotalPages = jobPage.Page, jobPage.TotalPages
+	} else {
+		cursor, err := a.Repo.ListJobs(ctx, filter)
+		if errors.Is(err, jobs.ErrInvalidCursor) {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		list = cursor.Jobs
+		res.NextCursor, res.PrevCursor = cursor.Next, cursor.Prev
+		if cursor.Total >= 0 {
+			res.Total = &cursor.Total
+		}
+	}
+
+	ids := make([]int64, len(list))
+	for i, j := range list {
+		ids[i] = j.ID
+	}
+
+	reminders, err := a.Repo.RemindersFor(ctx, ids)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res.Jobs = make([]jobJSON, len(list))
+	for i, j := range list {
+		j.Reminders = reminders[j.ID]
+		res.Jobs[i] = toJobJSON(j)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *AdminHandlers) APIListCalendars(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Scheduler.Calendars.List())
+}
+
+func (a *AdminHandlers) APIPutCalendar(w http.ResponseWriter, r *http.Request) {
+	var c calendar.Calendar
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Name = chi.URLParam(r, "name")
+
+	if err := c.Compile(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := a.Scheduler.PutCalendar(context.WithoutCancel(r.Context()), &c); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &c)
+}
+
+func (a *AdminHandlers) APIDeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	if err := a.Scheduler.DeleteCalendar(context.WithoutCancel(r.Context()), chi.URLParam(r, "name")); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxSnooze bounds relative snoozes.
+const maxSnooze = 30 * 24 * time.Hour
+
+// snoozeUntil resolves a snooze request given either as a duration ("10m")
+// or as an absolute RFC 3339 time.
+func snoozeUntil(forStr, atStr string) (time.Time, error) {
+	now := time.Now().UTC()
+
+	if forStr != "" {
+		d, err := time.ParseDuration(forStr)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if d <= 0 || d > maxSnooze {
+			return time.Time{}, fmt.Errorf("snooze duration must be between 0 and %s", maxSnooze)
+		}
+
+		return now.Add(d), nil
+	}
+
+	if atStr == "" {
+		return time.Time{}, errors.New("either for or at is required")
+	}
+
+	at, err := time.Parse(time.RFC3339, atStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !at.After(now) {
+		return time.Time{}, errors.New("snooze time must be in the future")
+	}
+
+	return at, nil
+}
+
+func snoozeStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, jobs.ErrNotSnoozable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type snoozeRequest struct {
+	For string `json:"for"`
+	At  string `json:"at"`
+}
+
+type reminderJSON struct {
+	ID            int64     `json:"id"`
+	JobID         int64     `json:"job_id"`
+	OffsetMinutes int       `json:"offset_minutes"`
+	DueAtUTC      time.Time `json:"due_at_utc"`
+	Status        string    `json:"status"`
+	SnoozedFrom   int64     `json:"snoozed_from,omitempty"`
+	SnoozeCount   int       `json:"snooze_count,omitempty"`
+}
+
+func toReminderJSON(r jobs.Reminder) reminderJSON {
+	return reminderJSON{
+		ID:            r.ID,
+		JobID:         r.JobID,
+		OffsetMinutes: r.OffsetMinutes,
+		DueAtUTC:      r.DueAtUTC,
+		Status:        r.Status,
+		SnoozedFrom:   r.SnoozedFrom,
+		SnoozeCount:   r.SnoozeCount,
+	}
+}
+
+func (a *AdminHandlers) APISnoozeJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req snoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	at, err := snoozeUntil(req.For, req.At)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rem, err := a.Scheduler.Snooze(context.WithoutCancel(r.Context()), id, at)
+	if err != nil {
+		writeJSONError(w, snoozeStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toReminderJSON(rem))
+}
@@ -0,0 +1,216 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+// maxShift bounds bulk reschedules in either direction.
+const maxShift = 366 * 24 * time.Hour
+
+// bulkOp is a validated bulk action from the admin form or the API.
+type bulkOp struct {
+	action string // cancel|reschedule|retag|delete
+	sel    jobs.Selection
+	offset time.Duration
+	set    map[string]string
+	remove []string
+}
+
+func (op bulkOp) validate() error {
+	switch op.action {
+	case "cancel", "delete":
+	case "reschedule":
+		if op.offset == 0 || op.offset < -maxShift || op.offset > maxShift {
+			return fmt.Errorf("offset must be non-zero and within ±%s", maxShift)
+		}
+	case "retag":
+		if len(op.set) == 0 && len(op.remove) == 0 {
+			return errors.New("retag needs labels to set or remove")
+		}
+
+		if err := jobs.ValidateLabels(op.set); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown bulk action %q", op.action)
+	}
+
+	return op.sel.Validate()
+}
+
+func (a *AdminHandlers) runBulk(ctx context.Context, op bulkOp) ([]int64, error) {
+	switch op.action {
+	case "cancel":
+		return a.Scheduler.CancelJobs(ctx, op.sel)
+	case "delete":
+		return a.Scheduler.DeleteJobs(ctx, op.sel)
+	case "reschedule":
+		return a.Scheduler.ShiftJobs(ctx, op.sel, op.offset)
+	default:
+		return a.Scheduler.RelabelJobs(ctx, op.sel, op.set, op.remove)
+	}
+}
+
+func parseKeys(s string) []string {
+	var res []string
+
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			res = append(res, k)
+		}
+	}
+
+	return res
+}
+
+// BulkJobs applies a bulk action to the checked rows of the index, or to
+// every job matching the index filter when scope is "filter".
+func (a *AdminHandlers) BulkJobs(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	back := r.PostForm.Get("filter")
+
+	op := bulkOp{action: r.PostForm.Get("action")}
+
+	if r.PostForm.Get("scope") == "filter" {
+		q, err := url.ParseQuery(back)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		f, err := jobs.ParseFilter(q)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		op.sel.Filter = &f
+	} else {
+		for _, s := range r.PostForm["id"] {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid job id: "+s, 400)
+				return
+			}
+
+			op.sel.IDs = append(op.sel.IDs, id)
+		}
+	}
+
+	var err error
+
+	if s := r.PostForm.Get("offset"); s != "" {
+		if op.offset, err = time.ParseDuration(s); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+
+	if op.set, err = jobs.ParseLabels(r.PostForm.Get("set_labels")); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	op.remove = parseKeys(r.PostForm.Get("remove_labels"))
+
+	if err := op.validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := a.runBulk(context.WithoutCancel(r.Context()), op); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	http.Redirect(w, r, "/?"+back, http.StatusSeeOther)
+}
+
+// bulkRequest selects jobs by ids or by a filter given as the query
+// parameters of GET /api/jobs. A filter without criteria needs All.
+type bulkRequest struct {
+	Action       string            `json:"action"`
+	IDs          []int64           `json:"ids"`
+	Filter       map[string]string `json:"filter"`
+	All          bool              `json:"all"`
+	Offset       string            `json:"offset"`
+	SetLabels    map[string]string `json:"set_labels"`
+	RemoveLabels []string          `json:"remove_labels"`
+}
+
+type bulkResponse struct {
+	Action string  `json:"action"`
+	Count  int     `json:"count"`
+	IDs    []int64 `json:"ids"`
+}
+
+func (a *AdminHandlers) APIBulkJobs(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	op := bulkOp{
+		action: req.Action,
+		sel:    jobs.Selection{IDs: req.IDs, All: req.All},
+		set:    req.SetLabels,
+		remove: req.RemoveLabels,
+	}
+
+	if len(req.IDs) == 0 && req.Filter != nil {
+		q := url.Values{}
+		for k, v := range req.Filter {
+			q.Set(k, v)
+		}
+
+		f, err := jobs.ParseFilter(q)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		op.sel.Filter = &f
+	}
+
+	if req.Offset != "" {
+		d, err := time.ParseDuration(req.Offset)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		op.offset = d
+	}
+
+	if err := op.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ids, err := a.runBulk(context.WithoutCancel(r.Context()), op)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if ids == nil {
+		ids = []int64{}
+	}
+
+	writeJSON(w, http.StatusOK, bulkResponse{Action: op.action, Count: len(ids), IDs: ids})
+}
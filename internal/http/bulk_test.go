@@ -0,0 +1,121 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/yplog/ticktockbox/internal/db"
+	"github.com/yplog/ticktockbox/internal/jobs"
+	"github.com/yplog/ticktockbox/internal/twheel"
+	"github.com/yplog/ticktockbox/public"
+	"github.com/yplog/ticktockbox/templates"
+)
+
+// newTestServer serves the admin UI and API over a fresh SQLite database,
+// with a running wheel and no publisher.
+func newTestServer(t *testing.T) (*httptest.Server, jobs.Store) {
+	t.Helper()
+
+	admin := newTestHandlers(t)
+
+	srv := httptest.NewServer(NewServer(admin).R)
+	t.Cleanup(srv.Close)
+
+	return srv, admin.Repo
+}
+
+// newTestHandlers returns the handlers newTestServer serves. Their
+// scheduler has not loaded its window, so it arms nothing until Warmup.
+func newTestHandlers(t *testing.T) *AdminHandlers {
+	t.Helper()
+
+	ctx := context.Background()
+
+	sqlDB, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.Migrate(ctx, sqlDB); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &jobs.Repo{DB: sqlDB}
+
+	wh := twheel.New(time.Second, 64)
+	wh.Start()
+	t.Cleanup(func() { wh.Stop(context.Background()) })
+
+	return &AdminHandlers{
+		Repo:        repo,
+		Scheduler:   jobs.NewScheduler(repo, nil, wh),
+		TemplatesFS: templates.TemplateFiles,
+		Assets:      public.PublicFiles,
+		Validate:    validator.New(validator.WithRequiredStructEnabled()),
+	}
+}
+
+func TestAPIBulkRejectsEmptyFilter(t *testing.T) {
+	srv, repo := newTestServer(t)
+	ctx := context.Background()
+
+	for _, title := range []string{"first", "second"} {
+		j := jobs.Job{
+			Title:     title,
+			TZ:        "UTC",
+			RunAtUTC:  time.Now().Add(48 * time.Hour).UTC(),
+			Reminders: jobs.OffsetReminders([]int{5}),
+		}
+
+		if _, err := repo.Insert(ctx, &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func() int {
+		t.Helper()
+
+		page, err := repo.ListJobs(ctx, jobs.JobFilter{Status: "all", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return len(page.Jobs)
+	}
+
+	for _, tc := range []struct {
+		body string
+		code int
+		left int
+	}{
+		{`{"action": "delete", "filter": {}}`, http.StatusBadRequest, 2},
+		{`{"action": "cancel", "filter": {"status": "all"}}`, http.StatusBadRequest, 2},
+		{`{"action": "delete"}`, http.StatusBadRequest, 2},
+		{`{"action": "delete", "filter": {"q": "first"}}`, http.StatusOK, 1},
+		{`{"action": "delete", "filter": {}, "all": true}`, http.StatusOK, 0},
+	} {
+		res, err := http.Post(srv.URL+"/api/jobs/bulk", "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != tc.code {
+			t.Errorf("%s: status %d, want %d", tc.body, res.StatusCode, tc.code)
+		}
+
+		if n := count(); n != tc.left {
+			t.Errorf("%s: %d jobs left, want %d", tc.body, n, tc.left)
+		}
+	}
+}
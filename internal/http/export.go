@@ -0,0 +1,48 @@
+package httpx
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+var exportContentTypes = map[string]string{
+	jobs.FormatCSV:    "text/csv; charset=utf-8",
+	jobs.FormatNDJSON: "application/x-ndjson",
+}
+
+// APIExportJobs streams every job matching the filter in the query string
+// as CSV (?format=csv, the default) or NDJSON (?format=ndjson). Paging
+// parameters are ignored.
+func (a *AdminHandlers) APIExportJobs(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = jobs.FormatCSV
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("format must be csv or ndjson"))
+		return
+	}
+
+	filter, err := jobs.ParseFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := fmt.Sprintf("jobs-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	// The status line is already sent once rows stream, so a failure can
+	// only cut the body short.
+	if n, err := a.Repo.Export(r.Context(), w, format, filter); err != nil {
+		log.Printf("export failed after %d jobs err=%v", n, err)
+	}
+}
@@ -0,0 +1,257 @@
+package httpx
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yplog/ticktockbox/internal/ical"
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+// feedURL is the absolute URL calendar apps subscribe to.
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		scheme = p
+	}
+
+	return scheme + "://" + r.Host + "/feeds/" + token + ".ics"
+}
+
+// newFeedURL links to the feeds page with the filter filled in.
+func newFeedURL(f jobs.JobFilter) string {
+	q := f.Query()
+	q.Del("limit")
+	q.Del("total")
+
+	return "/feeds?" + url.Values{"filter": {q.Encode()}}.Encode()
+}
+
+// feedFilter validates a filter query string.
+func feedFilter(s string) (jobs.JobFilter, error) {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return jobs.JobFilter{}, err
+	}
+
+	return jobs.ParseFilter(q)
+}
+
+func toEvent(j jobs.Job, stamp time.Time) ical.Event {
+	e := ical.Event{
+		UID:         "job-" + strconv.FormatInt(j.ID, 10) + "@ticktockbox",
+		Stamp:       stamp,
+		Start:       j.RunAtUTC,
+		TZ:          j.TZ,
+		Summary:     j.Title,
+		Description: j.Payload,
+		Cancelled:   j.Status == "cancelled",
+	}
+
+	for k, v := range j.Labels {
+		e.Categories = append(e.Categories, k+"="+v)
+	}
+
+	slices.Sort(e.Categories)
+
+	for _, o := range j.Offsets() {
+		e.Alarms = append(e.Alarms, ical.Alarm{
+			Before:      time.Duration(o) * time.Minute,
+			Description: j.Title,
+		})
+	}
+
+	return e
+}
+
+// FeedICS serves a feed as iCalendar. Jobs are one-shot, so events carry
+// no RRULE; each of a job's reminder offsets becomes a VALARM.
+func (a *AdminHandlers) FeedICS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	feed, err := a.Repo.Feed(ctx, chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	list, err := a.Repo.FeedJobs(ctx, feed, now)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	cal := ical.Calendar{ProdID: "-//TickTockBox//Reminders//EN", Name: feed.Name}
+	for _, j := range list {
+		cal.Events = append(cal.Events, toEvent(j, now))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	_, _ = cal.WriteTo(w)
+}
+
+// Feeds lists the calendar feeds with a form for a new one, prefilled from
+// ?filter= when coming from the index.
+func (a *AdminHandlers) Feeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := a.Repo.ListFeeds(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	type feedRow struct {
+		jobs.Feed
+		URL      string
+		IndexURL string
+		Text     string
+	}
+
+	rows := make([]feedRow, len(feeds))
+	for i, f := range feeds {
+		text, err := url.QueryUnescape(f.Filter)
+		if err != nil {
+			text = f.Filter
+		}
+
+		rows[i] = feedRow{Feed: f, URL: feedURL(r, f.Token), IndexURL: "/?" + f.Filter, Text: text}
+	}
+
+	data := map[string]any{
+		"Feeds":  rows,
+		"Filter": r.URL.Query().Get("filter"),
+	}
+
+	tmpl := template.Must(template.ParseFS(a.TemplatesFS, "layout.tmpl", "feeds.tmpl"))
+	_ = tmpl.ExecuteTemplate(w, "feeds", data)
+}
+
+func (a *AdminHandlers) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	name := strings.TrimSpace(r.PostForm.Get("name"))
+	if name == "" {
+		http.Error(w, "name is required", 400)
+		return
+	}
+
+	filter, err := feedFilter(r.PostForm.Get("filter"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := a.Repo.CreateFeed(r.Context(), name, filter); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+func (a *AdminHandlers) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	if err := a.Repo.DeleteFeed(r.Context(), chi.URLParam(r, "token")); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds", http.StatusSeeOther)
+}
+
+type feedJSON struct {
+	Token     string    `json:"token"`
+	Name      string    `json:"name"`
+	Filter    string    `json:"filter"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toFeedJSON(r *http.Request, f jobs.Feed) feedJSON {
+	return feedJSON{Token: f.Token, Name: f.Name, Filter: f.Filter, URL: feedURL(r, f.Token), CreatedAt: f.CreatedAt}
+}
+
+func (a *AdminHandlers) APIListFeeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := a.Repo.ListFeeds(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := make([]feedJSON, len(feeds))
+	for i, f := range feeds {
+		res[i] = toFeedJSON(r, f)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// feedRequest takes the filter as the query parameters of GET /api/jobs.
+type feedRequest struct {
+	Name   string            `json:"name"`
+	Filter map[string]string `json:"filter"`
+}
+
+func (a *AdminHandlers) APICreateFeed(w http.ResponseWriter, r *http.Request) {
+	var req feedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+
+	q := url.Values{}
+	for k, v := range req.Filter {
+		q.Set(k, v)
+	}
+
+	filter, err := jobs.ParseFilter(q)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	feed, err := a.Repo.CreateFeed(r.Context(), strings.TrimSpace(req.Name), filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toFeedJSON(r, feed))
+}
+
+func (a *AdminHandlers) APIDeleteFeed(w http.ResponseWriter, r *http.Request) {
+	if err := a.Repo.DeleteFeed(r.Context(), chi.URLParam(r, "token")); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package httpx
+
+import (
+	"strconv"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+// pageURL links to another page of the index with the same filter.
+func pageURL(f jobs.JobFilter, page int) string {
+	q := f.Query()
+	q.Set("page", strconv.Itoa(page))
+
+	return "?" + q.Encode()
+}
+
+// cursorURL links to the index page at a cursor with the same filter; an
+// empty cursor links to the first page.
+func cursorURL(f jobs.JobFilter, cursor string) string {
+	q := f.Query()
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+
+	return "?" + q.Encode()
+}
+
+// exportURL links to an export of every job matching the filter.
+func exportURL(f jobs.JobFilter, format string) string {
+	q := f.Query()
+	q.Del("limit")
+	q.Set("format", format)
+
+	return "/api/jobs/export?" + q.Encode()
+}
@@ -0,0 +1,146 @@
+package httpx
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+// maxActor bounds the length of an X-Actor header kept in job history.
+const maxActor = 64
+
+// actor attributes the job changes a request makes, in the jobs' history,
+// to name. A client's X-Actor header is kept next to it as a note: nothing
+// verifies it, so it does not replace the actor.
+func actor(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := jobs.WithActor(r.Context(), name)
+			if note := truncateRunes(strings.TrimSpace(r.Header.Get("X-Actor")), maxActor); note != "" {
+				ctx = jobs.WithActorNote(ctx, note)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// truncateRunes cuts s to at most n bytes without splitting a UTF-8
+// sequence.
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+type eventJSON struct {
+	ID         int64     `json:"id"`
+	JobID      int64     `json:"job_id"`
+	ReminderID int64     `json:"reminder_id,omitempty"`
+	Kind       string    `json:"kind"`
+	Actor      string    `json:"actor"`
+	ActorNote  string    `json:"actor_note,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func toEventJSON(e jobs.Event) eventJSON {
+	return eventJSON{
+		ID:         e.ID,
+		JobID:      e.JobID,
+		ReminderID: e.ReminderID,
+		Kind:       e.Kind,
+		Actor:      e.Actor,
+		ActorNote:  e.ActorNote,
+		Details:    e.Details,
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+// APIJobEvents returns the history of a job, oldest first. A deleted job's
+// history is still there, ending with its deleted event.
+func (a *AdminHandlers) APIJobEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := a.Repo.Events(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(events) == 0 {
+		if _, err := a.Repo.Get(ctx, id); err != nil {
+			writeJSONError(w, ackStatus(err), err)
+			return
+		}
+	}
+
+	res := make([]eventJSON, len(events))
+	for i, e := range events {
+		res[i] = toEventJSON(e)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+type ackRequest struct {
+	ReminderID int64  `json:"reminder_id"`
+	Details    string `json:"details"`
+}
+
+func ackStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, jobs.ErrNotAckable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// APIAckJob lets a consumer report that it handled a delivered reminder,
+// the latest one unless the body names another.
+func (a *AdminHandlers) APIAckJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req ackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	e, err := a.Repo.Ack(r.Context(), id, req.ReminderID, req.Details)
+	if err != nil {
+		writeJSONError(w, ackStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toEventJSON(e))
+}
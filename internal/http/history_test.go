@@ -0,0 +1,93 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+func TestAPIHistoryOutlivesDeletedJob(t *testing.T) {
+	srv, repo := newTestServer(t)
+
+	j := jobs.Job{
+		Title:     "gone",
+		TZ:        "UTC",
+		RunAtUTC:  time.Now().Add(48 * time.Hour).UTC(),
+		Reminders: jobs.OffsetReminders([]int{5}),
+	}
+
+	id, err := repo.Insert(context.Background(), &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header claims to be someone else and runs past maxActor in the
+	// middle of a two-byte rune.
+	claimed := "admin" + strings.Repeat("x", maxActor-6) + "é"
+
+	req, err := http.NewRequest("POST", srv.URL+"/api/jobs/bulk",
+		strings.NewReader(fmt.Sprintf(`{"action": "delete", "ids": [%d]}`, id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Actor", claimed)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("delete: status %d", res.StatusCode)
+	}
+
+	res, err = http.Get(fmt.Sprintf("%s/api/jobs/%d/events", srv.URL, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("events of a deleted job: status %d", res.StatusCode)
+	}
+
+	var events []eventJSON
+	if err := json.NewDecoder(res.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[0].Kind != jobs.EventCreated {
+		t.Fatalf("events = %+v", events)
+	}
+
+	e := events[1]
+	if e.Kind != jobs.EventDeleted || e.Actor != "api" {
+		t.Errorf("last event = %s by %s, want deleted by api", e.Kind, e.Actor)
+	}
+
+	if want := claimed[:maxActor-1]; e.ActorNote != want || !utf8.ValidString(e.ActorNote) {
+		t.Errorf("actor note = %q, want %q", e.ActorNote, want)
+	}
+
+	res, err = http.Get(srv.URL + "/api/jobs/999999/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("events of a job that never existed: status %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,418 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/ical"
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+const (
+	// maxICSBytes bounds an uploaded calendar.
+	maxICSBytes = 10 << 20
+	// defaultICSHorizon is how far ahead recurring events are expanded.
+	defaultICSHorizon = 365
+	// maxICSInstances caps the jobs created for one recurring event.
+	maxICSInstances = 1000
+	// instanceLayout is the instance time in a recurring event's job
+	// external ids.
+	instanceLayout = "20060102T150405Z"
+)
+
+// icsOptions are the query parameters of an iCalendar import.
+type icsOptions struct {
+	loc     *time.Location    // for floating and all-day times
+	labels  map[string]string // added to every job
+	horizon time.Duration
+	dryRun  bool
+}
+
+func parseICSOptions(q map[string][]string) (icsOptions, error) {
+	get := func(k string) string {
+		if v := q[k]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+
+		return ""
+	}
+
+	opts := icsOptions{loc: time.UTC, horizon: defaultICSHorizon * 24 * time.Hour}
+
+	if tz := get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return opts, errors.New("invalid tz: " + err.Error())
+		}
+
+		opts.loc = loc
+	}
+
+	labels, err := jobs.ParseLabels(get("labels"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.labels = labels
+
+	if h := get("horizon_days"); h != "" {
+		days, err := strconv.Atoi(h)
+		if err != nil || days < 1 || days > 3660 {
+			return opts, errors.New("horizon_days must be between 1 and 3660")
+		}
+
+		opts.horizon = time.Duration(days) * 24 * time.Hour
+	}
+
+	opts.dryRun, _ = strconv.ParseBool(get("dry_run"))
+
+	return opts, nil
+}
+
+type icsError struct {
+	UID   string `json:"uid"`
+	Error string `json:"error"`
+}
+
+type icsReport struct {
+	Events    int        `json:"events"`
+	Jobs      int        `json:"jobs"` // occurrences mapped to jobs
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Unchanged int        `json:"unchanged"`
+	Cancelled int        `json:"cancelled"`
+	Skipped   int        `json:"skipped"` // single events in the past
+	Failed    int        `json:"failed"`
+	DryRun    bool       `json:"dry_run,omitempty"`
+	Errors    []icsError `json:"errors"`
+}
+
+func (rep *icsReport) fail(uid string, err error) {
+	rep.Failed++
+
+	if len(rep.Errors) < maxImportErrors {
+		rep.Errors = append(rep.Errors, icsError{UID: uid, Error: err.Error()})
+	}
+}
+
+// icsSeries is the events sharing a UID: the master event and the
+// overrides of its instances, keyed by their RECURRENCE-ID in UTC.
+type icsSeries struct {
+	master    *ical.Event
+	overrides map[time.Time]ical.Event
+}
+
+// importICS turns the events of a calendar into jobs. A single event
+// becomes one job with its UID as external id; a recurring one becomes a
+// job per instance within the horizon, with external id UID/instance time.
+// Re-importing the same calendar updates those jobs in place and cancels
+// the ones whose event or instance was cancelled or removed.
+func (a *AdminHandlers) importICS(ctx context.Context, roots []*ical.Component, opts icsOptions) (icsReport, error) {
+	rep := icsReport{DryRun: opts.dryRun, Errors: []icsError{}}
+
+	events, errs := ical.Events(roots, opts.loc)
+
+	rep.Events = len(events) + len(errs)
+
+	for _, e := range errs {
+		rep.fail(e.UID, e.Err)
+	}
+
+	series := make(map[string]*icsSeries)
+
+	for _, e := range events {
+		s := series[e.UID]
+		if s == nil {
+			s = &icsSeries{overrides: map[time.Time]ical.Event{}}
+			series[e.UID] = s
+		}
+
+		if e.RecurrenceID.IsZero() {
+			s.master = &e
+		} else {
+			s.overrides[e.RecurrenceID.UTC()] = e
+		}
+	}
+
+	now := time.Now().UTC()
+	from, to := now, now.Add(opts.horizon)
+
+	for _, uid := range slices.Sorted(maps.Keys(series)) {
+		js, skipped, err := a.seriesJobs(uid, series[uid], from, to, opts)
+		rep.Skipped += skipped
+
+		if err != nil {
+			rep.fail(uid, err)
+			continue
+		}
+
+		rep.Jobs += len(js)
+
+		if opts.dryRun {
+			continue
+		}
+
+		res, err := a.Scheduler.SyncExternal(ctx, uid, js, from, to)
+		if err != nil {
+			return rep, err
+		}
+
+		rep.Created += len(res.Created)
+		rep.Updated += len(res.Updated)
+		rep.Unchanged += len(res.Unchanged)
+		rep.Cancelled += len(res.Cancelled)
+	}
+
+	return rep, nil
+}
+
+// seriesJobs maps the events of one UID to jobs. Instances and single
+// events before from are skipped, as they can no longer be reminded of.
+func (a *AdminHandlers) seriesJobs(uid string, s *icsSeries, from, to time.Time, opts icsOptions) ([]*jobs.Job, int, error) {
+	var (
+		res     []*jobs.Job
+		skipped int
+	)
+
+	add := func(e ical.Event, externalID string) error {
+		if e.Start.Before(from) {
+			skipped++
+			return nil
+		}
+
+		j, err := a.eventJob(e, opts)
+		if err != nil {
+			return err
+		}
+
+		j.ExternalID = externalID
+		res = append(res, &j)
+
+		return nil
+	}
+
+	m := s.master
+	if m == nil || (m.RRule == nil && len(m.RDates) == 0) {
+		if m != nil {
+			if err := add(*m, uid); err != nil {
+				return nil, skipped, err
+			}
+		}
+
+		// Overrides without a recurring master stand on their own.
+		for _, id := range slices.SortedFunc(maps.Keys(s.overrides), time.Time.Compare) {
+			if err := add(s.overrides[id], instanceID(uid, id)); err != nil {
+				return nil, skipped, err
+			}
+		}
+
+		return res, skipped, nil
+	}
+
+	seen := make(map[time.Time]bool)
+
+	for _, t := range m.Instances(from, to, maxICSInstances) {
+		id := t.UTC()
+		seen[id] = true
+
+		e, ok := s.overrides[id]
+		if !ok {
+			e = *m
+			if !m.End.IsZero() {
+				e.End = t.Add(m.End.Sub(m.Start))
+			}
+
+			e.Start = t
+		}
+
+		if err := add(e, instanceID(uid, id)); err != nil {
+			return nil, skipped, err
+		}
+	}
+
+	// An override can move an instance from outside the horizon into it.
+	for _, id := range slices.SortedFunc(maps.Keys(s.overrides), time.Time.Compare) {
+		e := s.overrides[id]
+		if seen[id] || e.Start.After(to) {
+			continue
+		}
+
+		if err := add(e, instanceID(uid, id)); err != nil {
+			return nil, skipped, err
+		}
+	}
+
+	return res, skipped, nil
+}
+
+func instanceID(uid string, t time.Time) string {
+	return uid + "/" + t.UTC().Format(instanceLayout)
+}
+
+// eventJob maps an event to an unsaved job with the create form's rules:
+// SUMMARY is the title, DESCRIPTION the payload, "key=value" CATEGORIES
+// labels and VALARM triggers the reminder offsets, at the start by default.
+// A cancelled event yields a job with status "cancelled".
+func (a *AdminHandlers) eventJob(e ical.Event, opts icsOptions) (jobs.Job, error) {
+	title := strings.TrimSpace(e.Summary)
+	if title == "" {
+		title = "Untitled event"
+	}
+
+	labels := maps.Clone(opts.labels)
+	for _, c := range e.Categories {
+		if k, v, ok := strings.Cut(c, "="); ok {
+			labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	if err := jobs.ValidateLabels(labels); err != nil {
+		return jobs.Job{}, err
+	}
+
+	var offsets []int
+	for _, al := range e.Alarms {
+		o := int(al.Before.Round(time.Minute) / time.Minute)
+		if !slices.Contains(offsets, o) {
+			offsets = append(offsets, o)
+		}
+	}
+
+	if len(offsets) == 0 {
+		offsets = []int{0}
+	}
+
+	loc, err := time.LoadLocation(e.TZ)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	j, err := a.buildJob(createJobForm{
+		Title:               title,
+		TZ:                  e.TZ,
+		RunAt:               e.Start.In(loc).Format("2006-01-02T15:04:05"),
+		RemindBeforeMinutes: offsets,
+		Labels:              labels,
+		Payload:             e.Description,
+	})
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	if e.Cancelled {
+		j.Status = "cancelled"
+	}
+
+	return j, nil
+}
+
+// icsBody returns the calendar of a request: the "file" field of a
+// multipart form, or else the raw body.
+func icsBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxICSBytes)
+
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	return f, nil
+}
+
+// APIImportICS imports an iCalendar file posted as the body or a multipart
+// "file" field. Query parameters: tz for floating times (default UTC),
+// labels added to every job, horizon_days to expand recurring events over
+// (default 365) and dry_run.
+func (a *AdminHandlers) APIImportICS(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseICSOptions(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := icsBody(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defer body.Close()
+
+	roots, err := ical.Decode(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rep, err := a.importICS(context.WithoutCancel(r.Context()), roots, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// ImportICS is the admin form for APIImportICS. It goes back to the job
+// list when every event was imported and shows the errors otherwise.
+func (a *AdminHandlers) ImportICS(w http.ResponseWriter, r *http.Request) {
+	body, err := icsBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	defer body.Close()
+
+	var params map[string][]string = r.URL.Query()
+	if r.MultipartForm != nil {
+		params = r.MultipartForm.Value
+	}
+
+	opts, err := parseICSOptions(params)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	roots, err := ical.Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	rep, err := a.importICS(context.WithoutCancel(r.Context()), roots, opts)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if rep.Failed == 0 {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+
+	fmt.Fprintf(w, "%d events: %d created, %d updated, %d cancelled, %d failed\n\n",
+		rep.Events, rep.Created, rep.Updated, rep.Cancelled, rep.Failed)
+
+	for _, e := range rep.Errors {
+		fmt.Fprintf(w, "%s: %s\n", e.UID, e.Error)
+	}
+}
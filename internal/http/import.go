@@ -0,0 +1,430 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+const (
+	// importBatch is how many rows are inserted per transaction.
+	importBatch = 500
+	// maxImportErrors caps the per-row errors returned in a report.
+	maxImportErrors = 1000
+	// maxImportLine bounds a single NDJSON line.
+	maxImportLine = 1 << 20
+)
+
+// importColumns are the fields of an import row. Only title, tz and run_at
+// are required; remind_before and labels use the admin form's comma
+// separated syntax.
+var importColumns = []string{
+	"title", "tz", "run_at", "remind_before", "labels", "payload",
+	"tenant", "calendar", "misfire_policy", "max_delay_seconds",
+}
+
+// offsetList accepts remind_before as a number, a list of numbers or a
+// comma separated string.
+type offsetList string
+
+func (o *offsetList) UnmarshalJSON(b []byte) error {
+	var list []int
+	if err := json.Unmarshal(b, &list); err == nil {
+		parts := make([]string, len(list))
+		for i, n := range list {
+			parts[i] = strconv.Itoa(n)
+		}
+
+		*o = offsetList(strings.Join(parts, ","))
+
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err == nil {
+		*o = offsetList(n.String())
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("remind_before must be a number, a list or a string")
+	}
+
+	*o = offsetList(s)
+
+	return nil
+}
+
+// labelList accepts labels as an object or a "k=v, k2=v2" string.
+type labelList string
+
+func (l *labelList) UnmarshalJSON(b []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err == nil {
+		if err := jobs.ValidateLabels(m); err != nil {
+			return err
+		}
+
+		*l = labelList(jobs.FormatLabels(m))
+
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("labels must be an object or a string")
+	}
+
+	*l = labelList(s)
+
+	return nil
+}
+
+type importRow struct {
+	Title           string     `json:"title"`
+	TZ              string     `json:"tz"`
+	RunAt           string     `json:"run_at"`
+	RemindBefore    offsetList `json:"remind_before"`
+	Labels          labelList  `json:"labels"`
+	Payload         string     `json:"payload"`
+	Tenant          string     `json:"tenant"`
+	Calendar        string     `json:"calendar"`
+	MisfirePolicy   string     `json:"misfire_policy"`
+	MaxDelaySeconds int        `json:"max_delay_seconds"`
+}
+
+// rowReader yields import rows with the line they started on.
+type rowReader interface {
+	next() (line int, row importRow, err error)
+}
+
+// rowError is a problem with a single row; reading continues after it.
+type rowError struct{ err error }
+
+func (e rowError) Error() string { return e.err.Error() }
+
+type csvRows struct {
+	r    *csv.Reader
+	cols []string
+}
+
+func newCSVRows(r io.Reader) (*csvRows, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	cols := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !slices.Contains(importColumns, h) {
+			return nil, fmt.Errorf("unknown CSV column %q", h)
+		}
+
+		cols[i] = h
+	}
+
+	return &csvRows{r: cr, cols: cols}, nil
+}
+
+func (c *csvRows) next() (int, importRow, error) {
+	rec, err := c.r.Read()
+
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return pe.StartLine, importRow{}, rowError{err}
+	}
+
+	if err != nil {
+		return 0, importRow{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+
+	if len(rec) != len(c.cols) {
+		return line, importRow{}, rowError{fmt.Errorf("want %d fields, got %d", len(c.cols), len(rec))}
+	}
+
+	var row importRow
+
+	for i, v := range rec {
+		switch c.cols[i] {
+		case "title":
+			row.Title = v
+		case "tz":
+			row.TZ = v
+		case "run_at":
+			row.RunAt = v
+		case "remind_before":
+			row.RemindBefore = offsetList(v)
+		case "labels":
+			row.Labels = labelList(v)
+		case "payload":
+			row.Payload = v
+		case "tenant":
+			row.Tenant = v
+		case "calendar":
+			row.Calendar = v
+		case "misfire_policy":
+			row.MisfirePolicy = v
+		case "max_delay_seconds":
+			if v == "" {
+				continue
+			}
+
+			if row.MaxDelaySeconds, err = strconv.Atoi(v); err != nil {
+				return line, row, rowError{fmt.Errorf("invalid max_delay_seconds %q", v)}
+			}
+		}
+	}
+
+	return line, row, nil
+}
+
+type ndjsonRows struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONRows(r io.Reader) *ndjsonRows {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxImportLine)
+
+	return &ndjsonRows{s: s}
+}
+
+func (n *ndjsonRows) next() (int, importRow, error) {
+	for n.s.Scan() {
+		n.line++
+
+		b := bytes.TrimSpace(n.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		var row importRow
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil {
+			return n.line, row, rowError{err}
+		}
+
+		return n.line, row, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return n.line + 1, importRow{}, err
+	}
+
+	return n.line, importRow{}, io.EOF
+}
+
+// importFormat picks the row format from ?format= or the content type.
+func importFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f != "csv" && f != "ndjson" {
+			return "", fmt.Errorf("format must be csv or ndjson")
+		}
+
+		return f, nil
+	}
+
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "text/csv":
+		return "csv", nil
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return "ndjson", nil
+	}
+
+	return "", fmt.Errorf("unsupported content type %q, use text/csv or application/x-ndjson", mt)
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importReport struct {
+	Rows            int           `json:"rows"`
+	Imported        int           `json:"imported"`
+	Failed          int           `json:"failed"`
+	DryRun          bool          `json:"dry_run,omitempty"`
+	Errors          []importError `json:"errors"`
+	ErrorsTruncated bool          `json:"errors_truncated,omitempty"`
+	Error           string        `json:"error,omitempty"` // set when the import stopped early
+}
+
+func (rep *importReport) fail(line int, err error) {
+	rep.Failed++
+
+	if len(rep.Errors) >= maxImportErrors {
+		rep.ErrorsTruncated = true
+		return
+	}
+
+	rep.Errors = append(rep.Errors, importError{Line: line, Error: err.Error()})
+}
+
+// APIImportJobs streams CSV or NDJSON rows from the request body, validates
+// each with the rules of the create form and inserts the valid ones in
+// batched transactions. Jobs are armed once every row has been read. Invalid
+// rows are skipped and listed in the report; ?dry_run=true only validates.
+func (a *AdminHandlers) APIImportJobs(w http.ResponseWriter, r *http.Request) {
+	// Batches inserted before the client goes away must still be armed.
+	ctx := context.WithoutCancel(r.Context())
+
+	format, err := importFormat(r)
+	if err != nil {
+		status := http.StatusUnsupportedMediaType
+		if r.URL.Query().Has("format") {
+			status = http.StatusBadRequest
+		}
+
+		writeJSONError(w, status, err)
+		return
+	}
+
+	var rows rowReader
+	if format == "csv" {
+		if rows, err = newCSVRows(r.Body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		rows = newNDJSONRows(r.Body)
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	rep := importReport{DryRun: dryRun, Errors: []importError{}}
+
+	var (
+		batch    []*jobs.Job
+		imported []int64
+	)
+
+	flush := func() error {
+		if len(batch) == 0 || dryRun {
+			batch = batch[:0]
+			return nil
+		}
+
+		if err := a.Repo.InsertBatch(ctx, batch); err != nil {
+			return err
+		}
+
+		for _, j := range batch {
+			imported = append(imported, j.ID)
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		line, row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var re rowError
+		if err != nil && !errors.As(err, &re) {
+			rep.Error = fmt.Sprintf("line %d: %v", line, err)
+			break
+		}
+
+		rep.Rows++
+
+		if err != nil {
+			rep.fail(line, err)
+			continue
+		}
+
+		j, err := a.importJob(row)
+		if err != nil {
+			rep.fail(line, err)
+			continue
+		}
+
+		batch = append(batch, &j)
+
+		if len(batch) == importBatch {
+			if err := flush(); err != nil {
+				rep.Error = err.Error()
+				break
+			}
+		}
+	}
+
+	if rep.Error == "" {
+		if err := flush(); err != nil {
+			rep.Error = err.Error()
+		}
+	}
+
+	rep.Imported = len(imported)
+	if dryRun {
+		rep.Imported = rep.Rows - rep.Failed
+	}
+
+	if err := a.Scheduler.ArmJobs(ctx, imported); err != nil && rep.Error == "" {
+		rep.Error = "arming imported jobs: " + err.Error()
+	}
+
+	status := http.StatusOK
+	if rep.Error != "" {
+		status = http.StatusInternalServerError
+	}
+
+	writeJSON(w, status, rep)
+}
+
+func (a *AdminHandlers) importJob(row importRow) (jobs.Job, error) {
+	remind := string(row.RemindBefore)
+	if strings.TrimSpace(remind) == "" {
+		remind = "0"
+	}
+
+	offsets, err := jobs.ParseOffsets(remind)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	labels, err := jobs.ParseLabels(string(row.Labels))
+	if err != nil {
+		return jobs.Job{}, err
+	}
+
+	return a.buildJob(createJobForm{
+		Title:               row.Title,
+		TZ:                  row.TZ,
+		RunAt:               row.RunAt,
+		RemindBeforeMinutes: offsets,
+		MisfirePolicy:       row.MisfirePolicy,
+		Tenant:              row.Tenant,
+		MaxDelaySeconds:     row.MaxDelaySeconds,
+		Calendar:            row.Calendar,
+		Labels:              labels,
+		Payload:             row.Payload,
+	})
+}
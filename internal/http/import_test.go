@@ -0,0 +1,173 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+func postImport(t *testing.T, srv *httptest.Server, query, contentType, body string) (int, importReport) {
+	t.Helper()
+
+	res, err := http.Post(srv.URL+"/api/jobs/import"+query, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	var rep importReport
+	if err := json.NewDecoder(res.Body).Decode(&rep); err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, rep
+}
+
+func listAll(t *testing.T, s jobs.Store) *jobs.CursorPage {
+	t.Helper()
+
+	page, err := s.ListJobs(context.Background(), jobs.JobFilter{Status: "all", Count: true, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return page
+}
+
+// TestAPIImportCSV imports a CSV whose header has its own order, case and
+// spacing: the good rows are imported, and armed if they are due inside the
+// scheduler's window, while each bad row is reported by line.
+func TestAPIImportCSV(t *testing.T) {
+	admin := newTestHandlers(t)
+	if err := admin.Scheduler.Warmup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewServer(admin).R)
+	defer srv.Close()
+
+	soon := time.Now().UTC().Add(30 * time.Minute).Format("2006-01-02T15:04:05")
+	later := time.Now().UTC().Add(48 * time.Hour).Format("2006-01-02T15:04:05")
+
+	body := "\ufeffRun_At, Title ,tz,REMIND_BEFORE,labels,max_delay_seconds\n" +
+		soon + ",standup,UTC,\"10,0\",team=ops,30\n" +
+		later + ",x,UTC,0,,\n" + // title too short
+		later + ",review,Nowhere/Zone,0,,\n" +
+		later + ",too few\n" +
+		later + ",retro,UTC,5,,abc\n" +
+		later + ",retro,Europe/Istanbul,,\"team=dev, kind=meeting\",\n"
+
+	status, rep := postImport(t, srv, "", "text/csv", body)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %+v", status, rep)
+	}
+
+	if rep.Rows != 6 || rep.Imported != 2 || rep.Failed != 4 {
+		t.Errorf("report = %d rows, %d imported, %d failed, want 6, 2, 4", rep.Rows, rep.Imported, rep.Failed)
+	}
+
+	var lines []int
+	for _, e := range rep.Errors {
+		lines = append(lines, e.Line)
+	}
+
+	if want := []int{3, 4, 5, 6}; !slices.Equal(lines, want) {
+		t.Errorf("errors on lines %v, want %v: %+v", lines, want, rep.Errors)
+	}
+
+	page := listAll(t, admin.Repo)
+	if page.Total != 2 {
+		t.Fatalf("%d jobs stored, want 2", page.Total)
+	}
+
+	byTitle := make(map[string]jobs.Job)
+	for _, j := range page.Jobs {
+		byTitle[j.Title] = j
+	}
+
+	standup, retro := byTitle["standup"], byTitle["retro"]
+
+	if standup.TZ != "UTC" || standup.MaxDelaySeconds != 30 || !maps.Equal(standup.Labels, map[string]string{"team": "ops"}) {
+		t.Errorf("standup = %+v", standup)
+	}
+
+	if retro.TZ != "Europe/Istanbul" || !maps.Equal(retro.Labels, map[string]string{"team": "dev", "kind": "meeting"}) {
+		t.Errorf("retro = %+v", retro)
+	}
+
+	rems, err := admin.Repo.RemindersFor(context.Background(), []int64{standup.ID, retro.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rems[standup.ID]) != 2 || len(rems[retro.ID]) != 1 || rems[retro.ID][0].OffsetMinutes != 0 {
+		t.Errorf("reminders = %+v", rems)
+	}
+
+	// Only the job due inside the window is armed, both of its reminders.
+	if n := len(admin.Scheduler.Timers(standup.ID)); n != 2 {
+		t.Errorf("%d timers armed for the job due soon, want 2", n)
+	}
+
+	if n := len(admin.Scheduler.Timers(retro.ID)); n != 0 {
+		t.Errorf("%d timers armed for the job due in two days, want 0", n)
+	}
+
+	if status, rep := postImport(t, srv, "", "text/csv", "title,tz,when\n"); status != http.StatusBadRequest {
+		t.Errorf("unknown column: status %d, %+v", status, rep)
+	}
+}
+
+// TestAPIImportBatches imports more rows than fit in two batches, with a
+// bad row at the end of the first one.
+func TestAPIImportBatches(t *testing.T) {
+	srv, repo := newTestServer(t)
+
+	run := time.Now().UTC().Add(48 * time.Hour).Format(time.RFC3339)
+
+	var body strings.Builder
+	for line := 1; line <= 2*importBatch+1; line++ {
+		title := fmt.Sprintf("job %d", line)
+		if line == importBatch {
+			title = "x"
+		}
+
+		fmt.Fprintf(&body, `{"title": %q, "tz": "UTC", "run_at": %q, "remind_before": [5, 0]}`+"\n", title, run)
+	}
+
+	status, rep := postImport(t, srv, "?dry_run=true", "application/x-ndjson", body.String())
+	if status != http.StatusOK || !rep.DryRun || rep.Imported != 2*importBatch || rep.Failed != 1 {
+		t.Fatalf("dry run: status %d, %+v", status, rep)
+	}
+
+	if n := listAll(t, repo).Total; n != 0 {
+		t.Fatalf("dry run stored %d jobs", n)
+	}
+
+	status, rep = postImport(t, srv, "", "application/x-ndjson", body.String())
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %+v", status, rep)
+	}
+
+	if rep.Rows != 2*importBatch+1 || rep.Imported != 2*importBatch || rep.Failed != 1 {
+		t.Errorf("report = %d rows, %d imported, %d failed", rep.Rows, rep.Imported, rep.Failed)
+	}
+
+	if len(rep.Errors) != 1 || rep.Errors[0].Line != importBatch {
+		t.Errorf("errors = %+v, want one on line %d", rep.Errors, importBatch)
+	}
+
+	if n := listAll(t, repo).Total; n != 2*importBatch {
+		t.Errorf("%d jobs stored, want %d", n, 2*importBatch)
+	}
+}
@@ -0,0 +1,344 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/yplog/ticktockbox/internal/jobs"
+)
+
+// loadJob returns the job of the {id} URL parameter with its reminders and
+// labels, or writes the error and returns false.
+func (a *AdminHandlers) loadJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return jobs.Job{}, false
+	}
+
+	j, err := a.Repo.Get(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return jobs.Job{}, false
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return jobs.Job{}, false
+	}
+
+	reminders, err := a.Repo.RemindersFor(ctx, []int64{id})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return jobs.Job{}, false
+	}
+
+	labels, err := a.Repo.LabelsFor(ctx, []int64{id})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return jobs.Job{}, false
+	}
+
+	j.Reminders = reminders[id]
+	j.Labels = labels[id]
+
+	return j, true
+}
+
+// ShowJob renders a job with its reminders, their timers and delivery
+// attempts, the messages published for it, and its history.
+func (a *AdminHandlers) ShowJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := a.Repo.Events(r.Context(), j.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	type message struct {
+		jobs.Event
+		Body string
+	}
+
+	var messages []message
+
+	attempts := make(map[int64]int)
+	for _, e := range events {
+		switch e.Kind {
+		case jobs.EventEnqueued:
+			attempts[e.ReminderID]++
+
+			body := e.Details
+			var buf bytes.Buffer
+			if json.Indent(&buf, []byte(e.Details), "", "  ") == nil {
+				body = buf.String()
+			}
+
+			messages = append(messages, message{Event: e, Body: body})
+		case jobs.EventRetried:
+			// A failed publish, which the scheduler tries again.
+			attempts[e.ReminderID]++
+		}
+	}
+
+	type reminderRow struct {
+		jobs.Reminder
+		Attempts int
+		Timer    *jobs.TimerState
+		// Later is set for pending reminders due after the loaded window,
+		// which are armed once the window reaches them.
+		Later bool
+	}
+
+	timers := a.Scheduler.Timers(j.ID)
+	loadedUntil := a.Scheduler.LoadedUntil()
+
+	rows := make([]reminderRow, len(j.Reminders))
+	for i, rem := range j.Reminders {
+		rows[i] = reminderRow{Reminder: rem, Attempts: attempts[rem.ID]}
+
+		if t, ok := timers[rem.ID]; ok {
+			rows[i].Timer = &t
+		} else if rem.Status == "pending" {
+			rows[i].Later = rem.DueAtUTC.After(loadedUntil)
+		}
+	}
+
+	loc, _ := time.LoadLocation(j.TZ)
+
+	adjusted := ""
+	if j.Calendar != "" && j.Status == "pending" {
+		at, skip := a.Scheduler.Adjust(j, j.DueAtUTC)
+		switch {
+		case skip:
+			adjusted = "skipped"
+		case !at.Equal(j.DueAtUTC):
+			adjusted = at.In(loc).Format("2006-01-02 15:04:05")
+		}
+	}
+
+	data := map[string]any{
+		"Job":        j,
+		"Labels":     jobs.FormatLabels(j.Labels),
+		"AdjustedAt": adjusted,
+		"Reminders":  rows,
+		"Messages":   messages,
+		"Events":     events,
+		"Path":       r.URL.Path,
+	}
+
+	tmpl := template.New("job").Funcs(template.FuncMap{
+		"local":   func(t time.Time) string { return t.In(loc).Format("2006-01-02 15:04:05") },
+		"rfc3339": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+		"until":   humanizeUntil,
+	})
+
+	tmpl = template.Must(tmpl.ParseFS(a.TemplatesFS, "layout.tmpl", "job.tmpl"))
+	_ = tmpl.ExecuteTemplate(w, "job", data)
+}
+
+// jobForm fills new.tmpl, which creates, edits and duplicates jobs.
+type jobForm struct {
+	Heading string
+	Action  string
+	Submit  string
+
+	Title           string
+	TZ              string
+	RunAt           string
+	Offsets         string
+	Tenant          string
+	Labels          string
+	Payload         string
+	MaxDelaySeconds int
+	Calendar        string
+	MisfirePolicy   string
+
+	// Import shows the calendar import form, when creating a job.
+	Import bool
+}
+
+type formZone struct {
+	Name  string
+	Label string
+}
+
+// formZones are the time zones offered by the job form.
+var formZones = []formZone{
+	{"Europe/Istanbul", "Europe/Istanbul (Turkey)"},
+	{"UTC", "UTC"},
+	{"America/New_York", "America/New_York (Eastern Time)"},
+	{"America/Chicago", "America/Chicago (Central Time)"},
+	{"America/Denver", "America/Denver (Mountain Time)"},
+	{"America/Los_Angeles", "America/Los_Angeles (Pacific Time)"},
+	{"America/Toronto", "America/Toronto"},
+	{"America/Sao_Paulo", "America/Sao_Paulo"},
+	{"Europe/London", "Europe/London"},
+	{"Europe/Paris", "Europe/Paris"},
+	{"Europe/Berlin", "Europe/Berlin"},
+	{"Europe/Rome", "Europe/Rome"},
+	{"Europe/Moscow", "Europe/Moscow"},
+	{"Asia/Tokyo", "Asia/Tokyo"},
+	{"Asia/Shanghai", "Asia/Shanghai"},
+	{"Asia/Seoul", "Asia/Seoul"},
+	{"Asia/Kolkata", "Asia/Kolkata"},
+	{"Asia/Dubai", "Asia/Dubai"},
+	{"Australia/Sydney", "Australia/Sydney"},
+	{"Pacific/Auckland", "Pacific/Auckland"},
+}
+
+func (a *AdminHandlers) renderJobForm(w http.ResponseWriter, f jobForm) {
+	zones := formZones
+	if !slices.ContainsFunc(zones, func(z formZone) bool { return z.Name == f.TZ }) {
+		zones = append(slices.Clip(zones), formZone{f.TZ, f.TZ})
+	}
+
+	data := map[string]any{
+		"Form":      f,
+		"Zones":     zones,
+		"Calendars": a.Scheduler.Calendars.List(),
+	}
+
+	tmpl := template.Must(template.ParseFS(a.TemplatesFS, "layout.tmpl", "new.tmpl"))
+	_ = tmpl.ExecuteTemplate(w, "new", data)
+}
+
+// jobFormFor fills the job form from j, with the offsets of its own
+// reminders in any of the given statuses.
+func jobFormFor(j jobs.Job, statuses ...string) jobForm {
+	offsets := j.Offsets(statuses...)
+	if len(offsets) == 0 {
+		offsets = []int{j.RemindBeforeMinutes}
+	}
+
+	parts := make([]string, len(offsets))
+	for i, o := range offsets {
+		parts[i] = strconv.Itoa(o)
+	}
+
+	loc, _ := time.LoadLocation(j.TZ)
+
+	return jobForm{
+		Title:           j.Title,
+		TZ:              j.TZ,
+		RunAt:           j.RunAtUTC.In(loc).Format("2006-01-02T15:04:05"),
+		Offsets:         strings.Join(parts, ", "),
+		Tenant:          j.Tenant,
+		Labels:          jobs.FormatLabels(j.Labels),
+		Payload:         j.Payload,
+		MaxDelaySeconds: j.MaxDelaySeconds,
+		Calendar:        j.Calendar,
+		MisfirePolicy:   string(j.MisfirePolicy),
+	}
+}
+
+func editStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, jobs.ErrNotEditable), errors.Is(err, jobs.ErrNotFireable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// EditForm shows the job form for a pending job.
+func (a *AdminHandlers) EditForm(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	if j.Status != "pending" {
+		http.Error(w, jobs.ErrNotEditable.Error(), http.StatusConflict)
+		return
+	}
+
+	f := jobFormFor(j, "pending", "enqueued")
+	f.Heading = "Edit Job #" + strconv.FormatInt(j.ID, 10)
+	f.Action = "/jobs/" + strconv.FormatInt(j.ID, 10) + "/edit"
+	f.Submit = "Save"
+
+	a.renderJobForm(w, f)
+}
+
+// EditJob saves the job form over a pending job and re-arms it.
+func (a *AdminHandlers) EditJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	j, err := a.parseJobForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	j.ID = id
+
+	if err := a.Scheduler.UpdateJob(context.WithoutCancel(r.Context()), &j); err != nil {
+		http.Error(w, err.Error(), editStatus(err))
+		return
+	}
+
+	http.Redirect(w, r, "/jobs/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
+
+// DuplicateForm shows the job form filled from an existing job, in any
+// status, to create a new one.
+func (a *AdminHandlers) DuplicateForm(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	f := jobFormFor(j, "pending", "enqueued", "missed", "skipped", "cancelled")
+	f.Heading = "Duplicate Job #" + strconv.FormatInt(j.ID, 10)
+	f.Action = "/jobs"
+	f.Submit = "Create"
+
+	a.renderJobForm(w, f)
+}
+
+// FireJob delivers the next pending reminder of a job now.
+func (a *AdminHandlers) FireJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := a.Repo.Get(ctx, id); err != nil {
+		http.Error(w, err.Error(), editStatus(err))
+		return
+	}
+
+	if _, err := a.Scheduler.FireNow(ctx, id); err != nil {
+		http.Error(w, err.Error(), editStatus(err))
+		return
+	}
+
+	http.Redirect(w, r, "/jobs/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
@@ -15,14 +15,50 @@ type Server struct {
 func NewServer(admin *AdminHandlers) *Server {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(actor("admin"))
 	r.Get("/", admin.Index)
 	r.Get("/new", admin.NewForm)
 	r.Post("/jobs", admin.CreateJob)
+	r.Post("/jobs/bulk", admin.BulkJobs)
+	r.Post("/jobs/import/ics", admin.ImportICS)
+	r.Get("/jobs/{id}", admin.ShowJob)
+	r.Get("/jobs/{id}/edit", admin.EditForm)
+	r.Post("/jobs/{id}/edit", admin.EditJob)
+	r.Get("/jobs/{id}/duplicate", admin.DuplicateForm)
+	r.Post("/jobs/{id}/fire", admin.FireJob)
 	r.Post("/jobs/{id}/cancel", admin.CancelJob)
+	r.Post("/jobs/{id}/snooze", admin.SnoozeJob)
+	r.Get("/feeds", admin.Feeds)
+	r.Post("/feeds", admin.CreateFeed)
+	r.Post("/feeds/{token}/delete", admin.DeleteFeed)
 
-	// Maintenance: reschedule all pending jobs (past 24h)
+	// Calendar feeds are read by calendar apps; the token is the credential.
+	r.Get("/feeds/{token}.ics", admin.FeedICS)
+
+	// Maintenance: re-arm all pending jobs in the loaded window
 	r.Post("/maintenance/reschedule", admin.ReschedulePending)
 
+	r.Route("/api", func(r chi.Router) {
+		r.Use(actor("api"))
+
+		r.Get("/jobs", admin.APIListJobs)
+		r.Post("/jobs/bulk", admin.APIBulkJobs)
+		r.Get("/jobs/export", admin.APIExportJobs)
+		r.Post("/jobs/import", admin.APIImportJobs)
+		r.Post("/jobs/import/ics", admin.APIImportICS)
+		r.Post("/jobs/{id}/snooze", admin.APISnoozeJob)
+		r.Get("/jobs/{id}/events", admin.APIJobEvents)
+		r.Post("/jobs/{id}/ack", admin.APIAckJob)
+
+		r.Get("/feeds", admin.APIListFeeds)
+		r.Post("/feeds", admin.APICreateFeed)
+		r.Delete("/feeds/{token}", admin.APIDeleteFeed)
+
+		r.Get("/calendars", admin.APIListCalendars)
+		r.Put("/calendars/{name}", admin.APIPutCalendar)
+		r.Delete("/calendars/{name}", admin.APIDeleteCalendar)
+	})
+
 	staticFS, err := fs.Sub(admin.Assets, ".")
 	if err != nil {
 		panic(err)
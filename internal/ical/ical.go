@@ -0,0 +1,312 @@
+// Package ical reads and writes iCalendar (RFC 5545) calendars of timed
+// events.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	localLayout = "20060102T150405"
+	utcLayout   = "20060102T150405Z"
+
+	// maxLine is the longest content line in octets, without the CRLF.
+	maxLine = 75
+	// maxObservances bounds the time zone periods written per zone.
+	maxObservances = 400
+)
+
+// Calendar is a VCALENDAR of events.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is a VEVENT starting at Start, written as local time in TZ. An
+// empty or unknown TZ writes Start in UTC.
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Start       time.Time
+	TZ          string
+	Summary     string
+	Description string
+	Categories  []string
+	Cancelled   bool
+	Alarms      []Alarm
+
+	// The fields below are only read by Events; WriteTo ignores them.
+	End    time.Time // zero without DTEND or DURATION
+	AllDay bool      // Start is midnight of a DATE in the default zone
+
+	// A recurring event has an RRule and/or RDates; RecurrenceID marks an
+	// event that overrides the instance of its UID's series at that time.
+	RRule        *RRule
+	RDates       []time.Time
+	ExDates      []time.Time
+	RecurrenceID time.Time
+}
+
+// Alarm is a VALARM that goes off Before the start of its event.
+type Alarm struct {
+	Before      time.Duration
+	Description string
+}
+
+// WriteTo writes the calendar with a VTIMEZONE for every zone its events
+// use, covering the span of their start times.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &contentWriter{w: bufio.NewWriter(w)}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:" + c.ProdID)
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+
+	zones := make(map[string]*zoneSpan)
+	for _, e := range c.Events {
+		loc := location(e.TZ)
+		if loc == time.UTC {
+			continue
+		}
+
+		if z, ok := zones[e.TZ]; ok {
+			z.from, z.to = minTime(z.from, e.Start), maxTime(z.to, e.Start)
+		} else {
+			zones[e.TZ] = &zoneSpan{loc: loc, from: e.Start, to: e.Start}
+		}
+	}
+
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		cw.timezone(name, zones[name])
+	}
+
+	for _, e := range c.Events {
+		cw.event(e)
+	}
+
+	cw.line("END:VCALENDAR")
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+type zoneSpan struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// location loads tz, falling back to UTC.
+func location(tz string) *time.Location {
+	if tz == "" || tz == "UTC" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+
+	return a
+}
+
+type contentWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes a content line folded at maxLine octets, never inside a
+// UTF-8 sequence.
+func (cw *contentWriter) line(s string) {
+	for first := true; cw.err == nil; first = false {
+		limit := maxLine
+		if !first {
+			limit-- // the leading space of a continuation line
+			cw.write(" ")
+		}
+
+		if len(s) <= limit {
+			cw.write(s + "\r\n")
+			return
+		}
+
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+
+		cw.write(s[:cut] + "\r\n")
+		s = s[cut:]
+	}
+}
+
+func (cw *contentWriter) write(s string) {
+	if cw.err != nil {
+		return
+	}
+
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// timezone writes a VTIMEZONE with one observance per zone period that
+// overlaps the span, taken from the Go time zone database.
+func (cw *contentWriter) timezone(name string, z *zoneSpan) {
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + name)
+
+	t := z.from.In(z.loc)
+
+	for i := 0; i < maxObservances; i++ {
+		start, end := t.ZoneBounds()
+		abbr, offset := t.Zone()
+
+		from := offset
+		onset := "19700101T000000"
+		if !start.IsZero() {
+			_, from = start.Add(-time.Second).Zone()
+			onset = start.In(time.FixedZone("", from)).Format(localLayout)
+		}
+
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+
+		cw.line("BEGIN:" + kind)
+		cw.line("DTSTART:" + onset)
+		cw.line("TZOFFSETFROM:" + formatOffset(from))
+		cw.line("TZOFFSETTO:" + formatOffset(offset))
+		cw.line("TZNAME:" + escapeText(abbr))
+		cw.line("END:" + kind)
+
+		if end.IsZero() || end.After(z.to) {
+			break
+		}
+
+		t = end
+	}
+
+	cw.line("END:VTIMEZONE")
+}
+
+func (cw *contentWriter) event(e Event) {
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + e.UID)
+	cw.line("DTSTAMP:" + e.Stamp.UTC().Format(utcLayout))
+
+	if loc := location(e.TZ); loc == time.UTC {
+		cw.line("DTSTART:" + e.Start.UTC().Format(utcLayout))
+	} else {
+		cw.line("DTSTART;TZID=" + e.TZ + ":" + e.Start.In(loc).Format(localLayout))
+	}
+
+	cw.line("SUMMARY:" + escapeText(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION:" + escapeText(e.Description))
+	}
+
+	if len(e.Categories) > 0 {
+		cats := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			cats[i] = escapeText(c)
+		}
+
+		cw.line("CATEGORIES:" + strings.Join(cats, ","))
+	}
+
+	if e.Cancelled {
+		cw.line("STATUS:CANCELLED")
+	} else {
+		cw.line("STATUS:CONFIRMED")
+	}
+
+	for _, a := range e.Alarms {
+		cw.line("BEGIN:VALARM")
+		cw.line("ACTION:DISPLAY")
+		cw.line("TRIGGER:" + formatTrigger(a.Before))
+		cw.line("DESCRIPTION:" + escapeText(a.Description))
+		cw.line("END:VALARM")
+	}
+
+	cw.line("END:VEVENT")
+}
+
+// escapeText escapes a TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// formatOffset renders a UTC offset in seconds as +HHMM.
+func formatOffset(secs int) string {
+	sign := "+"
+	if secs < 0 {
+		sign, secs = "-", -secs
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, secs/3600, secs/60%60)
+}
+
+// formatTrigger renders a relative alarm trigger, e.g. -PT90M.
+func formatTrigger(before time.Duration) string {
+	if before == 0 {
+		return "PT0S"
+	}
+
+	sign := "-"
+	if before < 0 {
+		sign, before = "", -before
+	}
+
+	if before%time.Minute == 0 {
+		return fmt.Sprintf("%sPT%dM", sign, before/time.Minute)
+	}
+
+	return fmt.Sprintf("%sPT%dS", sign, before/time.Second)
+}
@@ -0,0 +1,587 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxParseLine bounds an unfolded content line.
+const maxParseLine = 1 << 20
+
+// Property is a content line: NAME;PARAM=value:value.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a BEGIN/END block with its properties and subcomponents.
+type Component struct {
+	Name       string
+	Props      []Property
+	Components []*Component
+}
+
+// Prop returns the first property with the given name.
+func (c *Component) Prop(name string) (Property, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return Property{}, false
+}
+
+// Decode reads the components of an iCalendar stream, usually a single
+// VCALENDAR.
+func Decode(r io.Reader) ([]*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		roots []*Component
+		stack []*Component
+	)
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			c := &Component{Name: strings.ToUpper(p.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				roots = append(roots, c)
+			}
+
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.Value)
+			}
+
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside a component", i+1, p.Name)
+			}
+
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unterminated %s", stack[len(stack)-1].Name)
+	}
+
+	return roots, nil
+}
+
+// unfold joins continuation lines, which start with a space or a tab.
+func unfold(r io.Reader) ([]string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxParseLine)
+
+	var lines []string
+
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+
+		if len(lines) > 0 && line != "" && (line[0] == ' ' || line[0] == '\t') {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) > 0 {
+		lines[0] = strings.TrimPrefix(lines[0], "\ufeff")
+	}
+
+	return lines, s.Err()
+}
+
+func parseProperty(line string) (Property, error) {
+	p := Property{Params: map[string]string{}}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, fmt.Errorf("invalid content line %q", truncate(line))
+	}
+
+	p.Name = strings.ToUpper(line[:i])
+
+	for i < len(line) && line[i] == ';' {
+		eq := strings.IndexByte(line[i:], '=')
+		if eq <= 1 {
+			return p, fmt.Errorf("invalid parameter in %s", p.Name)
+		}
+
+		name := strings.ToUpper(line[i+1 : i+eq])
+		i += eq + 1
+
+		// A value is a comma separated list of plain or quoted strings.
+		var values []string
+
+		for {
+			if i < len(line) && line[i] == '"' {
+				end := strings.IndexByte(line[i+1:], '"')
+				if end < 0 {
+					return p, fmt.Errorf("unterminated quoted parameter in %s", p.Name)
+				}
+
+				values = append(values, line[i+1:i+1+end])
+				i += end + 2
+			} else {
+				end := strings.IndexAny(line[i:], ",;:")
+				if end < 0 {
+					return p, fmt.Errorf("missing value in %s", p.Name)
+				}
+
+				values = append(values, line[i:i+end])
+				i += end
+			}
+
+			if i >= len(line) || line[i] != ',' {
+				break
+			}
+
+			i++
+		}
+
+		p.Params[name] = strings.Join(values, ",")
+	}
+
+	if i >= len(line) || line[i] != ':' {
+		return p, fmt.Errorf("missing value in %s", p.Name)
+	}
+
+	p.Value = line[i+1:]
+
+	return p, nil
+}
+
+func truncate(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "…"
+	}
+
+	return s
+}
+
+// unescapeText reverses escapeText.
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// splitText splits a multi-valued TEXT property on unescaped commas.
+func splitText(s string) []string {
+	var (
+		res  []string
+		part strings.Builder
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			part.WriteByte(s[i])
+			part.WriteByte(s[i+1])
+			i++
+		case s[i] == ',':
+			res = append(res, unescapeText(part.String()))
+			part.Reset()
+		default:
+			part.WriteByte(s[i])
+		}
+	}
+
+	return append(res, unescapeText(part.String()))
+}
+
+// Zones resolves TZID parameters to locations.
+type Zones struct {
+	// Default is used for floating times and all-day dates.
+	Default *time.Location
+
+	defs map[string]string // TZID -> IANA name from a VTIMEZONE
+}
+
+// windowsZones maps the Windows zone names Outlook writes as TZIDs to IANA
+// names.
+var windowsZones = map[string]string{
+	"UTC":                            "UTC",
+	"GMT Standard Time":              "Europe/London",
+	"W. Europe Standard Time":        "Europe/Berlin",
+	"Romance Standard Time":          "Europe/Paris",
+	"Central Europe Standard Time":   "Europe/Budapest",
+	"Central European Standard Time": "Europe/Warsaw",
+	"E. Europe Standard Time":        "Europe/Chisinau",
+	"FLE Standard Time":              "Europe/Kiev",
+	"GTB Standard Time":              "Europe/Bucharest",
+	"Turkey Standard Time":           "Europe/Istanbul",
+	"Russian Standard Time":          "Europe/Moscow",
+	"Eastern Standard Time":          "America/New_York",
+	"Central Standard Time":          "America/Chicago",
+	"Mountain Standard Time":         "America/Denver",
+	"Pacific Standard Time":          "America/Los_Angeles",
+	"E. South America Standard Time": "America/Sao_Paulo",
+	"India Standard Time":            "Asia/Kolkata",
+	"China Standard Time":            "Asia/Shanghai",
+	"Tokyo Standard Time":            "Asia/Tokyo",
+	"Korea Standard Time":            "Asia/Seoul",
+	"Arabian Standard Time":          "Asia/Dubai",
+	"AUS Eastern Standard Time":      "Australia/Sydney",
+	"New Zealand Standard Time":      "Pacific/Auckland",
+}
+
+// Location resolves a TZID: an IANA name, possibly behind a vendor prefix
+// such as "/mozilla.org/20050126_1/", a VTIMEZONE naming one with
+// X-LIC-LOCATION, or a common Windows zone name.
+func (z *Zones) Location(tzid string) (string, *time.Location, error) {
+	candidates := []string{tzid, z.defs[tzid], windowsZones[tzid]}
+
+	parts := strings.Split(strings.Trim(tzid, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		candidates = append(candidates, strings.Join(parts[i:], "/"))
+	}
+
+	for _, name := range candidates {
+		if name == "" || name == "Local" {
+			continue
+		}
+
+		if loc, err := time.LoadLocation(name); err == nil {
+			return name, loc, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("unknown time zone %q", tzid)
+}
+
+// dateTime parses a DATE or DATE-TIME property, returning the time, the
+// IANA name of its zone and whether it is an all-day date.
+func (z *Zones) dateTime(p Property) (time.Time, string, bool, error) {
+	return z.parseTime(p.Value, p.Params["TZID"], p.Params["VALUE"] == "DATE")
+}
+
+func (z *Zones) parseTime(v, tzid string, date bool) (time.Time, string, bool, error) {
+	if date || len(v) == len("20060102") {
+		loc := z.Default
+		t, err := time.ParseInLocation("20060102", v, loc)
+
+		return t, zoneName(loc), true, err
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse(utcLayout, v)
+		return t, "UTC", false, err
+	}
+
+	name, loc := zoneName(z.Default), z.Default
+	if tzid != "" {
+		var err error
+		if name, loc, err = z.Location(tzid); err != nil {
+			return time.Time{}, "", false, err
+		}
+	}
+
+	t, err := time.ParseInLocation(localLayout, v, loc)
+
+	return t, name, false, err
+}
+
+func zoneName(loc *time.Location) string {
+	return loc.String()
+}
+
+// multiTime parses a comma separated RDATE or EXDATE value.
+func (z *Zones) multiTime(p Property) ([]time.Time, error) {
+	if p.Params["VALUE"] == "PERIOD" {
+		return nil, errors.New("RDATE periods are not supported")
+	}
+
+	var res []time.Time
+
+	for _, v := range strings.Split(p.Value, ",") {
+		t, _, _, err := z.parseTime(strings.TrimSpace(v), p.Params["TZID"], p.Params["VALUE"] == "DATE")
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+var durationRe = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses an RFC 5545 duration such as -PT15M or P1DT2H.
+func ParseDuration(s string) (time.Duration, error) {
+	m := durationRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+	var d time.Duration
+
+	for i, u := range units {
+		if m[i+2] == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		d += time.Duration(n) * u
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// Events returns the VEVENTs of the decoded components. Times are resolved
+// with the calendar's VTIMEZONEs, then its X-WR-TIMEZONE or def for
+// floating times. Events that cannot be read are returned as errors keyed
+// by UID (or their position when they have none), without stopping.
+func Events(roots []*Component, def *time.Location) ([]Event, []EventError) {
+	var (
+		events []Event
+		errs   []EventError
+	)
+
+	for _, cal := range roots {
+		z := &Zones{Default: def, defs: map[string]string{}}
+
+		if p, ok := cal.Prop("X-WR-TIMEZONE"); ok {
+			if _, loc, err := z.Location(p.Value); err == nil {
+				z.Default = loc
+			}
+		}
+
+		for _, c := range cal.Components {
+			if c.Name != "VTIMEZONE" {
+				continue
+			}
+
+			id, _ := c.Prop("TZID")
+			if loc, ok := c.Prop("X-LIC-LOCATION"); ok {
+				z.defs[id.Value] = loc.Value
+			}
+		}
+
+		n := 0
+
+		for _, c := range cal.Components {
+			if c.Name != "VEVENT" {
+				continue
+			}
+
+			n++
+
+			e, err := z.event(c)
+			if err != nil {
+				uid := e.UID
+				if uid == "" {
+					uid = fmt.Sprintf("#%d", n)
+				}
+
+				errs = append(errs, EventError{UID: uid, Err: err})
+
+				continue
+			}
+
+			events = append(events, e)
+		}
+	}
+
+	return events, errs
+}
+
+// EventError is an event that could not be read.
+type EventError struct {
+	UID string
+	Err error
+}
+
+func (e EventError) Error() string { return e.UID + ": " + e.Err.Error() }
+
+func (z *Zones) event(c *Component) (Event, error) {
+	var e Event
+
+	if p, ok := c.Prop("UID"); ok {
+		e.UID = p.Value
+	}
+
+	if e.UID == "" {
+		return e, errors.New("missing UID")
+	}
+
+	start, ok := c.Prop("DTSTART")
+	if !ok {
+		return e, errors.New("missing DTSTART")
+	}
+
+	var err error
+	if e.Start, e.TZ, e.AllDay, err = z.dateTime(start); err != nil {
+		return e, fmt.Errorf("DTSTART: %w", err)
+	}
+
+	if p, ok := c.Prop("DTEND"); ok {
+		if e.End, _, _, err = z.dateTime(p); err != nil {
+			return e, fmt.Errorf("DTEND: %w", err)
+		}
+	} else if p, ok := c.Prop("DURATION"); ok {
+		d, err := ParseDuration(p.Value)
+		if err != nil {
+			return e, err
+		}
+
+		e.End = e.Start.Add(d)
+	}
+
+	if p, ok := c.Prop("RECURRENCE-ID"); ok {
+		if e.RecurrenceID, _, _, err = z.dateTime(p); err != nil {
+			return e, fmt.Errorf("RECURRENCE-ID: %w", err)
+		}
+	}
+
+	for _, p := range c.Props {
+		switch p.Name {
+		case "SUMMARY":
+			e.Summary = unescapeText(p.Value)
+		case "DESCRIPTION":
+			e.Description = unescapeText(p.Value)
+		case "CATEGORIES":
+			e.Categories = append(e.Categories, splitText(p.Value)...)
+		case "STATUS":
+			e.Cancelled = strings.EqualFold(p.Value, "CANCELLED")
+		case "RRULE":
+			if e.RRule, err = ParseRRule(p.Value, z.Default); err != nil {
+				return e, err
+			}
+		case "RDATE":
+			ts, err := z.multiTime(p)
+			if err != nil {
+				return e, fmt.Errorf("RDATE: %w", err)
+			}
+
+			e.RDates = append(e.RDates, ts...)
+		case "EXDATE":
+			ts, err := z.multiTime(p)
+			if err != nil {
+				return e, fmt.Errorf("EXDATE: %w", err)
+			}
+
+			e.ExDates = append(e.ExDates, ts...)
+		}
+	}
+
+	for _, a := range c.Components {
+		if a.Name != "VALARM" {
+			continue
+		}
+
+		alarm, ok, err := z.alarm(a, e)
+		if err != nil {
+			return e, err
+		}
+
+		if ok {
+			e.Alarms = append(e.Alarms, alarm)
+		}
+	}
+
+	return e, nil
+}
+
+// alarm reads a VALARM as an offset before the event's start; alarms that
+// go off after the start are dropped.
+func (z *Zones) alarm(c *Component, e Event) (Alarm, bool, error) {
+	p, ok := c.Prop("TRIGGER")
+	if !ok {
+		return Alarm{}, false, errors.New("VALARM without TRIGGER")
+	}
+
+	var at time.Time
+
+	if p.Params["VALUE"] == "DATE-TIME" {
+		t, _, _, err := z.parseTime(p.Value, "", false)
+		if err != nil {
+			return Alarm{}, false, fmt.Errorf("TRIGGER: %w", err)
+		}
+
+		at = t
+	} else {
+		d, err := ParseDuration(p.Value)
+		if err != nil {
+			return Alarm{}, false, fmt.Errorf("TRIGGER: %w", err)
+		}
+
+		at = e.Start.Add(d)
+		if p.Params["RELATED"] == "END" && !e.End.IsZero() {
+			at = e.End.Add(d)
+		}
+	}
+
+	before := e.Start.Sub(at)
+	if before < 0 {
+		return Alarm{}, false, nil
+	}
+
+	a := Alarm{Before: before}
+	if d, ok := c.Prop("DESCRIPTION"); ok {
+		a.Description = unescapeText(d.Value)
+	}
+
+	return a, true, nil
+}
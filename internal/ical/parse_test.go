@@ -0,0 +1,103 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeEvents(t *testing.T, body string) []Event {
+	t.Helper()
+
+	roots, err := Decode(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + body + "END:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, errs := Events(roots, time.UTC)
+	for _, err := range errs {
+		t.Error(err)
+	}
+
+	return events
+}
+
+// TestEventsTZID resolves a vendor-prefixed TZID and expands the event in
+// that zone across the start of DST.
+func TestEventsTZID(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	events := decodeEvents(t, "BEGIN:VEVENT\r\n"+
+		"UID:standup\r\n"+
+		"DTSTART;TZID=/mozilla.org/20050126_1/Europe/Berlin:20300330T090000\r\n"+
+		"RRULE:FREQ=DAILY;COUNT=3\r\n"+
+		"EXDATE;TZID=Europe/Berlin:20300331T090000\r\n"+
+		"RDATE;TZID=W. Europe Standard Time:20300402T100000\r\n"+
+		"END:VEVENT\r\n")
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+
+	e := events[0]
+	if e.TZ != "Europe/Berlin" || !e.Start.Equal(time.Date(2030, 3, 30, 9, 0, 0, 0, berlin)) {
+		t.Fatalf("start = %v in %q", e.Start, e.TZ)
+	}
+
+	var got []string
+	for _, occ := range e.Instances(e.Start, e.Start.AddDate(0, 1, 0), 10) {
+		got = append(got, occ.UTC().Format("01-02 15:04"))
+	}
+
+	// CET until the 31st, CEST from then on.
+	if want := "03-30 08:00,04-01 07:00,04-02 08:00"; strings.Join(got, ",") != want {
+		t.Errorf("instances in UTC = %s, want %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestEventsAlarmTriggers(t *testing.T) {
+	events := decodeEvents(t, "BEGIN:VEVENT\r\n"+
+		"UID:review\r\n"+
+		"DTSTART:20300110T090000Z\r\n"+
+		"DTEND:20300110T100000Z\r\n"+
+		"BEGIN:VALARM\r\nTRIGGER:-PT15M\r\nDESCRIPTION:soon\r\nEND:VALARM\r\n"+
+		"BEGIN:VALARM\r\nTRIGGER;RELATED=END:-PT1H30M\r\nEND:VALARM\r\n"+
+		"BEGIN:VALARM\r\nTRIGGER;VALUE=DATE-TIME:20300110T080000Z\r\nEND:VALARM\r\n"+
+		"BEGIN:VALARM\r\nTRIGGER:-P1D\r\nEND:VALARM\r\n"+
+		// Alarms after the start are dropped.
+		"BEGIN:VALARM\r\nTRIGGER:PT5M\r\nEND:VALARM\r\n"+
+		"BEGIN:VALARM\r\nTRIGGER;RELATED=END:-PT15M\r\nEND:VALARM\r\n"+
+		"END:VEVENT\r\n")
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+
+	want := []Alarm{
+		{Before: 15 * time.Minute, Description: "soon"},
+		{Before: 30 * time.Minute},
+		{Before: time.Hour},
+		{Before: 24 * time.Hour},
+	}
+
+	got := events[0].Alarms
+	if len(got) != len(want) {
+		t.Fatalf("alarms = %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("alarm %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"TRIGGER:-PT15", "TRIGGER;VALUE=DATE-TIME:2030"} {
+		roots, err := Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nDTSTART:20300110T090000Z\r\n" +
+			"BEGIN:VALARM\r\n" + bad + "\r\nEND:VALARM\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, errs := Events(roots, time.UTC); len(errs) != 1 {
+			t.Errorf("%s: %d errors, want 1", bad, len(errs))
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies supported by ParseRRule.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the periods an expansion walks, so a rule that never
+// matches cannot loop forever.
+const maxPeriods = 100000
+
+// WeekdayNum is a BYDAY entry such as MO, 2TU or -1FR; N is 0 for every
+// such weekday of the period.
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// RRule is a recurrence rule. BYHOUR, BYMINUTE, BYSECOND, BYWEEKNO and
+// BYYEARDAY are not supported; occurrences keep DTSTART's time of day.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int       // 0 for no limit
+	Until      time.Time // zero for no limit
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseInts(s string, lo, hi int) ([]int, error) {
+	var res []int
+
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n == 0 || n < lo || n > hi {
+			return nil, fmt.Errorf("invalid number %q", part)
+		}
+
+		res = append(res, n)
+	}
+
+	return res, nil
+}
+
+// ParseRRule parses an RRULE value. A floating UNTIL is read in loc.
+func ParseRRule(s string, loc *time.Location) (*RRule, error) {
+	r := &RRule{Interval: 1, WeekStart: time.Monday}
+
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid RRULE part %q", part)
+		}
+
+		var err error
+
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(v)
+			if !slices.Contains([]string{Daily, Weekly, Monthly, Yearly}, r.Freq) {
+				return nil, fmt.Errorf("unsupported RRULE frequency %q", v)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(v); err != nil || r.Interval < 1 {
+				return nil, fmt.Errorf("invalid RRULE interval %q", v)
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(v); err != nil || r.Count < 1 {
+				return nil, fmt.Errorf("invalid RRULE count %q", v)
+			}
+		case "UNTIL":
+			if r.Until, _, _, err = (&Zones{Default: loc}).parseTime(v, "", false); err != nil {
+				return nil, fmt.Errorf("invalid RRULE until %q", v)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				d = strings.ToUpper(d)
+				if len(d) < 2 {
+					return nil, fmt.Errorf("invalid RRULE weekday %q", d)
+				}
+
+				wd, ok := weekdays[d[len(d)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid RRULE weekday %q", d)
+				}
+
+				var n int
+				if num := d[:len(d)-2]; num != "" {
+					if n, err = strconv.Atoi(strings.TrimPrefix(num, "+")); err != nil || n == 0 || n < -53 || n > 53 {
+						return nil, fmt.Errorf("invalid RRULE weekday %q", d)
+					}
+				}
+
+				r.ByDay = append(r.ByDay, WeekdayNum{N: n, Weekday: wd})
+			}
+		case "BYMONTHDAY":
+			if r.ByMonthDay, err = parseInts(v, -31, 31); err != nil {
+				return nil, fmt.Errorf("RRULE BYMONTHDAY: %w", err)
+			}
+		case "BYMONTH":
+			months, err := parseInts(v, 1, 12)
+			if err != nil {
+				return nil, fmt.Errorf("RRULE BYMONTH: %w", err)
+			}
+
+			for _, m := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			if r.BySetPos, err = parseInts(v, -366, 366); err != nil {
+				return nil, fmt.Errorf("RRULE BYSETPOS: %w", err)
+			}
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(v)]
+			if !ok {
+				return nil, fmt.Errorf("invalid RRULE week start %q", v)
+			}
+
+			r.WeekStart = wd
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %s", k)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("RRULE without FREQ")
+	}
+
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && r.Freq != Yearly {
+			return nil, fmt.Errorf("RRULE weekday %d%s needs a monthly or yearly frequency", d.N, d.Weekday)
+		}
+	}
+
+	return r, nil
+}
+
+// Expand returns the start times of the rule's occurrences for an event
+// starting at start, in start's location so local time survives DST
+// changes. Occurrences before from or after to are dropped but still count
+// towards COUNT; at most limit are returned. start itself is always the
+// first occurrence.
+func (r *RRule) Expand(start, from, to time.Time, limit int) []time.Time {
+	return r.expand(start, from, to, limit, nil)
+}
+
+// expand is Expand leaving out the occurrences excluded reports, which
+// still count towards COUNT but not towards limit.
+func (r *RRule) expand(start, from, to time.Time, limit int, excluded func(time.Time) bool) []time.Time {
+	var (
+		res   []time.Time
+		count int
+	)
+
+	loc := start.Location()
+	h, mi, s := start.Clock()
+
+	emit := func(t time.Time) bool {
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+
+		if r.Count > 0 && count >= r.Count {
+			return false
+		}
+
+		if t.After(to) || len(res) >= limit {
+			return false
+		}
+
+		count++
+
+		if !t.Before(from) && (excluded == nil || !excluded(t)) {
+			res = append(res, t)
+		}
+
+		return true
+	}
+
+	if !emit(start) {
+		return res
+	}
+
+	for p := 0; p < maxPeriods; p++ {
+		var days []time.Time // midnight of each candidate day
+
+		switch r.Freq {
+		case Daily:
+			days = r.filter([]time.Time{dayOf(start.AddDate(0, 0, p*r.Interval))})
+		case Weekly:
+			days = r.weekDays(start, p)
+		case Monthly:
+			first := time.Date(start.Year(), start.Month()+time.Month(p*r.Interval), 1, 0, 0, 0, 0, loc)
+			days = r.monthDays(first, start.Day(), !r.monthMatches(first.Month()))
+		case Yearly:
+			days = r.yearDays(start, start.Year()+p*r.Interval)
+		}
+
+		days = r.setPos(days)
+
+		for _, d := range days {
+			t := time.Date(d.Year(), d.Month(), d.Day(), h, mi, s, 0, loc)
+			if !t.After(start) {
+				continue
+			}
+
+			if !emit(t) {
+				return res
+			}
+		}
+	}
+
+	return res
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (r *RRule) monthMatches(m time.Month) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, m)
+}
+
+// filter applies BYMONTH, BYMONTHDAY and BYDAY as limits, as they act on
+// daily rules.
+func (r *RRule) filter(days []time.Time) []time.Time {
+	return slices.DeleteFunc(days, func(d time.Time) bool {
+		if !r.monthMatches(d.Month()) {
+			return true
+		}
+
+		if len(r.ByMonthDay) > 0 && !matchesMonthDay(d, r.ByMonthDay) {
+			return true
+		}
+
+		return len(r.ByDay) > 0 && !slices.ContainsFunc(r.ByDay, func(w WeekdayNum) bool { return w.Weekday == d.Weekday() })
+	})
+}
+
+func daysIn(year int, m time.Month) int {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func matchesMonthDay(d time.Time, days []int) bool {
+	n := daysIn(d.Year(), d.Month())
+
+	for _, md := range days {
+		if md == d.Day() || (md < 0 && n+1+md == d.Day()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// weekDays expands the p-th week of a weekly rule: BYDAY, or start's
+// weekday, limited by BYMONTH.
+func (r *RRule) weekDays(start time.Time, p int) []time.Time {
+	d := dayOf(start)
+	offset := (int(d.Weekday()) - int(r.WeekStart) + 7) % 7
+	weekStart := d.AddDate(0, 0, -offset+7*p*r.Interval)
+
+	byDay := r.ByDay
+	if len(byDay) == 0 {
+		byDay = []WeekdayNum{{Weekday: start.Weekday()}}
+	}
+
+	var days []time.Time
+
+	for i := 0; i < 7; i++ {
+		day := weekStart.AddDate(0, 0, i)
+		if r.monthMatches(day.Month()) && slices.ContainsFunc(byDay, func(w WeekdayNum) bool { return w.Weekday == day.Weekday() }) {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+// monthDays expands one month from its first day: BYMONTHDAY and BYDAY
+// (intersected when both are given), or the start's day of month.
+func (r *RRule) monthDays(first time.Time, startDay int, skip bool) []time.Time {
+	if skip {
+		return nil
+	}
+
+	n := daysIn(first.Year(), first.Month())
+
+	var days []time.Time
+
+	switch {
+	case len(r.ByMonthDay) == 0 && len(r.ByDay) == 0:
+		if startDay <= n {
+			days = append(days, first.AddDate(0, 0, startDay-1))
+		}
+	default:
+		for i := 0; i < n; i++ {
+			day := first.AddDate(0, 0, i)
+
+			if len(r.ByMonthDay) > 0 && !matchesMonthDay(day, r.ByMonthDay) {
+				continue
+			}
+
+			if len(r.ByDay) > 0 && !matchesNthWeekday(day, r.ByDay, first, n) {
+				continue
+			}
+
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+// matchesNthWeekday reports whether day is one of the weekdays in byDay,
+// counting ordinals within the span of n days from first.
+func matchesNthWeekday(day time.Time, byDay []WeekdayNum, first time.Time, n int) bool {
+	idx := int(day.Sub(first).Hours()/24 + 0.5)
+
+	for _, w := range byDay {
+		if w.Weekday != day.Weekday() {
+			continue
+		}
+
+		if w.N == 0 ||
+			(w.N > 0 && idx/7+1 == w.N) ||
+			(w.N < 0 && (n-1-idx)/7+1 == -w.N) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// yearDays expands one year: BYMONTH months expanded like monthly rules,
+// every month when only BYMONTHDAY is given, BYDAY with ordinals within
+// the year when both are absent, or the start's month and day.
+func (r *RRule) yearDays(start time.Time, year int) []time.Time {
+	loc := start.Location()
+
+	if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0 {
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		n := time.Date(year, time.December, 31, 0, 0, 0, 0, loc).YearDay()
+
+		var days []time.Time
+
+		for i := 0; i < n; i++ {
+			day := first.AddDate(0, 0, i)
+			if matchesNthWeekday(day, r.ByDay, first, n) {
+				days = append(days, day)
+			}
+		}
+
+		return days
+	}
+
+	months := slices.Clone(r.ByMonth)
+
+	switch {
+	case len(months) > 0:
+		slices.Sort(months)
+	case len(r.ByMonthDay) > 0:
+		for m := time.January; m <= time.December; m++ {
+			months = append(months, m)
+		}
+	default:
+		months = []time.Month{start.Month()}
+	}
+
+	var days []time.Time
+
+	for _, m := range months {
+		days = append(days, r.monthDays(time.Date(year, m, 1, 0, 0, 0, 0, loc), start.Day(), false)...)
+	}
+
+	return days
+}
+
+// setPos keeps the BYSETPOS positions of a period's sorted candidates.
+func (r *RRule) setPos(days []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+
+	var res []time.Time
+
+	for _, pos := range r.BySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+
+		if i >= 0 && i < len(days) && !slices.ContainsFunc(res, days[i].Equal) {
+			res = append(res, days[i])
+		}
+	}
+
+	slices.SortFunc(res, func(a, b time.Time) int { return a.Compare(b) })
+
+	return res
+}
+
+// Instances returns the start times of a recurring event's instances
+// between from and to, at most limit: its RRULE expansion and RDATEs without
+// its EXDATEs, in order. A single event has its start as its only
+// instance.
+func (e Event) Instances(from, to time.Time, limit int) []time.Time {
+	var res []time.Time
+
+	excluded := func(t time.Time) bool { return slices.ContainsFunc(e.ExDates, t.Equal) }
+
+	if e.RRule != nil {
+		res = e.RRule.expand(e.Start, from, to, limit, excluded)
+	} else if !e.Start.Before(from) && !e.Start.After(to) {
+		res = []time.Time{e.Start}
+	}
+
+	res = slices.DeleteFunc(res, excluded)
+
+	for _, t := range e.RDates {
+		if !t.Before(from) && !t.After(to) && !excluded(t) && !slices.ContainsFunc(res, t.Equal) {
+			res = append(res, t.In(e.Start.Location()))
+		}
+	}
+
+	slices.SortFunc(res, func(a, b time.Time) int { return a.Compare(b) })
+
+	if len(res) > limit {
+		res = res[:limit]
+	}
+
+	return res
+}
@@ -0,0 +1,184 @@
+package ical
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no zone data for %s: %v", name, err)
+	}
+
+	return loc
+}
+
+func dates(ts []time.Time) string {
+	s := make([]string, len(ts))
+	for i, t := range ts {
+		s[i] = t.Format("2006-01-02")
+	}
+
+	return strings.Join(s, ",")
+}
+
+func TestParseRRule(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	r, err := ParseRRule("freq=monthly;interval=2;byday=-1FR,+2mo;bysetpos=1;wkst=SU;until=20300103T090000", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RRule{
+		Freq:      Monthly,
+		Interval:  2,
+		Until:     time.Date(2030, 1, 3, 9, 0, 0, 0, ny),
+		ByDay:     []WeekdayNum{{-1, time.Friday}, {2, time.Monday}},
+		BySetPos:  []int{1},
+		WeekStart: time.Sunday,
+	}
+
+	if r.Freq != want.Freq || r.Interval != want.Interval || !r.Until.Equal(want.Until) ||
+		!slices.Equal(r.ByDay, want.ByDay) || !slices.Equal(r.BySetPos, want.BySetPos) || r.WeekStart != want.WeekStart {
+		t.Errorf("ParseRRule = %+v, want %+v", *r, want)
+	}
+
+	for _, bad := range []string{
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;INTERVAL=-1",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=MONTHLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=YEARLY;BYHOUR=9",
+		"FREQ=DAILY;COUNT",
+	} {
+		if _, err := ParseRRule(bad, time.UTC); err == nil {
+			t.Errorf("ParseRRule(%q) accepted", bad)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 9, 0, 0, 0, time.UTC) }
+
+	for _, tc := range []struct {
+		rule  string
+		start time.Time
+		from  time.Time // start when zero
+		limit int
+		want  string
+	}{
+		{"FREQ=DAILY", day(2030, 1, 1), time.Time{}, 3, "2030-01-01,2030-01-02,2030-01-03"},
+		{"FREQ=DAILY;INTERVAL=10", day(2030, 1, 25), time.Time{}, 3, "2030-01-25,2030-02-04,2030-02-14"},
+		{"FREQ=DAILY;COUNT=2", day(2030, 1, 1), time.Time{}, 5, "2030-01-01,2030-01-02"},
+		{"FREQ=DAILY;UNTIL=20300103T090000Z", day(2030, 1, 1), time.Time{}, 5, "2030-01-01,2030-01-02,2030-01-03"},
+		{"FREQ=DAILY;UNTIL=20300103T085959Z", day(2030, 1, 1), time.Time{}, 5, "2030-01-01,2030-01-02"},
+		// Occurrences before from still count towards COUNT.
+		{"FREQ=DAILY;COUNT=5", day(2030, 1, 1), day(2030, 1, 4), 5, "2030-01-04,2030-01-05"},
+		{"FREQ=DAILY;BYDAY=SA,SU", day(2030, 1, 5), time.Time{}, 3, "2030-01-05,2030-01-06,2030-01-12"},
+		{"FREQ=WEEKLY", day(2030, 1, 7), time.Time{}, 3, "2030-01-07,2030-01-14,2030-01-21"},
+		{"FREQ=WEEKLY;BYDAY=MO,WE", day(2030, 1, 7), time.Time{}, 4, "2030-01-07,2030-01-09,2030-01-14,2030-01-16"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=FR", day(2030, 1, 7), time.Time{}, 3, "2030-01-07,2030-01-11,2030-01-25"},
+		// Months without the start's day are skipped.
+		{"FREQ=MONTHLY", day(2030, 1, 31), time.Time{}, 3, "2030-01-31,2030-03-31,2030-05-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", day(2030, 1, 31), time.Time{}, 3, "2030-01-31,2030-02-28,2030-03-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-2", day(2030, 1, 1), time.Time{}, 4, "2030-01-01,2030-01-30,2030-02-01,2030-02-27"},
+		{"FREQ=MONTHLY;BYDAY=2TU", day(2030, 1, 8), time.Time{}, 3, "2030-01-08,2030-02-12,2030-03-12"},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", day(2030, 1, 31), time.Time{}, 3, "2030-01-31,2030-02-28,2030-03-29"},
+		{"FREQ=YEARLY", day(2030, 3, 15), time.Time{}, 3, "2030-03-15,2031-03-15,2032-03-15"},
+		{"FREQ=YEARLY;BYMONTH=1,7", day(2030, 1, 10), time.Time{}, 3, "2030-01-10,2030-07-10,2031-01-10"},
+		// Without BYMONTH, BYMONTHDAY applies to every month.
+		{"FREQ=YEARLY;BYMONTHDAY=1", day(2030, 1, 1), time.Time{}, 3, "2030-01-01,2030-02-01,2030-03-01"},
+		{"FREQ=YEARLY;BYMONTHDAY=13;BYDAY=FR", day(2030, 9, 13), time.Time{}, 3, "2030-09-13,2030-12-13,2031-06-13"},
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29", day(2028, 2, 29), time.Time{}, 2, "2028-02-29,2032-02-29"},
+		{"FREQ=YEARLY;BYDAY=-1FR", day(2030, 12, 27), time.Time{}, 2, "2030-12-27,2031-12-26"},
+	} {
+		r, err := ParseRRule(tc.rule, time.UTC)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.rule, err)
+		}
+
+		from := tc.from
+		if from.IsZero() {
+			from = tc.start
+		}
+
+		got := r.Expand(tc.start, from, tc.start.AddDate(10, 0, 0), tc.limit)
+		if dates(got) != tc.want {
+			t.Errorf("%s from %s: got %s, want %s", tc.rule, tc.start.Format("2006-01-02"), dates(got), tc.want)
+		}
+
+		for _, occ := range got {
+			if h, m, _ := occ.Clock(); h != 9 || m != 0 {
+				t.Errorf("%s: occurrence %v moved off 09:00", tc.rule, occ)
+			}
+		}
+	}
+}
+
+// TestExpandAcrossDST keeps the start's local time of day when the zone
+// changes its offset between occurrences.
+func TestExpandAcrossDST(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	r, err := ParseRRule("FREQ=DAILY;COUNT=3", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2030, 3, 9, 9, 0, 0, 0, ny) // DST starts on the 10th
+	got := r.Expand(start, start, start.AddDate(0, 1, 0), 10)
+
+	var utc []string
+	for _, occ := range got {
+		utc = append(utc, occ.UTC().Format("01-02 15:04"))
+	}
+
+	if want := "03-09 14:00,03-10 13:00,03-11 13:00"; strings.Join(utc, ",") != want {
+		t.Errorf("occurrences in UTC = %s, want %s", strings.Join(utc, ","), want)
+	}
+}
+
+func TestInstances(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2030, 1, d, 9, 0, 0, 0, time.UTC) }
+	daily := func(rule string) *RRule {
+		r, err := ParseRRule(rule, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	for _, tc := range []struct {
+		name  string
+		e     Event
+		limit int
+		want  string
+	}{
+		{"single", Event{Start: day(3)}, 5, "2030-01-03"},
+		{"single excluded", Event{Start: day(3), ExDates: []time.Time{day(3)}}, 5, ""},
+		// Excluded instances do not use up the limit.
+		{"exdate under limit", Event{Start: day(1), RRule: daily("FREQ=DAILY"), ExDates: []time.Time{day(2), day(3)}}, 3, "2030-01-01,2030-01-04,2030-01-05"},
+		// They do use up COUNT.
+		{"exdate under count", Event{Start: day(1), RRule: daily("FREQ=DAILY;COUNT=3"), ExDates: []time.Time{day(2)}}, 5, "2030-01-01,2030-01-03"},
+		{"rdate", Event{Start: day(1), RRule: daily("FREQ=WEEKLY;COUNT=2"), RDates: []time.Time{day(3), day(8)}}, 5, "2030-01-01,2030-01-03,2030-01-08"},
+		{"rdate excluded", Event{Start: day(1), RDates: []time.Time{day(3)}, ExDates: []time.Time{day(3)}}, 5, "2030-01-01"},
+		{"rdate past limit", Event{Start: day(1), RRule: daily("FREQ=DAILY"), RDates: []time.Time{day(1).Add(time.Hour)}}, 2, "2030-01-01,2030-01-01"},
+	} {
+		got := tc.e.Instances(day(1), day(31), tc.limit)
+		if dates(got) != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, dates(got), tc.want)
+		}
+	}
+}
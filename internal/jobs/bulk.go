@@ -0,0 +1,381 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/db"
+)
+
+var (
+	ErrEmptySelection     = errors.New("no jobs selected: give ids or a filter")
+	ErrUnboundedSelection = errors.New("the filter matches every job: narrow it or select all explicitly")
+)
+
+// Selection picks the jobs a bulk action applies to: the listed ids, or
+// every job matching Filter when IDs is empty. Filter paging is ignored.
+// A filter without criteria, or no filter, selects every job only if All
+// is set.
+type Selection struct {
+	IDs    []int64
+	Filter *JobFilter
+	All    bool
+}
+
+// Validate rejects a selection of no jobs, and one of every job that does
+// not set All.
+func (sel Selection) Validate() error {
+	switch {
+	case len(sel.IDs) > 0 || sel.All:
+		return nil
+	case sel.Filter == nil:
+		return ErrEmptySelection
+	case sel.Filter.Unbounded():
+		return ErrUnboundedSelection
+	default:
+		return nil
+	}
+}
+
+// filter is the filter of a selection by filter or of every job.
+func (sel Selection) filter() JobFilter {
+	if sel.Filter == nil {
+		return JobFilter{}
+	}
+
+	return *sel.Filter
+}
+
+// idList passes ids as a single JSON argument, to be expanded with
+// jsonEach, so bulk statements are not bound by SQLite's parameter limit.
+func idList(ids []int64) string {
+	if ids == nil {
+		ids = []int64{}
+	}
+
+	b, _ := json.Marshal(ids)
+
+	return string(b)
+}
+
+// jsonEach is a table of the elements of a JSON array argument, in a
+// column named value.
+func jsonEach(d db.Dialect) string {
+	if d == db.Postgres {
+		return `json_array_elements_text(CAST(? AS json))`
+	}
+
+	return `json_each(?)`
+}
+
+// inIDs is a subquery of the ids in an idList argument.
+func inIDs(d db.Dialect) string {
+	return `(SELECT CAST(value AS BIGINT) FROM ` + jsonEach(d) + `)`
+}
+
+// resolve returns the ids of the selected jobs that also satisfy cond, a
+// condition on the jobs table ("1=1" for none).
+func (sel Selection) resolve(ctx context.Context, tx *sql.Tx, d db.Dialect, cond string) ([]int64, error) {
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+
+	var (
+		query string
+		args  []any
+	)
+
+	if len(sel.IDs) > 0 {
+		query = `SELECT jobs.id FROM jobs WHERE jobs.id IN ` + inIDs(d) + ` AND ` + cond + ` ORDER BY jobs.id`
+		args = []any{idList(sel.IDs)}
+	} else {
+		f := sel.filter()
+		where, fargs := f.where(d)
+		query = `SELECT jobs.id FROM ` + f.from(d) + ` WHERE ` + where + ` AND ` + cond + ` ORDER BY jobs.id`
+		args = fargs
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// bulk runs f on the selected jobs matching cond in one transaction and
+// returns their ids.
+func (r *Repo) bulk(ctx context.Context, sel Selection, cond string, f func(tx *sql.Tx, ids []int64) error) ([]int64, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	ids, err := sel.resolve(ctx, tx, r.dialect(), cond)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if err := f(tx, ids); err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
+
+// CancelJobs cancels the selected pending jobs and their pending reminders.
+func (r *Repo) CancelJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	d := r.dialect()
+	in := inIDs(d)
+
+	return r.bulk(ctx, sel, `jobs.status = 'pending'`, func(tx *sql.Tx, ids []int64) error {
+		list := idList(ids)
+
+		if _, err := tx.ExecContext(ctx, `UPDATE jobs SET status='cancelled' WHERE id IN `+in, list); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET status='cancelled' WHERE status='pending' AND job_id IN `+in, list); err != nil {
+			return err
+		}
+
+		return addJobEvents(ctx, tx, d, list, EventCancelled, "")
+	})
+}
+
+// DeleteJobs removes the selected jobs with their reminders and labels,
+// and closes their history with a deleted event.
+func (r *Repo) DeleteJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	d := r.dialect()
+	in := inIDs(d)
+
+	return r.bulk(ctx, sel, `1=1`, func(tx *sql.Tx, ids []int64) error {
+		list := idList(ids)
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE id IN `+in, list); err != nil {
+			return err
+		}
+
+		return addJobEvents(ctx, tx, d, list, EventDeleted, "")
+	})
+}
+
+// ShiftJobs moves the run time and the pending reminders of the selected
+// pending jobs by d. Delivered reminders keep their times.
+func (r *Repo) ShiftJobs(ctx context.Context, sel Selection, d time.Duration) ([]int64, error) {
+	dialect := r.dialect()
+	in := inIDs(dialect)
+
+	return r.bulk(ctx, sel, `jobs.status = 'pending'`, func(tx *sql.Tx, ids []int64) error {
+		list := idList(ids)
+
+		type row struct {
+			id int64
+			at time.Time
+		}
+
+		load := func(query string) ([]row, error) {
+			rows, err := tx.QueryContext(ctx, query, list)
+			if err != nil {
+				return nil, err
+			}
+
+			defer rows.Close()
+
+			var res []row
+
+			for rows.Next() {
+				var x row
+				if err := rows.Scan(&x.id, &x.at); err != nil {
+					return nil, err
+				}
+
+				res = append(res, x)
+			}
+
+			return res, rows.Err()
+		}
+
+		// Times are stored as text, so they are shifted here rather than in SQL.
+		jobsRows, err := load(`SELECT id, run_at_utc FROM jobs WHERE id IN ` + in)
+		if err != nil {
+			return err
+		}
+
+		remRows, err := load(`SELECT id, due_at_utc FROM job_reminders WHERE status = 'pending' AND job_id IN ` + in)
+		if err != nil {
+			return err
+		}
+
+		for _, x := range jobsRows {
+			if _, err := tx.ExecContext(ctx, `UPDATE jobs SET run_at_utc = ? WHERE id = ?`, x.at.UTC().Add(d), x.id); err != nil {
+				return err
+			}
+		}
+
+		for _, x := range remRows {
+			if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET due_at_utc = ? WHERE id = ?`, x.at.UTC().Add(d), x.id); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, settleJobsSQL+` AND id IN `+in, list); err != nil {
+			return err
+		}
+
+		return addJobEvents(ctx, tx, dialect, list, EventEdited, shiftDetails(d))
+	})
+}
+
+// RelabelJobs sets and removes labels on the selected jobs. Keys in both
+// set and remove end up removed.
+func (r *Repo) RelabelJobs(ctx context.Context, sel Selection, set map[string]string, remove []string) ([]int64, error) {
+	if err := ValidateLabels(set); err != nil {
+		return nil, err
+	}
+
+	d := r.dialect()
+
+	return r.bulk(ctx, sel, `1=1`, func(tx *sql.Tx, ids []int64) error {
+		list := idList(ids)
+
+		for k, v := range set {
+			_, err := tx.ExecContext(ctx, `
+			  INSERT INTO job_labels(job_id, key, value)
+			  SELECT CAST(value AS BIGINT), ?, ? FROM `+jsonEach(d)+` WHERE true
+			  ON CONFLICT(job_id, key) DO UPDATE SET value = excluded.value`, k, v, list)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(remove) > 0 {
+			keys, _ := json.Marshal(remove)
+			_, err := tx.ExecContext(ctx, `
+			  DELETE FROM job_labels
+			  WHERE job_id IN `+inIDs(d)+` AND key IN (SELECT value FROM `+jsonEach(d)+`)`, list, string(keys))
+			if err != nil {
+				return err
+			}
+		}
+
+		return addJobEvents(ctx, tx, d, list, EventEdited, relabelDetails(set, remove))
+	})
+}
+
+// PendingOccurrences returns the pending reminders of the given jobs that
+// are due before the given time.
+func (r *Repo) PendingOccurrences(ctx context.Context, jobIDs []int64, before time.Time) ([]Occurrence, error) {
+	return r.loadPending(ctx, `r.job_id IN `+inIDs(r.dialect())+` AND r.due_at_utc < ?`, idList(jobIDs), before)
+}
+
+// CancelJobs cancels the selected pending jobs and disarms their timers.
+func (s *Scheduler) CancelJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	ids, err := s.Repo.CancelJobs(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	s.disarm(ids)
+
+	return ids, nil
+}
+
+// DeleteJobs deletes the selected jobs and disarms their timers.
+func (s *Scheduler) DeleteJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	ids, err := s.Repo.DeleteJobs(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	s.disarm(ids)
+
+	return ids, nil
+}
+
+// ShiftJobs reschedules the selected pending jobs by d and re-arms them.
+func (s *Scheduler) ShiftJobs(ctx context.Context, sel Selection, d time.Duration) ([]int64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	ids, err := s.Repo.ShiftJobs(ctx, sel, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, s.rearm(ctx, ids)
+}
+
+// RelabelJobs changes the labels of the selected jobs and re-arms their
+// pending reminders so deliveries carry the new labels.
+func (s *Scheduler) RelabelJobs(ctx context.Context, sel Selection, set map[string]string, remove []string) ([]int64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	ids, err := s.Repo.RelabelJobs(ctx, sel, set, remove)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, s.rearm(ctx, ids)
+}
+
+// ArmJobs arms the pending reminders of the given jobs that fall inside
+// the loaded window, e.g. after they were imported.
+func (s *Scheduler) ArmJobs(ctx context.Context, jobIDs []int64) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	return s.rearm(ctx, jobIDs)
+}
+
+func (s *Scheduler) disarm(jobIDs []int64) {
+	for _, id := range jobIDs {
+		s.Cancel(id)
+	}
+}
+
+// rearm replaces the timers of the given jobs with ones for their current
+// pending reminders inside the loaded window. Callers hold loadMu.
+func (s *Scheduler) rearm(ctx context.Context, jobIDs []int64) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+
+	occs, err := s.Repo.PendingOccurrences(ctx, jobIDs, s.loadedUntil)
+	if err != nil {
+		return err
+	}
+
+	s.disarm(jobIDs)
+
+	return s.ScheduleBatch(ctx, occs)
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+)
+
+func (r *Repo) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT spec FROM calendars ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []*calendar.Calendar
+
+	for rows.Next() {
+		var spec string
+		if err := rows.Scan(&spec); err != nil {
+			return nil, err
+		}
+
+		var c calendar.Calendar
+		if err := json.Unmarshal([]byte(spec), &c); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &c)
+	}
+
+	return res, rows.Err()
+}
+
+func (r *Repo) UpsertCalendar(ctx context.Context, c *calendar.Calendar) error {
+	spec, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.ExecContext(ctx, `
+	  INSERT INTO calendars(name, spec, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+	  ON CONFLICT(name) DO UPDATE SET spec = excluded.spec, updated_at = excluded.updated_at`,
+		c.Name, string(spec))
+
+	return err
+}
+
+func (r *Repo) DeleteCalendar(ctx context.Context, name string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM calendars WHERE name = ?`, name)
+
+	return err
+}
+
+// PutCalendar validates and stores a calendar and makes it available to the
+// scheduler, then re-arms the reminders of the jobs using it.
+func (s *Scheduler) PutCalendar(ctx context.Context, c *calendar.Calendar) error {
+	if err := c.Compile(); err != nil {
+		return err
+	}
+
+	if err := s.Repo.UpsertCalendar(ctx, c); err != nil {
+		return err
+	}
+
+	if err := s.Calendars.Put(c); err != nil {
+		return err
+	}
+
+	return s.rearmCalendar(ctx, c.Name)
+}
+
+// DeleteCalendar removes a calendar; the jobs using it are re-armed for
+// their own due times.
+func (s *Scheduler) DeleteCalendar(ctx context.Context, name string) error {
+	if err := s.Repo.DeleteCalendar(ctx, name); err != nil {
+		return err
+	}
+
+	s.Calendars.Delete(name)
+
+	return s.rearmCalendar(ctx, name)
+}
+
+// rearmCalendar re-arms the pending reminders of jobs using the calendar
+// name, so that their delivery times follow its current rules: those that
+// are armed and those due later inside the loaded window. Overdue
+// reminders without a timer are being delivered and are left alone.
+func (s *Scheduler) rearmCalendar(ctx context.Context, name string) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	occs, err := s.Repo.LoadPendingBetween(ctx, time.Time{}, s.loadedUntil)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	occs = slices.DeleteFunc(occs, func(o Occurrence) bool {
+		if o.Job.Calendar != name {
+			return true
+		}
+
+		_, armed := s.timers[o.Job.ID][o.Reminder.ID]
+
+		return !armed && o.Reminder.DueAtUTC.Before(now)
+	})
+	s.mu.Unlock()
+
+	return s.ScheduleBatch(ctx, occs)
+}
+
+// LoadCalendars fills the registry from the database.
+func (s *Scheduler) LoadCalendars(ctx context.Context) error {
+	cals, err := s.Repo.ListCalendars(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cals {
+		if err := s.Calendars.Put(c); err != nil {
+			log.Printf("calendar %q ignored err=%v", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Adjust returns the instant a reminder of j that is due at due should
+// actually be delivered once the job's calendar is applied. skip is set when
+// the calendar drops blocked reminders instead of shifting them, or when no
+// allowed instant can be found.
+func (s *Scheduler) Adjust(j Job, due time.Time) (at time.Time, skip bool) {
+	if j.Calendar == "" || s.Calendars == nil {
+		return due, false
+	}
+
+	c, ok := s.Calendars.Get(j.Calendar)
+	if !ok {
+		return due, false
+	}
+
+	loc, err := time.LoadLocation(j.TZ)
+	if err != nil {
+		return due, false
+	}
+
+	next, ok := c.Next(due, loc)
+	if !ok {
+		return due, true
+	}
+
+	next = next.UTC()
+	if next.Equal(due) {
+		return due, false
+	}
+
+	if c.OnBlocked == calendar.ActionSkip {
+		return due, true
+	}
+
+	return next, false
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/db"
+)
+
+// claimLease is how long a claim keeps other replicas from delivering a
+// reminder. A replica that dies mid-delivery leaves its claim behind; once
+// the lease runs out the reminder can be claimed again.
+const claimLease = time.Minute
+
+// Claim reserves a pending reminder for delivery, so that schedulers
+// sharing a database deliver it once. It reports false when the reminder
+// is no longer pending at rem.DueAtUTC or another scheduler holds a claim
+// on it. On PostgreSQL concurrent claims skip the locked row rather than
+// wait for it.
+func (r *Repo) Claim(ctx context.Context, rem Reminder, now time.Time) (bool, error) {
+	now = now.UTC()
+
+	cond := `id = ? AND status = 'pending' AND due_at_utc = ? AND (claimed_at IS NULL OR claimed_at < ?)`
+	if r.dialect() == db.Postgres {
+		cond = `id IN (SELECT id FROM job_reminders WHERE ` + cond + ` FOR UPDATE SKIP LOCKED)`
+	}
+
+	res, err := r.DB.ExecContext(ctx, `UPDATE job_reminders SET claimed_at = ? WHERE `+cond,
+		now, rem.ID, rem.DueAtUTC.UTC(), now.Add(-claimLease))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+// HoldClaim keeps a claim on a pending reminder from running out before
+// until plus the lease, for a delivery that has to wait for the rate
+// limiter. It never shortens a claim.
+func (r *Repo) HoldClaim(ctx context.Context, reminderID int64, until time.Time) error {
+	_, err := r.DB.ExecContext(ctx, `
+	  UPDATE job_reminders SET claimed_at = ?
+	  WHERE id = ? AND status = 'pending' AND claimed_at IS NOT NULL AND claimed_at < ?`,
+		until.UTC(), reminderID, until.UTC())
+
+	return err
+}
+
+// Release drops the claim on a reminder that could not be delivered, so
+// that the scheduler's next attempt need not wait for the lease to run out,
+// and records the failure, reason, in its job's history.
+func (r *Repo) Release(ctx context.Context, reminderID int64, reason string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET claimed_at = NULL WHERE id = ?`, reminderID); err != nil {
+		return err
+	}
+
+	if err := addReminderEvents(ctx, tx, EventRetried, reason, `id = ?`, reminderID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a row of the job list by its sort key and id. Tokens are
+// only valid for the sort they were issued for.
+type cursor struct {
+	Sort   SortField `json:"s"`
+	Desc   bool      `json:"d,omitempty"`
+	Key    string    `json:"k"`
+	ID     int64     `json:"i"`
+	Before bool      `json:"b,omitempty"` // the page ends before the row
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// CursorPage is a page of jobs from ListJobs. Next and Prev are empty when
+// there is no such page; Total is -1 unless the filter asked for a count.
+type CursorPage struct {
+	Jobs  []Job
+	Next  string
+	Prev  string
+	Total int
+}
+
+// ListJobs returns a page of jobs matching filter, with labels, using keyset
+// pagination on the sort column and id: pages stay stable while jobs are
+// added and deep pages cost the same as the first. It never ranks by
+// relevance and falls back to SortDue when filter.Sort is not set.
+func (r *Repo) ListJobs(ctx context.Context, filter JobFilter) (*CursorPage, error) {
+	c, err := startList(&filter)
+	if err != nil {
+		return nil, err
+	}
+
+	d := r.dialect()
+
+	where, args := filter.where(d)
+	from, col := filter.from(d), filter.sortColumn()
+
+	page := &CursorPage{Total: -1}
+
+	if filter.Count {
+		err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+from+` WHERE `+where, args...).Scan(&page.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Paging backwards scans against the sort order and flips the rows.
+	desc := filter.Desc != c.Before
+
+	op, dir := ">", " ASC"
+	if desc {
+		op, dir = "<", " DESC"
+	}
+
+	if filter.Cursor != "" {
+		where += ` AND (` + col + ` ` + op + ` ? OR (` + col + ` = ? AND jobs.id ` + op + ` ?))`
+		args = append(args, c.Key, c.Key, c.ID)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT CAST(`+col+` AS TEXT), `+jobColumnsOf("jobs")+`
+		FROM `+from+`
+		WHERE `+where+`
+		ORDER BY `+col+dir+`, jobs.id`+dir+`
+		LIMIT ?`, append(args, filter.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var (
+			key string
+			j   Job
+		)
+
+		if err := rows.Scan(append([]any{&key}, jobDest(&j)...)...); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		page.Jobs = append(page.Jobs, j)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page.fill(filter, c, keys)
+
+	if err := r.attachLabels(ctx, page.Jobs); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// startList applies the ListJobs defaults to filter and decodes its
+// cursor, if any.
+func startList(filter *JobFilter) (cursor, error) {
+	if filter.Limit < 1 {
+		filter.Limit = 50
+	}
+
+	if !filter.Sort.Valid() {
+		filter.Sort = SortDue
+	}
+
+	if filter.Cursor == "" {
+		return cursor{}, nil
+	}
+
+	c, err := decodeCursor(filter.Cursor)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Sort != filter.Sort || c.Desc != filter.Desc {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// fill trims the jobs read after cursor c, at most filter.Limit+1 in scan
+// order with their sort keys, to a page and sets its Next and Prev tokens.
+func (page *CursorPage) fill(filter JobFilter, c cursor, keys []string) {
+	more := len(page.Jobs) > filter.Limit
+	if more {
+		page.Jobs, keys = page.Jobs[:filter.Limit], keys[:filter.Limit]
+	}
+
+	if c.Before {
+		slices.Reverse(page.Jobs)
+		slices.Reverse(keys)
+	}
+
+	if n := len(page.Jobs); n > 0 {
+		at := func(i int, before bool) string {
+			return cursor{Sort: filter.Sort, Desc: filter.Desc, Key: keys[i], ID: page.Jobs[i].ID, Before: before}.encode()
+		}
+
+		if more || c.Before {
+			page.Next = at(n-1, false)
+		}
+
+		if (more && c.Before) || (filter.Cursor != "" && !c.Before) {
+			page.Prev = at(0, true)
+		}
+	}
+}
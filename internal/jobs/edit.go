@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrNotEditable = errors.New("only pending jobs can be edited")
+
+// Update rewrites a pending job from j: its fields, its labels, and its
+// pending reminders, which are replaced with ones for j's offsets at its new
+// run time. Delivered reminders are kept and not sent again. It fails with
+// sql.ErrNoRows for a missing job and ErrNotEditable for one that is no
+// longer pending.
+func (r *Repo) Update(ctx context.Context, j *Job) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	cur, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, j.ID))
+	if err != nil {
+		return err
+	}
+
+	if cur.Status != "pending" {
+		return ErrNotEditable
+	}
+
+	ex, err := loadCurrent(ctx, tx, cur)
+	if err != nil {
+		return err
+	}
+
+	changed := changes(ex, j)
+	if changed == "" {
+		return nil
+	}
+
+	offsets := jobOffsets(j)
+
+	_, err = tx.ExecContext(ctx, `
+	  UPDATE jobs SET title = ?, tz = ?, run_at_utc = ?, remind_before_minutes = ?, misfire_policy = ?,
+	    tenant = ?, max_delay_seconds = ?, calendar = ?, payload = ?
+	  WHERE id = ?`,
+		j.Title, j.TZ, j.RunAtUTC, offsets[0], j.MisfirePolicy, j.Tenant, j.MaxDelaySeconds, j.Calendar, j.Payload, j.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceReminders(ctx, tx, j, offsets); err != nil {
+		return err
+	}
+
+	if _, err := addEvent(ctx, tx, j.ID, 0, EventEdited, changed); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changes lists the fields j changes on a job, for its history; it is
+// empty if j leaves the job as it is.
+func changes(ex *externalJob, j *Job) string {
+	labels := j.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	var res []string
+
+	for _, c := range []struct {
+		name    string
+		changed bool
+	}{
+		{"title", ex.Title != j.Title},
+		{"time zone", ex.TZ != j.TZ},
+		{"run time", !ex.RunAtUTC.Equal(j.RunAtUTC)},
+		{"reminders", !slices.Equal(ex.offsets, jobOffsets(j))},
+		{"labels", !maps.Equal(ex.Labels, labels)},
+		{"payload", ex.Payload != j.Payload},
+		{"tenant", ex.Tenant != j.Tenant},
+		{"misfire policy", ex.MisfirePolicy != j.MisfirePolicy},
+		{"max delay", ex.MaxDelaySeconds != j.MaxDelaySeconds},
+		{"calendar", ex.Calendar != j.Calendar},
+	} {
+		if c.changed {
+			res = append(res, c.name)
+		}
+	}
+
+	return strings.Join(res, ", ")
+}
+
+// UpdateJob edits a pending job like Repo.Update and re-arms it.
+func (s *Scheduler) UpdateJob(ctx context.Context, j *Job) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	if err := s.Repo.Update(ctx, j); err != nil {
+		return err
+	}
+
+	return s.rearm(ctx, []int64{j.ID})
+}
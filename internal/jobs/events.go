@@ -0,0 +1,219 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/db"
+)
+
+// Event kinds, one per transition of a job or one of its reminders.
+const (
+	EventCreated   = "created"
+	EventEdited    = "edited"   // rescheduled, relabelled or re-imported
+	EventSnoozed   = "snoozed"  // a follow-up reminder was added
+	EventEnqueued  = "enqueued" // Details holds the published message
+	EventRetried   = "retried"  // publishing failed; Details holds the error and the next attempt
+	EventMissed    = "missed"   // dropped by the misfire policy
+	EventSkipped   = "skipped"  // outside the job's calendar
+	EventCancelled = "cancelled"
+	EventAcked     = "acked"   // a consumer reported the reminder handled
+	EventDeleted   = "deleted" // the job is gone; its history is kept
+)
+
+// Event is an entry in a job's history, stored in job_events.
+type Event struct {
+	ID         int64
+	JobID      int64
+	ReminderID int64 // 0 for events of the whole job
+	Kind       string
+	Actor      string
+	// ActorNote is the name the client gave for itself, which nothing
+	// verifies; Actor is the one the server determined.
+	ActorNote string
+	Details   string
+	CreatedAt time.Time
+}
+
+var ErrNotAckable = errors.New("job has no delivered reminder to acknowledge")
+
+type actorKey struct{}
+
+type actor struct {
+	name string
+	note string
+}
+
+// WithActor returns a context whose job changes are recorded as made by
+// actor, such as "admin", "api" or "scheduler", without a note.
+func WithActor(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{name: name})
+}
+
+// WithActorNote returns a context whose job changes also record note, a
+// name the client gave for itself, next to the actor.
+func WithActorNote(ctx context.Context, note string) context.Context {
+	a, _ := ctx.Value(actorKey{}).(actor)
+	a.note = note
+
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFrom returns the actor set by WithActor, or "system".
+func ActorFrom(ctx context.Context) string {
+	if a, _ := ctx.Value(actorKey{}).(actor); a.name != "" {
+		return a.name
+	}
+
+	return "system"
+}
+
+// ActorNoteFrom returns the note set by WithActorNote.
+func ActorNoteFrom(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(actor)
+
+	return a.note
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// addEvent records an event of one job, by the actor of ctx.
+func addEvent(ctx context.Context, tx *sql.Tx, jobID, reminderID int64, kind, details string) (Event, error) {
+	e := Event{
+		JobID:      jobID,
+		ReminderID: reminderID,
+		Kind:       kind,
+		Actor:      ActorFrom(ctx),
+		ActorNote:  ActorNoteFrom(ctx),
+		Details:    details,
+	}
+
+	err := tx.QueryRowContext(ctx, `
+	  INSERT INTO job_events(job_id, reminder_id, kind, actor, actor_note, details)
+	  VALUES (?, ?, ?, ?, ?, ?)
+	  RETURNING id, created_at`,
+		e.JobID, nullID(e.ReminderID), e.Kind, e.Actor, e.ActorNote, e.Details).Scan(&e.ID, &e.CreatedAt)
+
+	return e, err
+}
+
+// addJobEvents records the same event for every job in an idList.
+func addJobEvents(ctx context.Context, tx *sql.Tx, d db.Dialect, list, kind, details string) error {
+	_, err := tx.ExecContext(ctx, `
+	  INSERT INTO job_events(job_id, kind, actor, actor_note, details)
+	  SELECT CAST(value AS BIGINT), CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS TEXT) FROM `+jsonEach(d),
+		kind, ActorFrom(ctx), ActorNoteFrom(ctx), details, list)
+
+	return err
+}
+
+// addReminderEvents records an event for each of the reminders matching
+// cond, a condition on job_reminders.
+func addReminderEvents(ctx context.Context, tx *sql.Tx, kind, details, cond string, args ...any) error {
+	_, err := tx.ExecContext(ctx, `
+	  INSERT INTO job_events(job_id, reminder_id, kind, actor, actor_note, details)
+	  SELECT job_id, id, CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS TEXT) FROM job_reminders
+	  WHERE `+cond,
+		append([]any{kind, ActorFrom(ctx), ActorNoteFrom(ctx), details}, args...)...)
+
+	return err
+}
+
+// shiftDetails and relabelDetails describe bulk edits.
+func shiftDetails(d time.Duration) string {
+	if d < 0 {
+		return "moved " + (-d).String() + " earlier"
+	}
+
+	return "moved " + d.String() + " later"
+}
+
+func relabelDetails(set map[string]string, remove []string) string {
+	var parts []string
+
+	if len(set) > 0 {
+		parts = append(parts, "set "+FormatLabels(set))
+	}
+
+	if len(remove) > 0 {
+		parts = append(parts, "removed "+strings.Join(remove, ", "))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func snoozeDetails(at time.Time) string {
+	return "until " + at.UTC().Format(time.RFC3339)
+}
+
+// Events returns the history of a job, oldest first. The history of a
+// deleted job is kept and ends with a deleted event.
+func (r *Repo) Events(ctx context.Context, jobID int64) ([]Event, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+	  SELECT id, job_id, COALESCE(reminder_id, 0), kind, actor, actor_note, details, created_at
+	  FROM job_events
+	  WHERE job_id = ?
+	  ORDER BY id`, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []Event
+
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.JobID, &e.ReminderID, &e.Kind, &e.Actor, &e.ActorNote, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+// Ack records that a consumer handled a delivered reminder of a job; with
+// a reminderID of 0, the latest one. It fails with sql.ErrNoRows for a
+// missing job and ErrNotAckable if the reminder was not delivered.
+func (r *Repo) Ack(ctx context.Context, jobID, reminderID int64, details string) (Event, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Event{}, err
+	}
+
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRowContext(ctx, `SELECT 1 FROM jobs WHERE id = ?`, jobID).Scan(&found); err != nil {
+		return Event{}, err
+	}
+
+	var rem Reminder
+	err = tx.QueryRowContext(ctx, `
+	  SELECT `+reminderColumns+`
+	  FROM job_reminders
+	  WHERE job_id = ? AND status = 'enqueued' AND (id = ? OR ? = 0)
+	  ORDER BY due_at_utc DESC, id DESC
+	  LIMIT 1`, jobID, reminderID, reminderID).Scan(reminderDest(&rem)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Event{}, ErrNotAckable
+	}
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	e, err := addEvent(ctx, tx, jobID, rem.ID, EventAcked, details)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return e, tx.Commit()
+}
@@ -0,0 +1,219 @@
+package jobs
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// exportPage is how many jobs Export reads per query.
+const exportPage = 500
+
+// exportColumns is the CSV header; NDJSON records use the same keys.
+var exportColumns = []string{
+	"id", "title", "status", "tz",
+	"run_at_utc", "run_at_local", "due_at_utc", "due_at_local",
+	"remind_before", "labels", "payload",
+	"tenant", "calendar", "misfire_policy", "max_delay_seconds",
+	"external_id", "created_at_utc",
+}
+
+type exportRecord struct {
+	ID              int64             `json:"id"`
+	Title           string            `json:"title"`
+	Status          string            `json:"status"`
+	TZ              string            `json:"tz"`
+	RunAtUTC        string            `json:"run_at_utc"`
+	RunAtLocal      string            `json:"run_at_local"`
+	DueAtUTC        string            `json:"due_at_utc"`
+	DueAtLocal      string            `json:"due_at_local"`
+	RemindBefore    []int             `json:"remind_before"`
+	Labels          map[string]string `json:"labels"`
+	Payload         string            `json:"payload"`
+	Tenant          string            `json:"tenant"`
+	Calendar        string            `json:"calendar"`
+	MisfirePolicy   string            `json:"misfire_policy"`
+	MaxDelaySeconds int               `json:"max_delay_seconds"`
+	ExternalID      string            `json:"external_id"`
+	CreatedAtUTC    string            `json:"created_at_utc"`
+}
+
+func (e exportRecord) csv() []string {
+	offsets := make([]string, len(e.RemindBefore))
+	for i, m := range e.RemindBefore {
+		offsets[i] = strconv.Itoa(m)
+	}
+
+	rec := []string{
+		strconv.FormatInt(e.ID, 10), e.Title, e.Status, e.TZ,
+		e.RunAtUTC, e.RunAtLocal, e.DueAtUTC, e.DueAtLocal,
+		strings.Join(offsets, ","), FormatLabels(e.Labels), e.Payload,
+		e.Tenant, e.Calendar, e.MisfirePolicy, strconv.Itoa(e.MaxDelaySeconds),
+		e.ExternalID, e.CreatedAtUTC,
+	}
+
+	for i, v := range rec {
+		rec[i] = csvCell(v)
+	}
+
+	return rec
+}
+
+// csvCell keeps a spreadsheet from evaluating a cell as a formula: cells
+// starting with =, +, -, @, a tab or a carriage return get a leading '.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+
+	return v
+}
+
+// exportLocations caches job time zones; a zone that fails to load is
+// exported in UTC.
+type exportLocations map[string]*time.Location
+
+func (l exportLocations) get(tz string) *time.Location {
+	loc, ok := l[tz]
+	if !ok {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			loc = time.UTC
+		}
+
+		l[tz] = loc
+	}
+
+	return loc
+}
+
+func toExportRecord(j Job, locs exportLocations) exportRecord {
+	loc := locs.get(j.TZ)
+
+	rec := exportRecord{
+		ID:              j.ID,
+		Title:           j.Title,
+		Status:          j.Status,
+		TZ:              j.TZ,
+		RunAtUTC:        j.RunAtUTC.UTC().Format(time.RFC3339),
+		RunAtLocal:      j.RunAtUTC.In(loc).Format(time.RFC3339),
+		DueAtUTC:        j.DueAtUTC.UTC().Format(time.RFC3339),
+		DueAtLocal:      j.DueAtUTC.In(loc).Format(time.RFC3339),
+		RemindBefore:    j.Offsets(),
+		Labels:          j.Labels,
+		Payload:         j.Payload,
+		Tenant:          j.Tenant,
+		Calendar:        j.Calendar,
+		MisfirePolicy:   string(j.MisfirePolicy),
+		MaxDelaySeconds: j.MaxDelaySeconds,
+		ExternalID:      j.ExternalID,
+		CreatedAtUTC:    j.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if rec.Labels == nil {
+		rec.Labels = map[string]string{}
+	}
+
+	return rec
+}
+
+// Export writes every job matching filter to w as CSV with a header row or
+// as NDJSON, one job per line. Jobs are read a page at a time in the
+// filter's sort order (search results are not ranked) and w is flushed
+// after each page if it has a Flush method, so large exports stream. It
+// returns the number of jobs written.
+func (r *Repo) Export(ctx context.Context, w io.Writer, format string, filter JobFilter) (int, error) {
+	return export(ctx, r, w, format, filter)
+}
+
+// export implements Export on top of a store's ListJobs and RemindersFor.
+func export(ctx context.Context, s Store, w io.Writer, format string, filter JobFilter) (int, error) {
+	var (
+		write func(exportRecord) error
+		flush = func() error { return nil }
+	)
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportColumns); err != nil {
+			return 0, err
+		}
+
+		write = func(rec exportRecord) error {
+			return cw.Write(rec.csv())
+		}
+
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+
+		write = func(rec exportRecord) error {
+			return enc.Encode(rec)
+		}
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	filter.Cursor, filter.Count, filter.Limit = "", false, exportPage
+
+	var (
+		n    int
+		locs = exportLocations{}
+	)
+
+	for {
+		page, err := s.ListJobs(ctx, filter)
+		if err != nil {
+			return n, err
+		}
+
+		ids := make([]int64, len(page.Jobs))
+		for i, j := range page.Jobs {
+			ids[i] = j.ID
+		}
+
+		reminders, err := s.RemindersFor(ctx, ids)
+		if err != nil {
+			return n, err
+		}
+
+		for _, j := range page.Jobs {
+			j.Reminders = reminders[j.ID]
+			if err := write(toExportRecord(j, locs)); err != nil {
+				return n, err
+			}
+
+			n++
+		}
+
+		if err := flush(); err != nil {
+			return n, err
+		}
+
+		if f, ok := w.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+
+		if page.Next == "" {
+			return n, nil
+		}
+
+		filter.Cursor = page.Next
+	}
+}
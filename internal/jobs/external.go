@@ -0,0 +1,318 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"time"
+)
+
+// SyncResult lists the jobs a SyncExternal call touched.
+type SyncResult struct {
+	Created   []int64
+	Updated   []int64
+	Unchanged []int64
+	Cancelled []int64
+}
+
+// IDs returns the created, updated and cancelled jobs, whose timers need
+// re-arming.
+func (s SyncResult) IDs() []int64 {
+	return slices.Concat(s.Created, s.Updated, s.Cancelled)
+}
+
+// externalJob is the state of a job that a re-import or an edit compares
+// against.
+type externalJob struct {
+	Job
+	offsets []int // of its own pending or delivered reminders
+}
+
+// SyncExternal makes the jobs imported under series match js, in one
+// transaction. A job belongs to the series if its external id is series
+// itself or starts with series + "/", so each instance of a recurring event
+// can have its own job. Jobs in js are matched by ExternalID: new ones are
+// inserted and pending ones updated in place, replacing their pending
+// reminders; a Status of "cancelled" cancels the job. Pending jobs of the
+// series missing from js that run within [from, to] are cancelled, as
+// their instance was removed. Jobs that are no longer pending are left
+// alone.
+func (r *Repo) SyncExternal(ctx context.Context, series string, js []*Job, from, to time.Time) (SyncResult, error) {
+	var res SyncResult
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+
+	defer tx.Rollback()
+
+	existing, err := loadExternal(ctx, tx, series)
+	if err != nil {
+		return res, err
+	}
+
+	seen := make(map[string]bool, len(js))
+
+	for _, j := range js {
+		seen[j.ExternalID] = true
+
+		ex, ok := existing[j.ExternalID]
+
+		switch {
+		case !ok && j.Status == "cancelled":
+			continue
+		case !ok:
+			if err := insertJob(ctx, tx, j); err != nil {
+				return res, err
+			}
+
+			j.Status = "pending"
+			res.Created = append(res.Created, j.ID)
+		case ex.Status != "pending":
+			j.ID = ex.ID
+			res.Unchanged = append(res.Unchanged, ex.ID)
+		case j.Status == "cancelled":
+			if err := cancelJob(ctx, tx, ex.ID, "cancelled at the source"); err != nil {
+				return res, err
+			}
+
+			j.ID = ex.ID
+			res.Cancelled = append(res.Cancelled, ex.ID)
+		case sameExternal(ex, j):
+			j.ID = ex.ID
+			res.Unchanged = append(res.Unchanged, ex.ID)
+		default:
+			j.ID = ex.ID
+			if err := updateExternal(ctx, tx, j); err != nil {
+				return res, err
+			}
+
+			res.Updated = append(res.Updated, ex.ID)
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(existing)) {
+		ex := existing[id]
+		if seen[id] || ex.Status != "pending" || ex.RunAtUTC.Before(from) || ex.RunAtUTC.After(to) {
+			continue
+		}
+
+		if err := cancelJob(ctx, tx, ex.ID, "removed at the source"); err != nil {
+			return res, err
+		}
+
+		res.Cancelled = append(res.Cancelled, ex.ID)
+	}
+
+	return res, tx.Commit()
+}
+
+func loadExternal(ctx context.Context, tx *sql.Tx, series string) (map[string]*externalJob, error) {
+	rows, err := tx.QueryContext(ctx, `
+	  SELECT `+jobColumns+` FROM jobs
+	  WHERE external_id = ? OR substr(external_id, 1, ?) = ?`,
+		series, len(series)+1, series+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*externalJob, len(list))
+
+	for _, j := range list {
+		ex, err := loadCurrent(ctx, tx, j)
+		if err != nil {
+			return nil, err
+		}
+
+		res[j.ExternalID] = ex
+	}
+
+	return res, nil
+}
+
+// loadCurrent reads the offsets and labels of a job.
+func loadCurrent(ctx context.Context, tx *sql.Tx, j Job) (*externalJob, error) {
+	ex := &externalJob{Job: j}
+
+	rem, err := tx.QueryContext(ctx, `
+	  SELECT DISTINCT offset_minutes FROM job_reminders
+	  WHERE job_id = ? AND snoozed_from IS NULL AND status IN ('pending', 'enqueued')
+	  ORDER BY offset_minutes DESC`, j.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for rem.Next() {
+		var o int
+		if err := rem.Scan(&o); err != nil {
+			rem.Close()
+			return nil, err
+		}
+
+		ex.offsets = append(ex.offsets, o)
+	}
+
+	rem.Close()
+
+	if err := rem.Err(); err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string)
+
+	lrows, err := tx.QueryContext(ctx, `SELECT key, value FROM job_labels WHERE job_id = ?`, j.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for lrows.Next() {
+		var k, v string
+		if err := lrows.Scan(&k, &v); err != nil {
+			lrows.Close()
+			return nil, err
+		}
+
+		labels[k] = v
+	}
+
+	lrows.Close()
+
+	if err := lrows.Err(); err != nil {
+		return nil, err
+	}
+
+	ex.Labels = labels
+
+	return ex, nil
+}
+
+func jobOffsets(j *Job) []int {
+	var res []int
+
+	for _, r := range j.Reminders {
+		if !slices.Contains(res, r.OffsetMinutes) {
+			res = append(res, r.OffsetMinutes)
+		}
+	}
+
+	if len(res) == 0 {
+		res = []int{j.RemindBeforeMinutes}
+	}
+
+	slices.Sort(res)
+	slices.Reverse(res)
+
+	return res
+}
+
+func sameExternal(ex *externalJob, j *Job) bool {
+	labels := j.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return ex.Title == j.Title && ex.TZ == j.TZ && ex.RunAtUTC.Equal(j.RunAtUTC) &&
+		ex.Payload == j.Payload && slices.Equal(ex.offsets, jobOffsets(j)) &&
+		maps.Equal(ex.Labels, labels)
+}
+
+// updateExternal rewrites a pending job and replaces its pending
+// reminders with ones for j's offsets at its new run time.
+func updateExternal(ctx context.Context, tx *sql.Tx, j *Job) error {
+	offsets := jobOffsets(j)
+
+	_, err := tx.ExecContext(ctx, `
+	  UPDATE jobs SET title = ?, tz = ?, run_at_utc = ?, remind_before_minutes = ?, payload = ?
+	  WHERE id = ?`,
+		j.Title, j.TZ, j.RunAtUTC, offsets[0], j.Payload, j.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceReminders(ctx, tx, j, offsets); err != nil {
+		return err
+	}
+
+	_, err = addEvent(ctx, tx, j.ID, 0, EventEdited, "re-imported")
+
+	return err
+}
+
+// replaceReminders replaces the pending reminders of a job with ones for
+// offsets at its run time and its labels with j.Labels, then settles it.
+func replaceReminders(ctx context.Context, tx *sql.Tx, j *Job, offsets []int) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_reminders WHERE job_id = ? AND status = 'pending'`, j.ID); err != nil {
+		return err
+	}
+
+	// A reminder already delivered for the same time is not sent again.
+	for _, o := range offsets {
+		due := j.RunAtUTC.Add(-time.Duration(o) * time.Minute)
+
+		var n int
+		err := tx.QueryRowContext(ctx, `
+		  SELECT COUNT(*) FROM job_reminders
+		  WHERE job_id = ? AND due_at_utc = ? AND status != 'cancelled'`, j.ID, due).Scan(&n)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		  INSERT INTO job_reminders(job_id, offset_minutes, due_at_utc, status)
+		  VALUES (?, ?, ?, 'pending')`, j.ID, o, due)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_labels WHERE job_id = ?`, j.ID); err != nil {
+		return err
+	}
+
+	if err := insertLabels(ctx, tx, j.ID, j.Labels); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, settleJobsSQL+` AND id = ?`, j.ID)
+
+	return err
+}
+
+func cancelJob(ctx context.Context, tx *sql.Tx, id int64, details string) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE jobs SET status = 'cancelled' WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET status = 'cancelled' WHERE job_id = ? AND status = 'pending'`, id); err != nil {
+		return err
+	}
+
+	_, err := addEvent(ctx, tx, id, 0, EventCancelled, details)
+
+	return err
+}
+
+// SyncExternal syncs a series like Repo.SyncExternal and re-arms the
+// touched jobs.
+func (s *Scheduler) SyncExternal(ctx context.Context, series string, js []*Job, from, to time.Time) (SyncResult, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	res, err := s.Repo.SyncExternal(ctx, series, js, from, to)
+	if err != nil {
+		return res, err
+	}
+
+	return res, s.rearm(ctx, res.IDs())
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"time"
+)
+
+const (
+	// feedLimit caps the jobs in one feed.
+	feedLimit = 1000
+	// feedLookback keeps recently passed jobs in feeds.
+	feedLookback = 7 * 24 * time.Hour
+)
+
+// Feed is a calendar subscription to the jobs matching a filter. The token
+// is the only credential: anyone who has the feed URL can read it.
+type Feed struct {
+	Token     string
+	Name      string
+	Filter    string // query string, see ParseFilter
+	CreatedAt time.Time
+}
+
+// JobFilter parses the feed's filter.
+func (f Feed) JobFilter() (JobFilter, error) {
+	q, err := url.ParseQuery(f.Filter)
+	if err != nil {
+		return JobFilter{}, err
+	}
+
+	return ParseFilter(q)
+}
+
+func newFeedToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// newFeed is an unsaved feed with a new token.
+func newFeed(name string, filter JobFilter) Feed {
+	q := filter.Query()
+	q.Del("limit")
+	q.Del("total")
+
+	return Feed{Token: newFeedToken(), Name: name, Filter: q.Encode()}
+}
+
+// CreateFeed stores a feed of the jobs matching filter under a new random
+// token. Paging in the filter is dropped.
+func (r *Repo) CreateFeed(ctx context.Context, name string, filter JobFilter) (Feed, error) {
+	f := newFeed(name, filter)
+
+	err := r.DB.QueryRowContext(ctx, `
+	  INSERT INTO feeds(token, name, filter) VALUES (?, ?, ?)
+	  RETURNING created_at`, f.Token, f.Name, f.Filter).Scan(&f.CreatedAt)
+
+	return f, err
+}
+
+// Feed returns the feed with the given token or sql.ErrNoRows.
+func (r *Repo) Feed(ctx context.Context, token string) (Feed, error) {
+	var f Feed
+
+	err := r.DB.QueryRowContext(ctx, `SELECT token, name, filter, created_at FROM feeds WHERE token = ?`, token).
+		Scan(&f.Token, &f.Name, &f.Filter, &f.CreatedAt)
+
+	return f, err
+}
+
+func (r *Repo) ListFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT token, name, filter, created_at FROM feeds ORDER BY created_at, name`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var res []Feed
+
+	for rows.Next() {
+		var f Feed
+		if err := rows.Scan(&f.Token, &f.Name, &f.Filter, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		res = append(res, f)
+	}
+
+	return res, rows.Err()
+}
+
+func (r *Repo) DeleteFeed(ctx context.Context, token string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM feeds WHERE token = ?`, token)
+
+	return err
+}
+
+// FeedJobs returns the jobs of a feed that run from a week before now on,
+// ordered by run time, with their labels and reminders.
+func (r *Repo) FeedJobs(ctx context.Context, f Feed, now time.Time) ([]Job, error) {
+	return feedJobs(ctx, r, f, now)
+}
+
+// feedJobs implements FeedJobs on top of a store's ListJobs and
+// RemindersFor.
+func feedJobs(ctx context.Context, s Store, f Feed, now time.Time) ([]Job, error) {
+	filter, err := f.JobFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	if from := now.Add(-feedLookback).UTC(); filter.RunFrom.Before(from) {
+		filter.RunFrom = from
+	}
+
+	filter.Sort, filter.Desc, filter.Limit = SortRun, false, feedLimit
+
+	page, err := s.ListJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(page.Jobs))
+	for i, j := range page.Jobs {
+		ids[i] = j.ID
+	}
+
+	reminders, err := s.RemindersFor(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range page.Jobs {
+		page.Jobs[i].Reminders = reminders[page.Jobs[i].ID]
+	}
+
+	return page.Jobs, nil
+}
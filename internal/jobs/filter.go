@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/db"
+)
+
+// SortField is a column the job list can be ordered by.
+type SortField string
+
+const (
+	SortDue     SortField = "due"
+	SortRun     SortField = "run"
+	SortCreated SortField = "created"
+	SortTitle   SortField = "title"
+	SortID      SortField = "id"
+)
+
+var SortFields = []SortField{SortDue, SortRun, SortCreated, SortTitle, SortID}
+
+var sortColumns = map[SortField]string{
+	SortDue:     "jobs.due_at_utc",
+	SortRun:     "jobs.run_at_utc",
+	SortCreated: "jobs.created_at",
+	SortTitle:   "lower(jobs.title)",
+	SortID:      "jobs.id",
+}
+
+func (f SortField) Valid() bool {
+	_, ok := sortColumns[f]
+
+	return ok
+}
+
+// createdAtLayout is how SQLite's CURRENT_TIMESTAMP stores created_at;
+// bounds on it are bound in the same layout so they compare as text.
+const createdAtLayout = "2006-01-02 15:04:05"
+
+// JobFilter selects a page of jobs. Zero values leave a criterion out; time
+// ranges are [From, To) in UTC.
+type JobFilter struct {
+	Status string
+	Labels Selector
+	Q      string // full-text search over title and payload
+	TZ     string
+
+	DueFrom, DueTo         time.Time
+	RunFrom, RunTo         time.Time
+	CreatedFrom, CreatedTo time.Time
+
+	// Sort defaults to relevance when searching and to SortDue otherwise.
+	// Ties are broken by id in the same direction.
+	Sort SortField
+	Desc bool
+
+	// Page is used by GetJobsPaginated. ListJobs instead continues from
+	// Cursor, a token from a previous CursorPage, and counts the matching
+	// jobs only if Count is set.
+	Page   int
+	Cursor string
+	Count  bool
+	Limit  int
+}
+
+// Unbounded reports whether the filter has no criteria and so matches
+// every job.
+func (f JobFilter) Unbounded() bool {
+	where, _ := f.where(db.SQLite)
+
+	return where == "1=1"
+}
+
+// where renders the filter as an SQL condition on the jobs table, joined
+// with jobs_fts when the filter searches SQLite.
+func (f JobFilter) where(d db.Dialect) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	if f.Status != "" && f.Status != "all" {
+		add("jobs.status = ?", f.Status)
+	}
+
+	if f.searching() {
+		if d == db.Postgres {
+			add("jobs.search @@ to_tsquery('simple', ?)", tsQuery(f.Q))
+		} else {
+			add("jobs_fts MATCH ?", ftsQuery(f.Q))
+		}
+	}
+
+	if f.TZ != "" {
+		add("jobs.tz = ?", f.TZ)
+	}
+
+	if !f.DueFrom.IsZero() {
+		add("jobs.due_at_utc >= ?", f.DueFrom.UTC())
+	}
+
+	if !f.DueTo.IsZero() {
+		add("jobs.due_at_utc < ?", f.DueTo.UTC())
+	}
+
+	if !f.RunFrom.IsZero() {
+		add("jobs.run_at_utc >= ?", f.RunFrom.UTC())
+	}
+
+	if !f.RunTo.IsZero() {
+		add("jobs.run_at_utc < ?", f.RunTo.UTC())
+	}
+
+	if !f.CreatedFrom.IsZero() {
+		add("jobs.created_at >= ?", f.CreatedFrom.UTC().Format(createdAtLayout))
+	}
+
+	if !f.CreatedTo.IsZero() {
+		add("jobs.created_at < ?", f.CreatedTo.UTC().Format(createdAtLayout))
+	}
+
+	labelConds, labelArgs := f.Labels.where()
+	conds = append(conds, labelConds...)
+	args = append(args, labelArgs...)
+
+	if len(conds) == 0 {
+		return "1=1", nil
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// Ranked reports whether the filter orders by search relevance, which
+// only GetJobsPaginated supports.
+func (f JobFilter) Ranked() bool {
+	return !f.Sort.Valid() && f.searching()
+}
+
+func (f JobFilter) searching() bool {
+	return ftsQuery(f.Q) != ""
+}
+
+// from is the FROM clause matching where.
+func (f JobFilter) from(d db.Dialect) string {
+	if f.searching() && d == db.SQLite {
+		return "jobs JOIN jobs_fts ON jobs_fts.rowid = jobs.id"
+	}
+
+	return "jobs"
+}
+
+// orderBy renders the ORDER BY clause for the filter and its arguments.
+func (f JobFilter) orderBy(d db.Dialect) (string, []any) {
+	dir := " ASC"
+	if f.Desc {
+		dir = " DESC"
+	}
+
+	if f.Ranked() {
+		if d == db.Postgres {
+			return "ts_rank('" + tsRankWeights + "', jobs.search, to_tsquery('simple', ?)) DESC, jobs.due_at_utc ASC, jobs.id ASC", []any{tsQuery(f.Q)}
+		}
+
+		return "bm25(jobs_fts, " + searchWeights + "), jobs.due_at_utc ASC, jobs.id ASC", nil
+	}
+
+	col := f.sortColumn()
+
+	return col + dir + ", jobs.id" + dir, nil
+}
+
+// sortColumn is the column jobs are ordered by when not ranked.
+func (f JobFilter) sortColumn() string {
+	if col, ok := sortColumns[f.Sort]; ok {
+		return col
+	}
+
+	return sortColumns[SortDue]
+}
+
+// Range bounds in query strings are either dates, which cover whole UTC
+// days on both ends, or RFC 3339 instants used as given.
+const dateLayout = "2006-01-02"
+
+func parseBound(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+
+		return t, nil
+	}
+
+	if t, err := time.Parse("2006-01-02T15:04", s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want YYYY-MM-DD or RFC 3339", s)
+	}
+
+	return t.UTC(), nil
+}
+
+// FormatBound renders a filter bound as it is written in query strings;
+// end says whether t is an exclusive upper bound.
+func FormatBound(t time.Time, end bool) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	t = t.UTC()
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		if end {
+			t = t.AddDate(0, 0, -1)
+		}
+
+		return t.Format(dateLayout)
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// ParseFilter reads a job filter from the query parameters shared by the
+// admin index, the JSON API and exports.
+func ParseFilter(q url.Values) (JobFilter, error) {
+	f := JobFilter{
+		Status: q.Get("status"),
+		Q:      strings.TrimSpace(q.Get("q")),
+		TZ:     q.Get("tz"),
+		Sort:   SortField(q.Get("sort")),
+	}
+
+	var err error
+
+	if f.Labels, err = ParseSelector(q.Get("labels")); err != nil {
+		return f, err
+	}
+
+	if f.Sort != "" && !f.Sort.Valid() {
+		return f, fmt.Errorf("invalid sort field %q", f.Sort)
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		return f, fmt.Errorf("order must be asc or desc")
+	}
+
+	bounds := []struct {
+		name string
+		dst  *time.Time
+		end  bool
+	}{
+		{"due_from", &f.DueFrom, false},
+		{"due_to", &f.DueTo, true},
+		{"run_from", &f.RunFrom, false},
+		{"run_to", &f.RunTo, true},
+		{"created_from", &f.CreatedFrom, false},
+		{"created_to", &f.CreatedTo, true},
+	}
+
+	for _, b := range bounds {
+		if *b.dst, err = parseBound(q.Get(b.name), b.end); err != nil {
+			return f, fmt.Errorf("%s: %w", b.name, err)
+		}
+	}
+
+	f.Page, _ = strconv.Atoi(q.Get("page"))
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+	f.Cursor = q.Get("cursor")
+	f.Count, _ = strconv.ParseBool(q.Get("total"))
+
+	return f, nil
+}
+
+// Query is the inverse of ParseFilter, without the page or cursor.
+func (f JobFilter) Query() url.Values {
+	q := url.Values{}
+
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+
+	set("status", f.Status)
+	set("labels", f.Labels.String())
+	set("q", f.Q)
+	set("tz", f.TZ)
+	set("due_from", FormatBound(f.DueFrom, false))
+	set("due_to", FormatBound(f.DueTo, true))
+	set("run_from", FormatBound(f.RunFrom, false))
+	set("run_to", FormatBound(f.RunTo, true))
+	set("created_from", FormatBound(f.CreatedFrom, false))
+	set("created_to", FormatBound(f.CreatedTo, true))
+	set("sort", string(f.Sort))
+	if f.Desc {
+		q.Set("order", "desc")
+	}
+	if f.Count {
+		q.Set("total", "true")
+	}
+	q.Set("limit", strconv.Itoa(f.Limit))
+
+	return q
+}
@@ -0,0 +1,272 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	maxLabels          = 20
+	maxLabelValueBytes = 255
+)
+
+var labelKeyRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+
+func validLabel(key, value string) error {
+	if !labelKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+
+	if len(value) > maxLabelValueBytes || strings.ContainsAny(value, ",\n") {
+		return fmt.Errorf("invalid value for label %q", key)
+	}
+
+	return nil
+}
+
+// ValidateLabels checks keys and values as ParseLabels does.
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+
+	for k, v := range labels {
+		if err := validLabel(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseLabels parses a comma separated list of key=value pairs such as
+// "team=ops, customer=acme". A later pair overrides an earlier one with the
+// same key.
+func ParseLabels(s string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, want key=value", part)
+		}
+
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if err := validLabel(k, v); err != nil {
+			return nil, err
+		}
+
+		res[k] = v
+	}
+
+	if len(res) > maxLabels {
+		return nil, fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+
+	return res, nil
+}
+
+// FormatLabels is the inverse of ParseLabels, with keys sorted.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + labels[k]
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Label selector operators.
+const (
+	OpEquals    = "="
+	OpNotEquals = "!="
+	OpExists    = "exists"
+	OpNotExists = "!exists"
+)
+
+// Requirement is one term of a Selector. Value is unused for the exists
+// operators.
+type Requirement struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+func (r Requirement) String() string {
+	switch r.Op {
+	case OpExists:
+		return r.Key
+	case OpNotExists:
+		return "!" + r.Key
+	default:
+		return r.Key + r.Op + r.Value
+	}
+}
+
+// Selector matches jobs whose labels satisfy all of its requirements. As
+// with Kubernetes selectors, "key!=value" also matches jobs without key.
+type Selector []Requirement
+
+// ParseSelector parses a comma separated selector such as
+// "team=ops,env!=prod,urgent,!archived".
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var req Requirement
+
+		if k, v, ok := strings.Cut(part, "!="); ok {
+			req = Requirement{Key: strings.TrimSpace(k), Op: OpNotEquals, Value: strings.TrimSpace(v)}
+		} else if k, v, ok := strings.Cut(part, "="); ok {
+			v = strings.TrimPrefix(v, "=")
+			req = Requirement{Key: strings.TrimSpace(k), Op: OpEquals, Value: strings.TrimSpace(v)}
+		} else if k, ok := strings.CutPrefix(part, "!"); ok {
+			req = Requirement{Key: strings.TrimSpace(k), Op: OpNotExists}
+		} else {
+			req = Requirement{Key: part, Op: OpExists}
+		}
+
+		if err := validLabel(req.Key, req.Value); err != nil {
+			return nil, err
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// where renders the selector as SQL conditions on the jobs table.
+func (s Selector) where() ([]string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	for _, r := range s {
+		switch r.Op {
+		case OpEquals:
+			conds = append(conds, `EXISTS (SELECT 1 FROM job_labels l WHERE l.job_id = jobs.id AND l.key = ? AND l.value = ?)`)
+			args = append(args, r.Key, r.Value)
+		case OpNotEquals:
+			conds = append(conds, `NOT EXISTS (SELECT 1 FROM job_labels l WHERE l.job_id = jobs.id AND l.key = ? AND l.value = ?)`)
+			args = append(args, r.Key, r.Value)
+		case OpExists:
+			conds = append(conds, `EXISTS (SELECT 1 FROM job_labels l WHERE l.job_id = jobs.id AND l.key = ?)`)
+			args = append(args, r.Key)
+		case OpNotExists:
+			conds = append(conds, `NOT EXISTS (SELECT 1 FROM job_labels l WHERE l.job_id = jobs.id AND l.key = ?)`)
+			args = append(args, r.Key)
+		}
+	}
+
+	return conds, args
+}
+
+func insertLabels(ctx context.Context, tx *sql.Tx, jobID int64, labels map[string]string) error {
+	for k, v := range labels {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO job_labels(job_id, key, value) VALUES (?, ?, ?)`, jobID, k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LabelsFor returns the labels of the given jobs, keyed by job id. Jobs
+// without labels are absent from the result.
+func (r *Repo) LabelsFor(ctx context.Context, jobIDs []int64) (map[int64]map[string]string, error) {
+	res := make(map[int64]map[string]string)
+
+	for start := 0; start < len(jobIDs); start += maxBatchArgs {
+		chunk := jobIDs[start:min(start+maxBatchArgs, len(jobIDs))]
+
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+
+		rows, err := r.DB.QueryContext(ctx, `
+		  SELECT job_id, key, value
+		  FROM job_labels
+		  WHERE job_id IN (`+placeholders(len(chunk))+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var (
+				id   int64
+				k, v string
+			)
+
+			if err := rows.Scan(&id, &k, &v); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			if res[id] == nil {
+				res[id] = make(map[string]string)
+			}
+
+			res[id][k] = v
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// attachLabels fills in Labels on each job.
+func (r *Repo) attachLabels(ctx context.Context, js []Job) error {
+	ids := make([]int64, len(js))
+	for i, j := range js {
+		ids[i] = j.ID
+	}
+
+	labels, err := r.LabelsFor(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range js {
+		js[i].Labels = labels[js[i].ID]
+	}
+
+	return nil
+}
@@ -0,0 +1,1186 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+)
+
+// MemStore is a Store that keeps everything in memory, for tests and for
+// trying the service out without a database. It follows Repo's semantics,
+// except that search results are ranked by the number of title and
+// payload matches rather than by bm25.
+type MemStore struct {
+	mu sync.Mutex
+
+	jobs      map[int64]*Job // with Labels, without Reminders
+	reminders map[int64]*memReminder
+	feeds     map[string]Feed
+	calendars map[string][]byte // JSON, as Repo stores them
+	events    []Event           // oldest first
+
+	lastJobID, lastReminderID, lastEventID int64
+}
+
+type memReminder struct {
+	Reminder
+	claimedAt time.Time
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		jobs:      make(map[int64]*Job),
+		reminders: make(map[int64]*memReminder),
+		feeds:     make(map[string]Feed),
+		calendars: make(map[string][]byte),
+	}
+}
+
+// memNow is the current time as a database default would store it.
+func memNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// job returns a copy of a stored job, with its labels if withLabels is set.
+func (m *MemStore) job(j *Job, withLabels bool) Job {
+	res := *j
+	res.Labels = nil
+
+	if withLabels {
+		res.Labels = maps.Clone(j.Labels)
+	}
+
+	return res
+}
+
+// remindersOf returns the reminders of a job ordered by due time.
+func (m *MemStore) remindersOf(jobID int64) []*memReminder {
+	var res []*memReminder
+
+	for _, r := range m.reminders {
+		if r.JobID == jobID {
+			res = append(res, r)
+		}
+	}
+
+	slices.SortFunc(res, func(a, b *memReminder) int {
+		return cmp.Or(a.DueAtUTC.Compare(b.DueAtUTC), cmp.Compare(a.ID, b.ID))
+	})
+
+	return res
+}
+
+func (m *MemStore) addReminder(r Reminder) *memReminder {
+	m.lastReminderID++
+	r.ID = m.lastReminderID
+	r.DueAtUTC = r.DueAtUTC.UTC()
+
+	mr := &memReminder{Reminder: r}
+	m.reminders[r.ID] = mr
+
+	return mr
+}
+
+// addEvent records an event of one job like addEvent.
+func (m *MemStore) addEvent(ctx context.Context, jobID, reminderID int64, kind, details string) Event {
+	m.lastEventID++
+
+	e := Event{
+		ID:         m.lastEventID,
+		JobID:      jobID,
+		ReminderID: reminderID,
+		Kind:       kind,
+		Actor:      ActorFrom(ctx),
+		ActorNote:  ActorNoteFrom(ctx),
+		Details:    details,
+		CreatedAt:  memNow(),
+	}
+	m.events = append(m.events, e)
+
+	return e
+}
+
+// dropReminders deletes the reminders drop accepts, unlinking the events
+// and snoozes that refer to them as the foreign keys do.
+func (m *MemStore) dropReminders(drop func(r *memReminder) bool) {
+	for id, r := range m.reminders {
+		if drop(r) {
+			delete(m.reminders, id)
+		}
+	}
+
+	for _, r := range m.reminders {
+		if m.reminders[r.SnoozedFrom] == nil {
+			r.SnoozedFrom = 0
+		}
+	}
+
+	for i, e := range m.events {
+		if m.reminders[e.ReminderID] == nil {
+			m.events[i].ReminderID = 0
+		}
+	}
+}
+
+// settle recomputes a pending job from its reminders like settleJobsSQL.
+func (m *MemStore) settle(jobID int64) {
+	j := m.jobs[jobID]
+	if j == nil || j.Status != "pending" {
+		return
+	}
+
+	rems := m.remindersOf(jobID)
+
+	var (
+		pending, enqueued bool
+		due               time.Time
+	)
+
+	for _, r := range rems {
+		switch r.Status {
+		case "pending":
+			if !pending {
+				due = r.DueAtUTC
+			}
+
+			pending = true
+		case "enqueued":
+			enqueued = true
+		}
+	}
+
+	switch {
+	case pending:
+		j.DueAtUTC = due
+	case enqueued:
+		j.Status = "enqueued"
+	case len(rems) > 0:
+		j.Status = rems[len(rems)-1].Status
+	}
+}
+
+// checkExternalIDs fails if a job in batch would share its external id
+// with a stored job or another job in batch.
+func (m *MemStore) checkExternalIDs(batch []*Job) error {
+	seen := make(map[string]bool)
+
+	for _, j := range m.jobs {
+		seen[j.ExternalID] = true
+	}
+
+	for _, j := range batch {
+		if j.ExternalID == "" {
+			continue
+		}
+
+		if seen[j.ExternalID] {
+			return fmt.Errorf("external id %q already exists", j.ExternalID)
+		}
+
+		seen[j.ExternalID] = true
+	}
+
+	return nil
+}
+
+// insert stores a job like insertJob.
+func (m *MemStore) insert(ctx context.Context, j *Job) {
+	if len(j.Reminders) == 0 {
+		j.Reminders = OffsetReminders([]int{j.RemindBeforeMinutes})
+	}
+
+	m.lastJobID++
+	j.ID = m.lastJobID
+
+	for i := range j.Reminders {
+		rem := &j.Reminders[i]
+		rem.DueAtUTC = j.RunAtUTC.Add(-time.Duration(rem.OffsetMinutes) * time.Minute)
+		rem.Status = "pending"
+
+		if i == 0 || rem.DueAtUTC.Before(j.DueAtUTC) {
+			j.DueAtUTC = rem.DueAtUTC
+			j.RemindBeforeMinutes = rem.OffsetMinutes
+		}
+	}
+
+	stored := *j
+	stored.RunAtUTC, stored.DueAtUTC = j.RunAtUTC.UTC(), j.DueAtUTC.UTC()
+	stored.Status = "pending"
+	stored.CreatedAt = memNow()
+	stored.Reminders = nil
+	stored.Labels = nil
+
+	if len(j.Labels) > 0 {
+		stored.Labels = maps.Clone(j.Labels)
+	}
+
+	m.jobs[j.ID] = &stored
+
+	for i := range j.Reminders {
+		rem := &j.Reminders[i]
+		rem.JobID = j.ID
+		rem.ID = m.addReminder(Reminder{JobID: j.ID, OffsetMinutes: rem.OffsetMinutes, DueAtUTC: rem.DueAtUTC, Status: "pending"}).ID
+	}
+
+	details := ""
+	if j.ExternalID != "" {
+		details = "imported as " + j.ExternalID
+	}
+
+	m.addEvent(ctx, j.ID, 0, EventCreated, details)
+}
+
+func (m *MemStore) Insert(ctx context.Context, j *Job) (int64, error) {
+	if err := m.InsertBatch(ctx, []*Job{j}); err != nil {
+		return 0, err
+	}
+
+	return j.ID, nil
+}
+
+func (m *MemStore) InsertBatch(ctx context.Context, batch []*Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkExternalIDs(batch); err != nil {
+		return err
+	}
+
+	for _, j := range batch {
+		m.insert(ctx, j)
+	}
+
+	return nil
+}
+
+func (m *MemStore) Get(ctx context.Context, id int64) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, sql.ErrNoRows
+	}
+
+	return m.job(j, false), nil
+}
+
+func (m *MemStore) GetUpcoming(ctx context.Context, limit int) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []Job
+
+	for _, j := range m.jobs {
+		if j.Status == "pending" || j.Status == "enqueued" {
+			res = append(res, m.job(j, false))
+		}
+	}
+
+	slices.SortFunc(res, func(a, b Job) int {
+		return cmp.Or(a.DueAtUTC.Compare(b.DueAtUTC), cmp.Compare(a.ID, b.ID))
+	})
+
+	return res[:min(max(limit, 0), len(res))], nil
+}
+
+func (m *MemStore) TimeZones(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []string
+
+	for _, j := range m.jobs {
+		if !slices.Contains(res, j.TZ) {
+			res = append(res, j.TZ)
+		}
+	}
+
+	slices.Sort(res)
+
+	return res, nil
+}
+
+// searchTokens splits text into lower-cased words like FTS5's default
+// tokenizer.
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchHits counts the matches of a query word in text: its words in a
+// row, the last one as a prefix, like the prefix phrase ftsQuery makes.
+func searchHits(word, text []string) int {
+	if len(word) == 0 {
+		return 0
+	}
+
+	n := 0
+
+	for i := 0; i+len(word) <= len(text); i++ {
+		last := len(word) - 1
+		if slices.Equal(word[:last], text[i:i+last]) && strings.HasPrefix(text[i+last], word[last]) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// searchScore is 0 if a job does not match every word of q and otherwise
+// grows with its matches, title matches weighing as searchWeights does.
+func searchScore(j *Job, q string) int {
+	title, payload := searchTokens(j.Title), searchTokens(j.Payload)
+	score := 0
+
+	for _, w := range strings.Fields(q) {
+		word := searchTokens(strings.ReplaceAll(w, `"`, ""))
+		if len(word) == 0 {
+			continue
+		}
+
+		hits := 10*searchHits(word, title) + searchHits(word, payload)
+		if hits == 0 {
+			return 0
+		}
+
+		score += hits
+	}
+
+	return score
+}
+
+// matches reports whether a job satisfies the filter, as JobFilter.where
+// does.
+func (f JobFilter) matches(j *Job) bool {
+	if f.Status != "" && f.Status != "all" && j.Status != f.Status {
+		return false
+	}
+
+	if f.searching() && searchScore(j, f.Q) == 0 {
+		return false
+	}
+
+	if f.TZ != "" && j.TZ != f.TZ {
+		return false
+	}
+
+	within := func(t, from, to time.Time) bool {
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+	}
+
+	if !within(j.DueAtUTC, f.DueFrom, f.DueTo) || !within(j.RunAtUTC, f.RunFrom, f.RunTo) {
+		return false
+	}
+
+	// created_at is compared to the second.
+	second := func(t time.Time) time.Time { return t.UTC().Truncate(time.Second) }
+	if !within(j.CreatedAt, second(f.CreatedFrom), second(f.CreatedTo)) {
+		return false
+	}
+
+	return f.Labels.matches(j.Labels)
+}
+
+// matches reports whether labels satisfy the selector.
+func (s Selector) matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.Key]
+
+		switch r.Op {
+		case OpEquals:
+			if !ok || v != r.Value {
+				return false
+			}
+		case OpNotEquals:
+			if ok && v == r.Value {
+				return false
+			}
+		case OpExists:
+			if !ok {
+				return false
+			}
+		case OpNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sortKey renders a job's sort column so that keys compare as strings in
+// the column's order; it serves as the cursor key of ListJobs.
+func (f JobFilter) sortKey(j *Job) string {
+	const timeKey = "2006-01-02T15:04:05.000000000Z"
+
+	switch f.Sort {
+	case SortRun:
+		return j.RunAtUTC.UTC().Format(timeKey)
+	case SortCreated:
+		return j.CreatedAt.UTC().Format(timeKey)
+	case SortTitle:
+		return strings.ToLower(j.Title)
+	case SortID:
+		return fmt.Sprintf("%020d", j.ID)
+	default:
+		return j.DueAtUTC.UTC().Format(timeKey)
+	}
+}
+
+// compareJobs orders jobs by the filter's sort column and id, descending if
+// desc is set.
+func (f JobFilter) compareJobs(a, b *Job, desc bool) int {
+	c := cmp.Or(strings.Compare(f.sortKey(a), f.sortKey(b)), cmp.Compare(a.ID, b.ID))
+	if desc {
+		return -c
+	}
+
+	return c
+}
+
+// matching returns the jobs that satisfy the filter, unordered.
+func (m *MemStore) matching(f JobFilter) []*Job {
+	var res []*Job
+
+	for _, j := range m.jobs {
+		if f.matches(j) {
+			res = append(res, j)
+		}
+	}
+
+	return res
+}
+
+func (m *MemStore) GetJobsPaginated(ctx context.Context, filter JobFilter) (*JobPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	if filter.Limit < 1 {
+		filter.Limit = 50
+	}
+
+	list := m.matching(filter)
+
+	if filter.Ranked() {
+		scores := make(map[int64]int, len(list))
+		for _, j := range list {
+			scores[j.ID] = searchScore(j, filter.Q)
+		}
+
+		slices.SortFunc(list, func(a, b *Job) int {
+			return cmp.Or(cmp.Compare(scores[b.ID], scores[a.ID]), a.DueAtUTC.Compare(b.DueAtUTC), cmp.Compare(a.ID, b.ID))
+		})
+	} else {
+		slices.SortFunc(list, func(a, b *Job) int { return filter.compareJobs(a, b, filter.Desc) })
+	}
+
+	total := len(list)
+	offset := min((filter.Page-1)*filter.Limit, total)
+
+	var js []Job
+	for _, j := range list[offset:min(offset+filter.Limit, total)] {
+		js = append(js, m.job(j, true))
+	}
+
+	totalPages := (total + filter.Limit - 1) / filter.Limit
+
+	return &JobPage{
+		Jobs:       js,
+		Total:      total,
+		Page:       filter.Page,
+		Limit:      filter.Limit,
+		TotalPages: totalPages,
+		HasNext:    filter.Page < totalPages,
+		HasPrev:    filter.Page > 1,
+	}, nil
+}
+
+func (m *MemStore) ListJobs(ctx context.Context, filter JobFilter) (*CursorPage, error) {
+	c, err := startList(&filter)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := m.matching(filter)
+
+	page := &CursorPage{Total: -1}
+	if filter.Count {
+		page.Total = len(list)
+	}
+
+	desc := filter.Desc != c.Before
+
+	slices.SortFunc(list, func(a, b *Job) int { return filter.compareJobs(a, b, desc) })
+
+	if filter.Cursor != "" {
+		after := func(j *Job) bool {
+			k := cmp.Or(strings.Compare(filter.sortKey(j), c.Key), cmp.Compare(j.ID, c.ID))
+			if desc {
+				return k < 0
+			}
+
+			return k > 0
+		}
+
+		list = slices.DeleteFunc(list, func(j *Job) bool { return !after(j) })
+	}
+
+	var keys []string
+
+	for _, j := range list[:min(filter.Limit+1, len(list))] {
+		keys = append(keys, filter.sortKey(j))
+		page.Jobs = append(page.Jobs, m.job(j, true))
+	}
+
+	page.fill(filter, c, keys)
+
+	return page, nil
+}
+
+func (m *MemStore) Export(ctx context.Context, w io.Writer, format string, filter JobFilter) (int, error) {
+	return export(ctx, m, w, format, filter)
+}
+
+func (m *MemStore) RemindersFor(ctx context.Context, jobIDs []int64) (map[int64][]Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(map[int64][]Reminder, len(jobIDs))
+
+	for _, id := range jobIDs {
+		for _, r := range m.remindersOf(id) {
+			res[id] = append(res[id], r.Reminder)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *MemStore) LabelsFor(ctx context.Context, jobIDs []int64) (map[int64]map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(map[int64]map[string]string)
+
+	for _, id := range jobIDs {
+		if j := m.jobs[id]; j != nil && len(j.Labels) > 0 {
+			res[id] = maps.Clone(j.Labels)
+		}
+	}
+
+	return res, nil
+}
+
+// pending returns the pending reminders accepted by keep with their jobs
+// and labels, ordered by due time.
+func (m *MemStore) pending(keep func(r *memReminder) bool) []Occurrence {
+	var res []Occurrence
+
+	for _, r := range m.reminders {
+		if r.Status == "pending" && keep(r) {
+			res = append(res, Occurrence{Job: m.job(m.jobs[r.JobID], true), Reminder: r.Reminder})
+		}
+	}
+
+	slices.SortFunc(res, func(a, b Occurrence) int {
+		return cmp.Or(a.Reminder.DueAtUTC.Compare(b.Reminder.DueAtUTC), cmp.Compare(a.Reminder.ID, b.Reminder.ID))
+	})
+
+	return res
+}
+
+func (m *MemStore) LoadPendingBetween(ctx context.Context, from, to time.Time) ([]Occurrence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending(func(r *memReminder) bool {
+		return !r.DueAtUTC.Before(from) && r.DueAtUTC.Before(to)
+	}), nil
+}
+
+func (m *MemStore) PendingOccurrences(ctx context.Context, jobIDs []int64, before time.Time) ([]Occurrence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending(func(r *memReminder) bool {
+		return slices.Contains(jobIDs, r.JobID) && r.DueAtUTC.Before(before)
+	}), nil
+}
+
+func (m *MemStore) Claim(ctx context.Context, rem Reminder, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.reminders[rem.ID]
+	if r == nil || r.Status != "pending" || !r.DueAtUTC.Equal(rem.DueAtUTC) {
+		return false, nil
+	}
+
+	if !r.claimedAt.IsZero() && !r.claimedAt.Before(now.Add(-claimLease)) {
+		return false, nil
+	}
+
+	r.claimedAt = now.UTC()
+
+	return true, nil
+}
+
+func (m *MemStore) HoldClaim(ctx context.Context, reminderID int64, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.reminders[reminderID]; r != nil && r.Status == "pending" && !r.claimedAt.IsZero() && r.claimedAt.Before(until) {
+		r.claimedAt = until.UTC()
+	}
+
+	return nil
+}
+
+func (m *MemStore) Release(ctx context.Context, reminderID int64, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r := m.reminders[reminderID]; r != nil {
+		r.claimedAt = time.Time{}
+		m.addEvent(ctx, r.JobID, r.ID, EventRetried, reason)
+	}
+
+	return nil
+}
+
+// setStatus moves pending reminders to status, records the transition and
+// settles their jobs.
+func (m *MemStore) setStatus(ctx context.Context, ids []int64, status, details string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if r := m.reminders[id]; r != nil && r.Status == "pending" {
+			r.Status = status
+			m.addEvent(ctx, r.JobID, r.ID, status, details)
+			m.settle(r.JobID)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemStore) MarkEnqueued(ctx context.Context, reminderID int64, message string) error {
+	return m.setStatus(ctx, []int64{reminderID}, EventEnqueued, message)
+}
+
+func (m *MemStore) MarkMissed(ctx context.Context, reminderIDs []int64) error {
+	return m.setStatus(ctx, reminderIDs, EventMissed, "")
+}
+
+func (m *MemStore) MarkSkipped(ctx context.Context, reminderIDs []int64) error {
+	return m.setStatus(ctx, reminderIDs, EventSkipped, "")
+}
+
+func (m *MemStore) Snooze(ctx context.Context, jobID int64, at time.Time) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.jobs[jobID]
+	if !ok {
+		return Job{}, sql.ErrNoRows
+	}
+
+	if stored.Status == "cancelled" {
+		return Job{}, ErrNotSnoozable
+	}
+
+	var orig *memReminder
+
+	for _, r := range m.remindersOf(jobID) {
+		if r.Status == "enqueued" && (orig == nil || !r.DueAtUTC.Before(orig.DueAtUTC)) {
+			orig = r
+		}
+	}
+
+	if orig == nil {
+		return Job{}, ErrNotSnoozable
+	}
+
+	at = at.UTC()
+	rem := m.addReminder(Reminder{
+		JobID:         jobID,
+		OffsetMinutes: int(stored.RunAtUTC.Sub(at) / time.Minute),
+		DueAtUTC:      at,
+		Status:        "pending",
+		SnoozedFrom:   orig.ID,
+		SnoozeCount:   orig.SnoozeCount + 1,
+	})
+
+	stored.Status = "pending"
+	m.settle(jobID)
+	m.addEvent(ctx, jobID, rem.ID, EventSnoozed, snoozeDetails(at))
+
+	j := m.job(stored, true)
+	j.Reminders = []Reminder{rem.Reminder}
+
+	return j, nil
+}
+
+// cancel cancels a job and its pending reminders.
+func (m *MemStore) cancel(ctx context.Context, id int64, details string) {
+	j := m.jobs[id]
+	if j == nil {
+		return
+	}
+
+	j.Status = "cancelled"
+
+	for _, r := range m.remindersOf(id) {
+		if r.Status == "pending" {
+			r.Status = "cancelled"
+		}
+	}
+
+	m.addEvent(ctx, id, 0, EventCancelled, details)
+}
+
+func (m *MemStore) Cancel(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j := m.jobs[id]; j != nil && j.Status != "cancelled" {
+		m.cancel(ctx, id, "")
+	}
+
+	return nil
+}
+
+// resolve returns the ids of the selected jobs accepted by keep, like
+// Selection.resolve.
+func (m *MemStore) resolve(sel Selection, keep func(j *Job) bool) ([]int64, error) {
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+
+	if len(sel.IDs) > 0 {
+		for _, id := range sel.IDs {
+			if j := m.jobs[id]; j != nil && keep(j) && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		for _, j := range m.matching(sel.filter()) {
+			if keep(j) {
+				ids = append(ids, j.ID)
+			}
+		}
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func isPending(j *Job) bool { return j.Status == "pending" }
+
+func anyJob(*Job) bool { return true }
+
+func (m *MemStore) CancelJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolve(sel, isPending)
+
+	for _, id := range ids {
+		m.cancel(ctx, id, "")
+	}
+
+	return ids, err
+}
+
+func (m *MemStore) DeleteJobs(ctx context.Context, sel Selection) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolve(sel, anyJob)
+
+	for _, id := range ids {
+		delete(m.jobs, id)
+		m.addEvent(ctx, id, 0, EventDeleted, "")
+	}
+
+	m.dropReminders(func(r *memReminder) bool { return m.jobs[r.JobID] == nil })
+
+	return ids, err
+}
+
+func (m *MemStore) ShiftJobs(ctx context.Context, sel Selection, d time.Duration) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolve(sel, isPending)
+
+	for _, id := range ids {
+		j := m.jobs[id]
+		j.RunAtUTC = j.RunAtUTC.Add(d)
+
+		for _, r := range m.remindersOf(id) {
+			if r.Status == "pending" {
+				r.DueAtUTC = r.DueAtUTC.Add(d)
+			}
+		}
+
+		m.settle(id)
+		m.addEvent(ctx, id, 0, EventEdited, shiftDetails(d))
+	}
+
+	return ids, err
+}
+
+func (m *MemStore) RelabelJobs(ctx context.Context, sel Selection, set map[string]string, remove []string) ([]int64, error) {
+	if err := ValidateLabels(set); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids, err := m.resolve(sel, anyJob)
+
+	for _, id := range ids {
+		j := m.jobs[id]
+		if j.Labels == nil {
+			j.Labels = make(map[string]string)
+		}
+
+		maps.Copy(j.Labels, set)
+
+		for _, k := range remove {
+			delete(j.Labels, k)
+		}
+
+		if len(j.Labels) == 0 {
+			j.Labels = nil
+		}
+
+		m.addEvent(ctx, id, 0, EventEdited, relabelDetails(set, remove))
+	}
+
+	return ids, err
+}
+
+// memOffsets is the offsets of a job's own pending or delivered reminders,
+// largest first, as loadExternal reads them.
+func (m *MemStore) memOffsets(jobID int64) []int {
+	var res []int
+
+	for _, r := range m.remindersOf(jobID) {
+		if r.SnoozedFrom == 0 && (r.Status == "pending" || r.Status == "enqueued") && !slices.Contains(res, r.OffsetMinutes) {
+			res = append(res, r.OffsetMinutes)
+		}
+	}
+
+	slices.Sort(res)
+	slices.Reverse(res)
+
+	return res
+}
+
+// current is the in-memory loadCurrent.
+func (m *MemStore) current(j *Job) *externalJob {
+	ex := &externalJob{Job: m.job(j, true), offsets: m.memOffsets(j.ID)}
+	if ex.Labels == nil {
+		ex.Labels = map[string]string{}
+	}
+
+	return ex
+}
+
+// updateExternal is the in-memory updateExternal.
+func (m *MemStore) updateExternal(ctx context.Context, j *Job) {
+	offsets := jobOffsets(j)
+
+	stored := m.jobs[j.ID]
+	stored.Title, stored.TZ, stored.RunAtUTC = j.Title, j.TZ, j.RunAtUTC.UTC()
+	stored.RemindBeforeMinutes, stored.Payload = offsets[0], j.Payload
+
+	m.replaceReminders(j, offsets)
+	m.addEvent(ctx, j.ID, 0, EventEdited, "re-imported")
+}
+
+func (m *MemStore) Update(ctx context.Context, j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.jobs[j.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if stored.Status != "pending" {
+		return ErrNotEditable
+	}
+
+	changed := changes(m.current(stored), j)
+	if changed == "" {
+		return nil
+	}
+
+	offsets := jobOffsets(j)
+
+	stored.Title, stored.TZ, stored.RunAtUTC = j.Title, j.TZ, j.RunAtUTC.UTC()
+	stored.RemindBeforeMinutes, stored.MisfirePolicy = offsets[0], j.MisfirePolicy
+	stored.Tenant, stored.MaxDelaySeconds = j.Tenant, j.MaxDelaySeconds
+	stored.Calendar, stored.Payload = j.Calendar, j.Payload
+
+	m.replaceReminders(j, offsets)
+	m.addEvent(ctx, j.ID, 0, EventEdited, changed)
+
+	return nil
+}
+
+// replaceReminders is the in-memory replaceReminders.
+func (m *MemStore) replaceReminders(j *Job, offsets []int) {
+	stored := m.jobs[j.ID]
+
+	m.dropReminders(func(r *memReminder) bool { return r.JobID == j.ID && r.Status == "pending" })
+
+	// A reminder already delivered for the same time is not sent again.
+	for _, o := range offsets {
+		due := j.RunAtUTC.Add(-time.Duration(o) * time.Minute)
+
+		if slices.ContainsFunc(m.remindersOf(j.ID), func(r *memReminder) bool {
+			return r.DueAtUTC.Equal(due) && r.Status != "cancelled"
+		}) {
+			continue
+		}
+
+		m.addReminder(Reminder{JobID: j.ID, OffsetMinutes: o, DueAtUTC: due, Status: "pending"})
+	}
+
+	stored.Labels = nil
+	if len(j.Labels) > 0 {
+		stored.Labels = maps.Clone(j.Labels)
+	}
+
+	m.settle(j.ID)
+}
+
+func (m *MemStore) SyncExternal(ctx context.Context, series string, js []*Job, from, to time.Time) (SyncResult, error) {
+	var res SyncResult
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := make(map[string]*externalJob)
+
+	for _, j := range m.jobs {
+		if j.ExternalID == series || strings.HasPrefix(j.ExternalID, series+"/") {
+			existing[j.ExternalID] = m.current(j)
+		}
+	}
+
+	var created []*Job
+
+	for _, j := range js {
+		if _, ok := existing[j.ExternalID]; !ok && j.Status != "cancelled" {
+			created = append(created, j)
+		}
+	}
+
+	if err := m.checkExternalIDs(created); err != nil {
+		return res, err
+	}
+
+	seen := make(map[string]bool, len(js))
+
+	for _, j := range js {
+		seen[j.ExternalID] = true
+
+		ex, ok := existing[j.ExternalID]
+
+		switch {
+		case !ok && j.Status == "cancelled":
+			continue
+		case !ok:
+			m.insert(ctx, j)
+
+			j.Status = "pending"
+			res.Created = append(res.Created, j.ID)
+		case ex.Status != "pending":
+			j.ID = ex.ID
+			res.Unchanged = append(res.Unchanged, ex.ID)
+		case j.Status == "cancelled":
+			m.cancel(ctx, ex.ID, "cancelled at the source")
+
+			j.ID = ex.ID
+			res.Cancelled = append(res.Cancelled, ex.ID)
+		case sameExternal(ex, j):
+			j.ID = ex.ID
+			res.Unchanged = append(res.Unchanged, ex.ID)
+		default:
+			j.ID = ex.ID
+			m.updateExternal(ctx, j)
+
+			res.Updated = append(res.Updated, ex.ID)
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(existing)) {
+		ex := existing[id]
+		if seen[id] || ex.Status != "pending" || ex.RunAtUTC.Before(from) || ex.RunAtUTC.After(to) {
+			continue
+		}
+
+		m.cancel(ctx, ex.ID, "removed at the source")
+
+		res.Cancelled = append(res.Cancelled, ex.ID)
+	}
+
+	return res, nil
+}
+
+func (m *MemStore) Events(ctx context.Context, jobID int64) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []Event
+
+	for _, e := range m.events {
+		if e.JobID == jobID {
+			res = append(res, e)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *MemStore) Ack(ctx context.Context, jobID, reminderID int64, details string) (Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.jobs[jobID] == nil {
+		return Event{}, sql.ErrNoRows
+	}
+
+	var rem *memReminder
+
+	for _, r := range m.remindersOf(jobID) {
+		if r.Status == "enqueued" && (reminderID == 0 || r.ID == reminderID) && (rem == nil || !r.DueAtUTC.Before(rem.DueAtUTC)) {
+			rem = r
+		}
+	}
+
+	if rem == nil {
+		return Event{}, ErrNotAckable
+	}
+
+	return m.addEvent(ctx, jobID, rem.ID, EventAcked, details), nil
+}
+
+func (m *MemStore) CreateFeed(ctx context.Context, name string, filter JobFilter) (Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := newFeed(name, filter)
+	f.CreatedAt = memNow()
+	m.feeds[f.Token] = f
+
+	return f, nil
+}
+
+func (m *MemStore) Feed(ctx context.Context, token string) (Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[token]
+	if !ok {
+		return Feed{}, sql.ErrNoRows
+	}
+
+	return f, nil
+}
+
+func (m *MemStore) ListFeeds(ctx context.Context) ([]Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := slices.SortedFunc(maps.Values(m.feeds), func(a, b Feed) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.Name, b.Name))
+	})
+
+	return res, nil
+}
+
+func (m *MemStore) DeleteFeed(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.feeds, token)
+
+	return nil
+}
+
+func (m *MemStore) FeedJobs(ctx context.Context, f Feed, now time.Time) ([]Job, error) {
+	return feedJobs(ctx, m, f, now)
+}
+
+func (m *MemStore) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []*calendar.Calendar
+
+	for _, name := range slices.Sorted(maps.Keys(m.calendars)) {
+		var c calendar.Calendar
+		if err := json.Unmarshal(m.calendars[name], &c); err != nil {
+			return nil, err
+		}
+
+		res = append(res, &c)
+	}
+
+	return res, nil
+}
+
+func (m *MemStore) UpsertCalendar(ctx context.Context, c *calendar.Calendar) error {
+	spec, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calendars[c.Name] = spec
+
+	return nil
+}
+
+func (m *MemStore) DeleteCalendar(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.calendars, name)
+
+	return nil
+}
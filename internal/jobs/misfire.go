@@ -0,0 +1,99 @@
+package jobs
+
+import "time"
+
+// MisfirePolicy decides what happens to a pending reminder whose due time
+// has already passed when it is armed, e.g. after an outage.
+type MisfirePolicy string
+
+const (
+	// MisfireFireNow delivers every late job immediately.
+	MisfireFireNow MisfirePolicy = "fire_now"
+	// MisfireCoalesce delivers only the most recent late reminder of a job
+	// and marks its older late reminders missed.
+	MisfireCoalesce MisfirePolicy = "coalesce"
+	// MisfireSkip marks late jobs missed without delivering them.
+	MisfireSkip MisfirePolicy = "skip"
+	// MisfireWindow delivers late jobs only while they are at most
+	// Scheduler.MaxLateness overdue and marks older ones missed.
+	MisfireWindow MisfirePolicy = "window"
+)
+
+const (
+	DefaultMisfirePolicy = MisfireWindow
+	DefaultMaxLateness   = 24 * time.Hour
+)
+
+var MisfirePolicies = []MisfirePolicy{MisfireFireNow, MisfireCoalesce, MisfireSkip, MisfireWindow}
+
+func (p MisfirePolicy) Valid() bool {
+	for _, v := range MisfirePolicies {
+		if p == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Scheduler) misfirePolicy(j Job) MisfirePolicy {
+	if j.MisfirePolicy.Valid() {
+		return j.MisfirePolicy
+	}
+
+	if s.Misfire.Valid() {
+		return s.Misfire
+	}
+
+	return DefaultMisfirePolicy
+}
+
+func (s *Scheduler) maxLateness() time.Duration {
+	if s.MaxLateness > 0 {
+		return s.MaxLateness
+	}
+
+	return DefaultMaxLateness
+}
+
+// triage splits reminders into the ones to arm and the late ones that their
+// job's policy says must not be delivered.
+func (s *Scheduler) triage(arms []arming, now time.Time) (keep, missed []arming) {
+	latest := make(map[int64]int) // job id -> index in keep, for coalescing
+
+	for _, a := range arms {
+		lateness := now.Sub(a.due)
+		if lateness <= 0 {
+			keep = append(keep, a)
+			continue
+		}
+
+		switch s.misfirePolicy(a.occ.Job) {
+		case MisfireSkip:
+			missed = append(missed, a)
+		case MisfireWindow:
+			if lateness > s.maxLateness() {
+				missed = append(missed, a)
+			} else {
+				keep = append(keep, a)
+			}
+		case MisfireCoalesce:
+			i, ok := latest[a.occ.ID]
+			if !ok {
+				latest[a.occ.ID] = len(keep)
+				keep = append(keep, a)
+				continue
+			}
+
+			if keep[i].due.Before(a.due) {
+				keep[i], a = a, keep[i]
+			}
+
+			missed = append(missed, a)
+		default:
+			keep = append(keep, a)
+		}
+	}
+
+	return keep, missed
+}
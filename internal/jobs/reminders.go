@@ -0,0 +1,220 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder is one delivery of a job, OffsetMinutes before its run time.
+// Every reminder has its own due time, status and wheel timer.
+type Reminder struct {
+	ID            int64
+	JobID         int64
+	OffsetMinutes int
+	DueAtUTC      time.Time
+	Status        string // pending|enqueued|missed|skipped|cancelled
+
+	// SnoozedFrom is the reminder this one was snoozed from, 0 if it is one
+	// of the job's own offsets; SnoozeCount counts snoozes along that chain.
+	SnoozedFrom int64
+	SnoozeCount int
+}
+
+const reminderColumns = `id, job_id, offset_minutes, due_at_utc, status, COALESCE(snoozed_from, 0), snooze_count`
+
+func reminderDest(r *Reminder) []any {
+	return []any{&r.ID, &r.JobID, &r.OffsetMinutes, &r.DueAtUTC, &r.Status, &r.SnoozedFrom, &r.SnoozeCount}
+}
+
+// Occurrence is a pending reminder together with its job; it is the unit
+// the scheduler arms.
+type Occurrence struct {
+	Job
+	Reminder Reminder
+}
+
+const maxReminders = 10
+
+// ParseOffsets parses a comma separated list of minutes such as
+// "1440, 60, 0" and returns the distinct offsets, largest first.
+func ParseOffsets(s string) ([]int, error) {
+	var res []int
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder offset %q", part)
+		}
+
+		if !slices.Contains(res, n) {
+			res = append(res, n)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, errors.New("at least one reminder offset is required")
+	}
+
+	if len(res) > maxReminders {
+		return nil, fmt.Errorf("at most %d reminder offsets are allowed", maxReminders)
+	}
+
+	slices.Sort(res)
+	slices.Reverse(res)
+
+	return res, nil
+}
+
+// OffsetReminders builds unsaved reminders for the given offsets.
+func OffsetReminders(offsets []int) []Reminder {
+	res := make([]Reminder, len(offsets))
+	for i, o := range offsets {
+		res[i] = Reminder{OffsetMinutes: o}
+	}
+
+	return res
+}
+
+// Offsets returns the distinct offsets of the job's own reminders in any
+// of the given statuses, or in any status if none is given, largest first.
+// Snoozes are deliveries, not part of the job's own schedule, so their
+// reminders are left out.
+func (j Job) Offsets(statuses ...string) []int {
+	res := []int{}
+
+	for _, r := range j.Reminders {
+		if r.SnoozedFrom != 0 || slices.Contains(res, r.OffsetMinutes) {
+			continue
+		}
+
+		if len(statuses) == 0 || slices.Contains(statuses, r.Status) {
+			res = append(res, r.OffsetMinutes)
+		}
+	}
+
+	slices.Sort(res)
+	slices.Reverse(res)
+
+	return res
+}
+
+// Occurrences returns the pending reminders of a job as occurrences.
+func (j Job) Occurrences() []Occurrence {
+	var res []Occurrence
+
+	for _, r := range j.Reminders {
+		if r.Status == "pending" {
+			res = append(res, Occurrence{Job: j, Reminder: r})
+		}
+	}
+
+	return res
+}
+
+// RemindersFor returns the reminders of the given jobs, keyed by job id and
+// ordered by due time.
+func (r *Repo) RemindersFor(ctx context.Context, jobIDs []int64) (map[int64][]Reminder, error) {
+	res := make(map[int64][]Reminder, len(jobIDs))
+
+	for start := 0; start < len(jobIDs); start += maxBatchArgs {
+		chunk := jobIDs[start:min(start+maxBatchArgs, len(jobIDs))]
+
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+
+		rows, err := r.DB.QueryContext(ctx, `
+		  SELECT `+reminderColumns+`
+		  FROM job_reminders
+		  WHERE job_id IN (`+placeholders(len(chunk))+`)
+		  ORDER BY due_at_utc ASC`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var rem Reminder
+			if err := rows.Scan(reminderDest(&rem)...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			res[rem.JobID] = append(res[rem.JobID], rem)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// setReminderStatus moves pending reminders to status, records the
+// transition with details in their jobs' history and settles the jobs.
+// Missed and skipped reminders are reported by id.
+func (r *Repo) setReminderStatus(ctx context.Context, ids []int64, status, details string) error {
+	for start := 0; start < len(ids); start += maxBatchArgs {
+		chunk := ids[start:min(start+maxBatchArgs, len(ids))]
+
+		args := []any{status}
+		for _, id := range chunk {
+			args = append(args, id)
+		}
+
+		in := placeholders(len(chunk))
+
+		tx, err := r.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := addReminderEvents(ctx, tx, status, details, `status='pending' AND id IN (`+in+`)`, args[1:]...); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET status=? WHERE status='pending' AND id IN (`+in+`)`, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, settleJobsSQL+` AND id IN (SELECT job_id FROM job_reminders WHERE id IN (`+in+`))`, args[1:]...); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settleJobsSQL recomputes a pending job from its reminders: it stays
+// pending with due_at_utc at its next pending reminder, becomes enqueued
+// once every reminder is done and at least one was delivered, and otherwise
+// takes the status of its last reminder.
+const settleJobsSQL = `
+  UPDATE jobs SET
+    status = CASE
+      WHEN EXISTS (SELECT 1 FROM job_reminders r WHERE r.job_id = jobs.id AND r.status = 'pending') THEN 'pending'
+      WHEN EXISTS (SELECT 1 FROM job_reminders r WHERE r.job_id = jobs.id AND r.status = 'enqueued') THEN 'enqueued'
+      ELSE COALESCE((SELECT r.status FROM job_reminders r WHERE r.job_id = jobs.id ORDER BY r.due_at_utc DESC LIMIT 1), status)
+    END,
+    due_at_utc = COALESCE((SELECT MIN(r.due_at_utc) FROM job_reminders r WHERE r.job_id = jobs.id AND r.status = 'pending'), due_at_utc)
+  WHERE status = 'pending'`
@@ -3,24 +3,37 @@ package jobs
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
+
+	"github.com/yplog/ticktockbox/internal/db"
 )
 
 type Job struct {
-	ID                  int64
-	Title               string
-	TZ                  string
-	RunAtUTC            time.Time
+	ID       int64
+	Title    string
+	TZ       string
+	RunAtUTC time.Time
+	// DueAtUTC is the due time of the next pending reminder and
+	// RemindBeforeMinutes the largest reminder offset.
 	DueAtUTC            time.Time
 	RemindBeforeMinutes int
 	Status              string
+	MisfirePolicy       MisfirePolicy
+	Tenant              string
+	MaxDelaySeconds     int    // 0 means Scheduler.MaxDelay
+	Calendar            string // name of a calendar.Calendar, empty for none
+	Payload             string // free-form text delivered with every reminder
+	ExternalID          string // id in the system a job was imported from, empty for none
 	CreatedAt           time.Time
-}
 
-type JobFilter struct {
-	Status string
-	Page   int
-	Limit  int
+	// Reminders is only populated where noted; Insert creates one reminder
+	// per entry, or a single one at RemindBeforeMinutes if it is empty.
+	Reminders []Reminder
+
+	// Labels are free-form key/value tags such as team or customer. They
+	// are stored in job_labels and populated where noted.
+	Labels map[string]string
 }
 
 type JobPage struct {
@@ -35,36 +48,213 @@ type JobPage struct {
 
 type Repo struct{ DB *sql.DB }
 
+// dialect is the SQL dialect of r.DB, for the few statements that differ
+// between SQLite and PostgreSQL.
+func (r *Repo) dialect() db.Dialect {
+	return db.DialectOf(r.DB)
+}
+
+var jobColumnNames = []string{
+	"id", "title", "tz", "run_at_utc", "due_at_utc", "remind_before_minutes", "status",
+	"misfire_policy", "tenant", "max_delay_seconds", "calendar", "payload", "external_id", "created_at",
+}
+
+var jobColumns = strings.Join(jobColumnNames, ", ")
+
+// jobColumnsOf qualifies the job columns with a table alias for joins.
+func jobColumnsOf(alias string) string {
+	cols := make([]string, len(jobColumnNames))
+	for i, c := range jobColumnNames {
+		cols[i] = alias + "." + c
+	}
+
+	return strings.Join(cols, ", ")
+}
+
+func jobDest(j *Job) []any {
+	return []any{&j.ID, &j.Title, &j.TZ, &j.RunAtUTC, &j.DueAtUTC, &j.RemindBeforeMinutes, &j.Status, &j.MisfirePolicy, &j.Tenant, &j.MaxDelaySeconds, &j.Calendar, &j.Payload, &j.ExternalID, &j.CreatedAt}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(s scanner) (Job, error) {
+	var j Job
+	err := s.Scan(jobDest(&j)...)
+
+	return j, err
+}
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var res []Job
+
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, j)
+	}
+
+	return res, rows.Err()
+}
+
+// Insert stores a job with its reminders and labels in one transaction.
+// Reminder due times are derived from RunAtUTC; j.DueAtUTC,
+// j.RemindBeforeMinutes and the reminder ids are filled in on success.
 func (r *Repo) Insert(ctx context.Context, j *Job) (int64, error) {
-	res, err := r.DB.ExecContext(ctx, `
-	  INSERT INTO jobs(title, tz, run_at_utc, due_at_utc, remind_before_minutes, status)
-	  VALUES (?, ?, ?, ?, ?, 'pending')`,
-		j.Title, j.TZ, j.RunAtUTC, j.DueAtUTC, j.RemindBeforeMinutes)
+	if err := r.InsertBatch(ctx, []*Job{j}); err != nil {
+		return 0, err
+	}
 
+	return j.ID, nil
+}
+
+// InsertBatch stores several jobs like Insert, all in one transaction.
+func (r *Repo) InsertBatch(ctx context.Context, batch []*Job) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, j := range batch {
+		if err := insertJob(ctx, tx, j); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	id, _ := res.LastInsertId()
+	for _, j := range batch {
+		j.Status = "pending"
+	}
 
-	return id, nil
+	return nil
 }
 
-func (r *Repo) MarkEnqueued(ctx context.Context, id int64) error {
-	_, err := r.DB.ExecContext(ctx, `UPDATE jobs SET status='enqueued' WHERE id=?`, id)
+func insertJob(ctx context.Context, tx *sql.Tx, j *Job) error {
+	if len(j.Reminders) == 0 {
+		j.Reminders = OffsetReminders([]int{j.RemindBeforeMinutes})
+	}
+
+	for i := range j.Reminders {
+		rem := &j.Reminders[i]
+		rem.DueAtUTC = j.RunAtUTC.Add(-time.Duration(rem.OffsetMinutes) * time.Minute)
+		rem.Status = "pending"
+
+		if i == 0 || rem.DueAtUTC.Before(j.DueAtUTC) {
+			j.DueAtUTC = rem.DueAtUTC
+			j.RemindBeforeMinutes = rem.OffsetMinutes
+		}
+	}
+
+	err := tx.QueryRowContext(ctx, `
+	  INSERT INTO jobs(title, tz, run_at_utc, due_at_utc, remind_before_minutes, status, misfire_policy, tenant, max_delay_seconds, calendar, payload, external_id)
+	  VALUES (?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?, ?, ?)
+	  RETURNING id`,
+		j.Title, j.TZ, j.RunAtUTC, j.DueAtUTC, j.RemindBeforeMinutes, j.MisfirePolicy, j.Tenant, j.MaxDelaySeconds, j.Calendar, j.Payload, j.ExternalID).Scan(&j.ID)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range j.Reminders {
+		rem := &j.Reminders[i]
+		rem.JobID = j.ID
+
+		err := tx.QueryRowContext(ctx, `
+		  INSERT INTO job_reminders(job_id, offset_minutes, due_at_utc, status)
+		  VALUES (?, ?, ?, 'pending')
+		  RETURNING id`,
+			j.ID, rem.OffsetMinutes, rem.DueAtUTC).Scan(&rem.ID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := insertLabels(ctx, tx, j.ID, j.Labels); err != nil {
+		return err
+	}
+
+	details := ""
+	if j.ExternalID != "" {
+		details = "imported as " + j.ExternalID
+	}
+
+	_, err = addEvent(ctx, tx, j.ID, 0, EventCreated, details)
 
 	return err
 }
 
+// MarkEnqueued records that a reminder was published as message.
+func (r *Repo) MarkEnqueued(ctx context.Context, reminderID int64, message string) error {
+	return r.setReminderStatus(ctx, []int64{reminderID}, EventEnqueued, message)
+}
+
+// MarkMissed flags pending reminders that were dropped by their job's
+// misfire policy.
+func (r *Repo) MarkMissed(ctx context.Context, reminderIDs []int64) error {
+	return r.setReminderStatus(ctx, reminderIDs, EventMissed, "")
+}
+
+// MarkSkipped flags pending reminders whose calendar does not allow
+// delivery.
+func (r *Repo) MarkSkipped(ctx context.Context, reminderIDs []int64) error {
+	return r.setReminderStatus(ctx, reminderIDs, EventSkipped, "")
+}
+
+// maxBatchArgs keeps IN lists well below SQLite's bound parameter limit.
+const maxBatchArgs = 500
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
 func (r *Repo) Cancel(ctx context.Context, id int64) error {
-	_, err := r.DB.ExecContext(ctx, `UPDATE jobs SET status='cancelled' WHERE id=?`, id)
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	return err
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE jobs SET status='cancelled' WHERE id=? AND status != 'cancelled'`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE job_reminders SET status='cancelled' WHERE job_id=? AND status='pending'`, id); err != nil {
+		return err
+	}
+
+	if _, err := addEvent(ctx, tx, id, 0, EventCancelled, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get returns a job without its reminders, or sql.ErrNoRows.
+func (r *Repo) Get(ctx context.Context, id int64) (Job, error) {
+	return scanJob(r.DB.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
 }
 
 func (r *Repo) GetUpcoming(ctx context.Context, limit int) ([]Job, error) {
 	rows, err := r.DB.QueryContext(ctx, `
-	  SELECT id, title, tz, run_at_utc, due_at_utc, remind_before_minutes, status, created_at
+	  SELECT `+jobColumns+`
 	  FROM jobs
 	  WHERE status IN ('pending','enqueued')
 	  ORDER BY due_at_utc ASC
@@ -74,22 +264,33 @@ func (r *Repo) GetUpcoming(ctx context.Context, limit int) ([]Job, error) {
 		return nil, err
 	}
 
+	return scanJobs(rows)
+}
+
+// TimeZones returns the distinct time zones jobs are scheduled in.
+func (r *Repo) TimeZones(ctx context.Context) ([]string, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT DISTINCT tz FROM jobs ORDER BY tz`)
+	if err != nil {
+		return nil, err
+	}
+
 	defer rows.Close()
 
-	var res []Job
+	var res []string
 
 	for rows.Next() {
-		var j Job
-		if err := rows.Scan(&j.ID, &j.Title, &j.TZ, &j.RunAtUTC, &j.DueAtUTC, &j.RemindBeforeMinutes, &j.Status, &j.CreatedAt); err != nil {
+		var tz string
+		if err := rows.Scan(&tz); err != nil {
 			return nil, err
 		}
 
-		res = append(res, j)
+		res = append(res, tz)
 	}
 
 	return res, rows.Err()
 }
 
+// GetJobsPaginated returns a page of jobs matching filter, with labels.
 func (r *Repo) GetJobsPaginated(ctx context.Context, filter JobFilter) (*JobPage, error) {
 	if filter.Page < 1 {
 		filter.Page = 1
@@ -101,49 +302,43 @@ func (r *Repo) GetJobsPaginated(ctx context.Context, filter JobFilter) (*JobPage
 
 	offset := (filter.Page - 1) * filter.Limit
 
-	var statusCondition string
-	var args []any
+	d := r.dialect()
 
-	if filter.Status == "" || filter.Status == "all" {
-		statusCondition = "1=1"
-	} else {
-		statusCondition = "status = ?"
-		args = append(args, filter.Status)
-	}
+	where, args := filter.where(d)
+
+	from := filter.from(d)
 
 	var total int
 
-	countQuery := `SELECT COUNT(*) FROM jobs WHERE ` + statusCondition
+	countQuery := `SELECT COUNT(*) FROM ` + from + ` WHERE ` + where
 	err := r.DB.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, err
 	}
 
+	orderBy, orderArgs := filter.orderBy(d)
+
 	query := `
-		SELECT id, title, tz, run_at_utc, due_at_utc, remind_before_minutes, status, created_at
-		FROM jobs
-		WHERE ` + statusCondition + `
-		ORDER BY due_at_utc ASC
+		SELECT ` + jobColumnsOf("jobs") + `
+		FROM ` + from + `
+		WHERE ` + where + `
+		ORDER BY ` + orderBy + `
 		LIMIT ? OFFSET ?`
 
+	args = append(args, orderArgs...)
 	args = append(args, filter.Limit, offset)
 
 	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var jobs []Job
-	for rows.Next() {
-		var j Job
-		if err := rows.Scan(&j.ID, &j.Title, &j.TZ, &j.RunAtUTC, &j.DueAtUTC, &j.RemindBeforeMinutes, &j.Status, &j.CreatedAt); err != nil {
-			return nil, err
-		}
-		jobs = append(jobs, j)
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
+	if err := r.attachLabels(ctx, jobs); err != nil {
 		return nil, err
 	}
 
@@ -160,12 +355,21 @@ func (r *Repo) GetJobsPaginated(ctx context.Context, filter JobFilter) (*JobPage
 	}, nil
 }
 
-func (r *Repo) LoadPendingSince(ctx context.Context, since time.Time) ([]Job, error) {
+// LoadPendingBetween returns the pending reminders due in [from, to) with
+// their jobs and labels, served by idx_job_reminders_status_due.
+func (r *Repo) LoadPendingBetween(ctx context.Context, from, to time.Time) ([]Occurrence, error) {
+	return r.loadPending(ctx, `r.due_at_utc >= ? AND r.due_at_utc < ?`, from, to)
+}
+
+// loadPending returns the pending reminders matching cond, an SQL condition
+// on job_reminders r and jobs j, with their jobs and labels.
+func (r *Repo) loadPending(ctx context.Context, cond string, args ...any) ([]Occurrence, error) {
 	rows, err := r.DB.QueryContext(ctx, `
-	  SELECT id, title, tz, run_at_utc, due_at_utc, remind_before_minutes, status, created_at
-	  FROM jobs
-	  WHERE status = 'pending' AND due_at_utc >= ?
-	  ORDER BY due_at_utc ASC`, since)
+	  SELECT r.id, r.offset_minutes, r.due_at_utc, r.status, COALESCE(r.snoozed_from, 0), r.snooze_count, `+jobColumnsOf("j")+`
+	  FROM job_reminders r
+	  JOIN jobs j ON j.id = r.job_id
+	  WHERE r.status = 'pending' AND `+cond+`
+	  ORDER BY r.due_at_utc ASC`, args...)
 
 	if err != nil {
 		return nil, err
@@ -173,16 +377,37 @@ func (r *Repo) LoadPendingSince(ctx context.Context, since time.Time) ([]Job, er
 
 	defer rows.Close()
 
-	var res []Job
+	var res []Occurrence
 
 	for rows.Next() {
-		var j Job
-		if err := rows.Scan(&j.ID, &j.Title, &j.TZ, &j.RunAtUTC, &j.DueAtUTC, &j.RemindBeforeMinutes, &j.Status, &j.CreatedAt); err != nil {
+		var o Occurrence
+		rem := &o.Reminder
+		dest := append([]any{&rem.ID, &rem.OffsetMinutes, &rem.DueAtUTC, &rem.Status, &rem.SnoozedFrom, &rem.SnoozeCount}, jobDest(&o.Job)...)
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
 
-		res = append(res, j)
+		o.Reminder.JobID = o.Job.ID
+		res = append(res, o)
 	}
 
-	return res, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(res))
+	for i, o := range res {
+		ids[i] = o.Job.ID
+	}
+
+	labels, err := r.LabelsFor(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range res {
+		res[i].Job.Labels = labels[res[i].Job.ID]
+	}
+
+	return res, nil
 }
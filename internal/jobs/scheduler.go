@@ -2,18 +2,87 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
 	"time"
 
-	"github.com/yplog/ticktockbox/internal/rmq"
+	"github.com/yplog/ticktockbox/internal/calendar"
+	"github.com/yplog/ticktockbox/internal/ratelimit"
 	"github.com/yplog/ticktockbox/internal/twheel"
 )
 
+// Wheel is the part of the timing wheel the scheduler relies on. Both
+// *twheel.Wheel and *twheel.Sharded satisfy it.
+type Wheel interface {
+	At(deadline time.Time, f twheel.Task) uint64
+	AtBatch(items []twheel.Item) []uint64
+	Cancel(id uint64) bool
+	CancelBatch(ids []uint64) int
+}
+
+// Publisher hands due reminders to their consumers. *rmq.Publisher
+// satisfies it.
+type Publisher interface {
+	PublishJSON(ctx context.Context, v any, key string) error
+}
+
+// DefaultHorizon is how far ahead of now pending jobs are kept armed in the
+// wheel when Scheduler.Horizon is not set.
+const DefaultHorizon = time.Hour
+
+// A reminder whose publish failed is tried again after retryBackoff, which
+// doubles with every failure up to maxRetryBackoff.
+const (
+	retryBackoff    = 5 * time.Second
+	maxRetryBackoff = 5 * time.Minute
+)
+
 type Scheduler struct {
-	Repo *Repo
-	Pub  *rmq.Publisher
-	Wh   *twheel.Wheel
+	Repo Store
+	Pub  Publisher
+	Wh   Wheel
+
+	// Horizon bounds the window of jobs held in memory. Jobs due later stay
+	// in the database and are armed by Run as the window slides forward.
+	Horizon time.Duration
+
+	// Misfire is the policy for late jobs that do not set their own;
+	// MaxLateness bounds MisfireWindow.
+	Misfire     MisfirePolicy
+	MaxLateness time.Duration
+
+	// Limiter and TenantLimiter smooth out bursts of deliveries that share
+	// a due time. A delivery waits for a token for at most MaxDelay (or the
+	// job's own cap); nil limiters disable throttling.
+	Limiter       *ratelimit.Bucket
+	TenantLimiter *ratelimit.Keyed
+	MaxDelay      time.Duration
+
+	// Calendars resolves the calendar a job references; due times falling
+	// outside it are shifted or skipped.
+	Calendars *calendar.Registry
+
+	mu     sync.Mutex
+	timers map[int64]map[int64]*armedTimer // job id -> reminder id -> wheel timer
+
+	loadMu      sync.Mutex
+	loadedUntil time.Time // pending reminders due before this are armed
+}
+
+type armedTimer struct {
+	id       uint64
+	due      time.Time // the reminder's due time when it was armed
+	deadline time.Time
+}
+
+// TimerState is the wheel timer armed for a pending reminder.
+type TimerState struct {
+	TimerID  uint64
+	Deadline time.Time // when it fires, after calendar and misfire handling
 }
 
 type DueEvent struct {
@@ -22,54 +91,538 @@ type DueEvent struct {
 	RunAtUTC time.Time `json:"run_at_utc"`
 	DueAtUTC time.Time `json:"due_at_utc"`
 	TZ       string    `json:"tz"`
+	Tenant   string    `json:"tenant,omitempty"`
+
+	// Labels are the job's key/value tags, for consumers to route on.
+	Labels  map[string]string `json:"labels,omitempty"`
+	Payload string            `json:"payload,omitempty"`
+
+	// ReminderID and OffsetMinutes identify which of the job's reminders
+	// fired; DueAtUTC is that reminder's due time.
+	ReminderID    int64 `json:"reminder_id"`
+	OffsetMinutes int   `json:"offset_minutes"`
+
+	// SnoozeCount is how many times the reminder has been snoozed and
+	// SnoozedFrom the reminder it was snoozed from.
+	SnoozeCount int   `json:"snooze_count,omitempty"`
+	SnoozedFrom int64 `json:"snoozed_from,omitempty"`
+
+	// ShiftedToUTC is set when the job's calendar moved delivery away from
+	// DueAtUTC.
+	ShiftedToUTC time.Time `json:"shifted_to_utc,omitzero"`
+
+	// Late is set when the job was armed after DueAtUTC had passed;
+	// DueAtUTC still carries the original due time.
+	Late bool `json:"late,omitempty"`
+
+	// DelayedMS is how long rate limiting held the delivery back.
+	// RateLimited is set when the job's max delay would have been exceeded
+	// and it was delivered without waiting.
+	DelayedMS   int64 `json:"delayed_ms,omitempty"`
+	RateLimited bool  `json:"rate_limited,omitempty"`
+}
+
+func NewScheduler(repo Store, pub Publisher, wh Wheel) *Scheduler {
+	return &Scheduler{
+		Repo:      repo,
+		Pub:       pub,
+		Wh:        wh,
+		Calendars: calendar.NewRegistry(),
+		timers:    make(map[int64]map[int64]*armedTimer),
+	}
 }
 
-func NewScheduler(repo *Repo, pub *rmq.Publisher, wh *twheel.Wheel) *Scheduler {
-	return &Scheduler{Repo: repo, Pub: pub, Wh: wh}
+func (s *Scheduler) horizon() time.Duration {
+	if s.Horizon > 0 {
+		return s.Horizon
+	}
+
+	return DefaultHorizon
 }
 
 func (s *Scheduler) Warmup(ctx context.Context) error {
-	since := time.Now().UTC().Add(-24 * time.Hour)
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.loadedUntil = time.Now().UTC().Add(s.horizon())
+
+	return s.reload(ctx)
+}
+
+// Reload re-arms every pending reminder inside the current window.
+func (s *Scheduler) Reload(ctx context.Context) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	return s.reload(ctx)
+}
+
+// reload arms every pending reminder due before the end of the window,
+// however overdue; ScheduleBatch applies the misfire policy to the late ones.
+func (s *Scheduler) reload(ctx context.Context) error {
+	pending, err := s.Repo.LoadPendingBetween(ctx, time.Time{}, s.loadedUntil)
+	if err != nil {
+		return err
+	}
+
+	return s.ScheduleBatch(ctx, pending)
+}
+
+// Run slides the loaded window forward until ctx is done, arming jobs that
+// come within the horizon.
+func (s *Scheduler) Run(ctx context.Context) {
+	t := time.NewTicker(s.horizon() / 4)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := s.Refill(ctx); err != nil {
+				log.Printf("refill failed err=%v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Refill arms pending reminders due between the end of the loaded window
+// and now + horizon. Replicas sharing the database add, move and cancel
+// reminders without telling each other, so it also reconciles the rest of
+// the window that is not yet due: reminders with no timer here, or one for
+// another due time, are armed, and timers left for reminders that are no
+// longer pending are disarmed.
+func (s *Scheduler) Refill(ctx context.Context) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	now := time.Now().UTC()
+
+	from, to := now, now.Add(s.horizon())
+	if s.loadedUntil.Before(from) {
+		from = s.loadedUntil
+	}
 
-	pending, err := s.Repo.LoadPendingSince(ctx, since)
+	if to.Before(s.loadedUntil) {
+		to = s.loadedUntil
+	}
+
+	next, err := s.Repo.LoadPendingBetween(ctx, from, to)
 	if err != nil {
 		return err
 	}
 
-	for _, j := range pending {
-		j := j
-		s.scheduleJob(j)
+	if err := s.ScheduleBatch(ctx, s.reconcile(next, from, to)); err != nil {
+		return err
+	}
+
+	s.loadedUntil = to
+
+	return nil
+}
+
+// reconcile disarms the timers for reminders due in [from, to) that are not
+// among the pending occs, and returns the occs that have no timer for their
+// current due time.
+func (s *Scheduler) reconcile(occs []Occurrence, from, to time.Time) []Occurrence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make(map[int64]bool, len(occs))
+	for _, o := range occs {
+		pending[o.Reminder.ID] = true
+	}
+
+	var stale []uint64
+	for jobID, byReminder := range s.timers {
+		for id, t := range byReminder {
+			if pending[id] || t.due.Before(from) || !t.due.Before(to) {
+				continue
+			}
+
+			stale = append(stale, t.id)
+			delete(byReminder, id)
+		}
+
+		if len(byReminder) == 0 {
+			delete(s.timers, jobID)
+		}
+	}
+
+	s.Wh.CancelBatch(stale)
+
+	return slices.DeleteFunc(occs, func(o Occurrence) bool {
+		t, ok := s.timers[o.Job.ID][o.Reminder.ID]
+		return ok && t.due.Equal(o.Reminder.DueAtUTC)
+	})
+}
+
+// ScheduleNew arms the reminders of a freshly created job that fall inside
+// the loaded window; later ones are picked up by Refill.
+func (s *Scheduler) ScheduleNew(ctx context.Context, j Job) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	var due []Occurrence
+	for _, o := range j.Occurrences() {
+		if o.Reminder.DueAtUTC.Before(s.loadedUntil) {
+			due = append(due, o)
+		}
+	}
+
+	return s.ScheduleBatch(ctx, due)
+}
+
+// ScheduleBatch arms a wheel timer for every reminder with one AtBatch call.
+// Reminders that already have a timer are re-armed, so calling it again for
+// the same reminders does not publish them twice. Late reminders go through
+// their job's misfire policy first and may be marked missed instead.
+func (s *Scheduler) ScheduleBatch(ctx context.Context, occs []Occurrence) error {
+	if len(occs) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	var (
+		arms    []arming
+		skipped []arming
+	)
+
+	for _, o := range occs {
+		due, skip := s.Adjust(o.Job, o.Reminder.DueAtUTC)
+		if skip {
+			skipped = append(skipped, arming{occ: o, due: due})
+			continue
+		}
+
+		arms = append(arms, arming{occ: o, due: due})
+	}
+
+	arms, missed := s.triage(arms, now)
+
+	// Misfire and calendar decisions are the scheduler's, whoever asked for
+	// the reminders to be armed.
+	ctx = WithActor(ctx, "scheduler")
+
+	if err := s.Repo.MarkSkipped(ctx, reminderIDs(skipped)); err != nil {
+		return err
+	}
+
+	if err := s.Repo.MarkMissed(ctx, reminderIDs(missed)); err != nil {
+		return err
+	}
+
+	items := make([]twheel.Item, len(arms))
+	refs := make([]*armedTimer, len(arms))
+
+	for i, a := range arms {
+		deadline := a.due
+		late := deadline.Before(now)
+		if late {
+			deadline = now
+		}
+
+		refs[i] = &armedTimer{due: a.occ.Reminder.DueAtUTC, deadline: deadline}
+		items[i] = twheel.Item{Deadline: deadline, Task: s.deliverTask(a, late, refs[i])}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stale []uint64
+	for _, a := range append(append(skipped, missed...), arms...) {
+		if t, ok := s.timers[a.occ.ID][a.occ.Reminder.ID]; ok {
+			stale = append(stale, t.id)
+			delete(s.timers[a.occ.ID], a.occ.Reminder.ID)
+		}
+	}
+
+	s.Wh.CancelBatch(stale)
+
+	ids := s.Wh.AtBatch(items)
+	for i, a := range arms {
+		refs[i].id = ids[i]
+
+		byReminder, ok := s.timers[a.occ.ID]
+		if !ok {
+			byReminder = make(map[int64]*armedTimer)
+			s.timers[a.occ.ID] = byReminder
+		}
+
+		byReminder[a.occ.Reminder.ID] = refs[i]
 	}
 
 	return nil
 }
 
-func (s *Scheduler) ScheduleNew(j Job) {
-	s.scheduleJob(j)
+// Cancel disarms the wheel timers of all reminders of a job.
+func (s *Scheduler) Cancel(jobID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byReminder, ok := s.timers[jobID]
+	if !ok {
+		return false
+	}
+
+	delete(s.timers, jobID)
+
+	ids := make([]uint64, 0, len(byReminder))
+	for _, t := range byReminder {
+		ids = append(ids, t.id)
+	}
+
+	return s.Wh.CancelBatch(ids) > 0
+}
+
+// Timers returns the wheel timers armed for a job's reminders, by
+// reminder id. Pending reminders without one are due after LoadedUntil or
+// are being delivered.
+func (s *Scheduler) Timers(jobID int64) map[int64]TimerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[int64]TimerState, len(s.timers[jobID]))
+	for id, t := range s.timers[jobID] {
+		res[id] = TimerState{TimerID: t.id, Deadline: t.deadline}
+	}
+
+	return res
+}
+
+// LoadedUntil is the end of the window of armed reminders.
+func (s *Scheduler) LoadedUntil() time.Time {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	return s.loadedUntil
 }
 
-func (s *Scheduler) scheduleJob(j Job) {
+var ErrNotFireable = errors.New("job has no pending reminder to fire")
+
+// FireNow delivers the next pending reminder of a job right away, ignoring
+// its calendar, and returns it. The delivery is recorded as made by the
+// actor of ctx.
+func (s *Scheduler) FireNow(ctx context.Context, jobID int64) (Reminder, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	occs, err := s.Repo.PendingOccurrences(ctx, []int64{jobID}, endOfTime)
+	if err != nil {
+		return Reminder{}, err
+	}
+
+	if len(occs) == 0 {
+		return Reminder{}, ErrNotFireable
+	}
+
+	o := occs[0]
 	now := time.Now().UTC()
-	deadline := j.DueAtUTC
-	if deadline.Before(now) {
-		deadline = now
+	ref := &armedTimer{due: o.Reminder.DueAtUTC, deadline: now}
+	task := s.deliverTask(arming{occ: o, due: o.Reminder.DueAtUTC, actor: ActorFrom(ctx), note: ActorNoteFrom(ctx)}, false, ref)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byReminder, ok := s.timers[jobID]
+	if !ok {
+		byReminder = make(map[int64]*armedTimer)
+		s.timers[jobID] = byReminder
 	}
 
-	s.Wh.At(deadline, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if t, ok := byReminder[o.Reminder.ID]; ok {
+		s.Wh.Cancel(t.id)
+	}
+
+	byReminder[o.Reminder.ID] = ref
+	ref.id = s.Wh.At(now, task)
+
+	return o.Reminder, nil
+}
+
+// endOfTime is later than any due time.
+var endOfTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// arming is a reminder on its way into the wheel, with the due time after
+// its job's calendar has been applied. Its delivery is recorded as made by
+// actor, the scheduler if empty, with the actor's note. failures counts the
+// publishes of it that failed so far.
+type arming struct {
+	occ      Occurrence
+	due      time.Time
+	actor    string
+	note     string
+	failures int
+}
+
+func reminderIDs(arms []arming) []int64 {
+	ids := make([]int64, len(arms))
+	for i, a := range arms {
+		ids[i] = a.occ.Reminder.ID
+	}
+
+	return ids
+}
+
+func (s *Scheduler) deliverTask(a arming, late bool, ref *armedTimer) twheel.Task {
+	j, rem := a.occ.Job, a.occ.Reminder
+
+	return func() {
+		s.mu.Lock()
+		if s.timers[j.ID][rem.ID] == ref {
+			delete(s.timers[j.ID], rem.ID)
+			if len(s.timers[j.ID]) == 0 {
+				delete(s.timers, j.ID)
+			}
+		}
+		s.mu.Unlock()
+
+		actor := a.actor
+		if actor == "" {
+			actor = "scheduler"
+		}
+
+		bg := WithActorNote(WithActor(context.Background(), actor), a.note)
+
+		// Every scheduler sharing the database arms the reminder; the one
+		// that claims it delivers it. Only that one takes a delivery slot
+		// from the rate limiter, and its claim has to outlast the wait.
+		claimed, delay, ok := s.claim(bg, j, rem)
+		if !claimed {
+			return
+		}
+
+		time.Sleep(delay)
+
+		ctx, cancel := context.WithTimeout(bg, 5*time.Second)
 		defer cancel()
 
-		ev := DueEvent{ID: j.ID, Title: j.Title, RunAtUTC: j.RunAtUTC, DueAtUTC: j.DueAtUTC, TZ: j.TZ}
-		if err := s.Pub.PublishJSON(ctx, ev, keyFor(j.ID)); err != nil {
-			log.Printf("publish failed job=%d err=%v", j.ID, err)
+		ev := DueEvent{
+			ID:            j.ID,
+			Title:         j.Title,
+			RunAtUTC:      j.RunAtUTC,
+			DueAtUTC:      rem.DueAtUTC,
+			TZ:            j.TZ,
+			Tenant:        j.Tenant,
+			Labels:        j.Labels,
+			Payload:       j.Payload,
+			ReminderID:    rem.ID,
+			OffsetMinutes: rem.OffsetMinutes,
+			SnoozeCount:   rem.SnoozeCount,
+			SnoozedFrom:   rem.SnoozedFrom,
+			Late:          late,
+			DelayedMS:     delay.Milliseconds(),
+			RateLimited:   !ok,
+		}
+		if !a.due.Equal(rem.DueAtUTC) {
+			ev.ShiftedToUTC = a.due
+		}
+		if err := s.Pub.PublishJSON(ctx, ev, keyFor(j.ID, rem.ID)); err != nil {
+			log.Printf("publish failed job=%d reminder=%d err=%v", j.ID, rem.ID, err)
+
+			// The history says when the next attempt is; without the release
+			// the claim keeps it out until the claim runs out.
+			next := time.Now().UTC().Add(retryDelay(a.failures + 1))
+			reason := fmt.Sprintf("%v; next attempt at %s", err, next.Format(time.RFC3339))
+
+			if err := s.Repo.Release(bg, rem.ID, reason); err != nil {
+				log.Printf("release failed job=%d reminder=%d err=%v", j.ID, rem.ID, err)
+				if lease := time.Now().UTC().Add(claimLease); next.Before(lease) {
+					next = lease
+				}
+			}
+
+			s.retry(a, next)
+
 			return
 		}
-		if err := s.Repo.MarkEnqueued(context.Background(), j.ID); err != nil {
-			log.Printf("mark enqueued failed job=%d err=%v", j.ID, err)
+
+		// The history keeps the message as published.
+		msg, _ := json.Marshal(ev)
+		if err := s.Repo.MarkEnqueued(bg, rem.ID, string(msg)); err != nil {
+			log.Printf("mark enqueued failed job=%d reminder=%d err=%v", j.ID, rem.ID, err)
 		}
-	})
+	}
+}
+
+// retryDelay is the wait before trying a reminder again after its
+// failures-th failed publish.
+func retryDelay(failures int) time.Duration {
+	d := retryBackoff
+	for i := 1; i < failures && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, maxRetryBackoff)
+}
+
+// retry re-arms a reminder whose publish failed to be tried again at
+// deadline. A timer armed for the reminder in the meantime, by an edit or a
+// reload, takes precedence.
+func (s *Scheduler) retry(a arming, deadline time.Time) {
+	a.failures++
+
+	j, rem := a.occ.Job, a.occ.Reminder
+	ref := &armedTimer{due: rem.DueAtUTC, deadline: deadline}
+	task := s.deliverTask(a, true, ref)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byReminder, ok := s.timers[j.ID]
+	if !ok {
+		byReminder = make(map[int64]*armedTimer)
+		s.timers[j.ID] = byReminder
+	}
+
+	if _, ok := byReminder[rem.ID]; ok {
+		return
+	}
+
+	byReminder[rem.ID] = ref
+	ref.id = s.Wh.At(deadline, task)
+
+	log.Printf("publish retry job=%d reminder=%d attempt=%d at=%s", j.ID, rem.ID, a.failures+1, deadline.Format(time.RFC3339))
+}
+
+// claim claims a reminder for delivery and, if this scheduler got it,
+// reserves a slot for it with the rate limiter. It returns how long to
+// wait for the slot, and ok false if that would exceed the job's max delay
+// so it is delivered at once instead.
+func (s *Scheduler) claim(bg context.Context, j Job, rem Reminder) (claimed bool, delay time.Duration, ok bool) {
+	ctx, cancel := context.WithTimeout(bg, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	claimed, err := s.Repo.Claim(ctx, rem, now)
+	if err != nil {
+		log.Printf("claim failed job=%d reminder=%d err=%v", j.ID, rem.ID, err)
+		return false, 0, false
+	}
+
+	if !claimed {
+		return false, 0, false
+	}
+
+	delay, ok = s.throttle(j, now)
+	if !ok {
+		log.Printf("rate limit exceeds max delay job=%d tenant=%q max_delay=%s", j.ID, j.Tenant, s.maxDelay(j))
+		return true, 0, false
+	}
+
+	if delay > 0 {
+		log.Printf("rate limited job=%d tenant=%q delay=%s", j.ID, j.Tenant, delay)
+
+		if err := s.Repo.HoldClaim(ctx, rem.ID, now.Add(delay)); err != nil {
+			log.Printf("hold claim failed job=%d reminder=%d err=%v", j.ID, rem.ID, err)
+		}
+	}
+
+	return true, delay, true
 }
 
-func keyFor(id int64) string {
-	return "job-" + fmt.Sprintf("%d", id) + "-" + time.Now().UTC().Format("20060102150405")
+func keyFor(id, reminderID int64) string {
+	return "job-" + fmt.Sprintf("%d-r%d", id, reminderID) + "-" + time.Now().UTC().Format("20060102150405")
 }
@@ -0,0 +1,418 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+	"github.com/yplog/ticktockbox/internal/ratelimit"
+	"github.com/yplog/ticktockbox/internal/twheel"
+)
+
+// fakeWheel records armed timers and only fires them when told to.
+type fakeWheel struct {
+	mu     sync.Mutex
+	nextID uint64
+	armed  map[uint64]time.Time
+	tasks  map[uint64]twheel.Task
+}
+
+func newFakeWheel() *fakeWheel {
+	return &fakeWheel{armed: make(map[uint64]time.Time), tasks: make(map[uint64]twheel.Task)}
+}
+
+// fire runs the task of an armed timer, as the wheel would at its deadline.
+func (w *fakeWheel) fire(t *testing.T, id uint64) {
+	t.Helper()
+
+	w.mu.Lock()
+	task, ok := w.tasks[id]
+	delete(w.armed, id)
+	delete(w.tasks, id)
+	w.mu.Unlock()
+
+	if !ok {
+		t.Fatalf("timer %d is not armed", id)
+	}
+
+	task()
+}
+
+func (w *fakeWheel) At(deadline time.Time, f twheel.Task) uint64 {
+	return w.AtBatch([]twheel.Item{{Deadline: deadline, Task: f}})[0]
+}
+
+func (w *fakeWheel) AtBatch(items []twheel.Item) []uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]uint64, len(items))
+	for i, it := range items {
+		w.nextID++
+		w.armed[w.nextID] = it.Deadline
+		w.tasks[w.nextID] = it.Task
+		ids[i] = w.nextID
+	}
+
+	return ids
+}
+
+func (w *fakeWheel) Cancel(id uint64) bool {
+	return w.CancelBatch([]uint64{id}) == 1
+}
+
+func (w *fakeWheel) CancelBatch(ids []uint64) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := 0
+	for _, id := range ids {
+		if _, ok := w.armed[id]; ok {
+			delete(w.armed, id)
+			delete(w.tasks, id)
+			n++
+		}
+	}
+
+	return n
+}
+
+// TestRefillArmsOtherReplicasReminders runs two schedulers on one store, as
+// two replicas sharing a database: reminders one of them adds or moves
+// inside the other's loaded window are armed there on its next Refill.
+func TestRefillArmsOtherReplicasReminders(t *testing.T) {
+	store := NewMemStore()
+
+	a := NewScheduler(store, nil, newFakeWheel())
+	b := NewScheduler(store, nil, newFakeWheel())
+
+	for _, s := range []*Scheduler{a, b} {
+		if err := s.Warmup(testCtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := time.Now().UTC().Add(30 * time.Minute).Truncate(time.Second)
+
+	j := Job{Title: "shared", TZ: "UTC", RunAtUTC: run, Reminders: OffsetReminders([]int{5})}
+
+	id, err := store.Insert(testCtx, &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.ScheduleNew(testCtx, get(t, store, id)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := func(s *Scheduler) time.Time {
+		t.Helper()
+
+		timers := s.Timers(id)
+		if len(timers) != 1 {
+			t.Fatalf("%d timers armed, want 1", len(timers))
+		}
+
+		for _, tm := range timers {
+			return tm.Deadline
+		}
+
+		return time.Time{}
+	}
+
+	if n := len(b.Timers(id)); n != 0 {
+		t.Fatalf("other replica armed %d timers before Refill", n)
+	}
+
+	if err := b.Refill(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := deadline(b), run.Add(-5*time.Minute); !got.Equal(want) {
+		t.Fatalf("armed for %v after Refill, want %v", got, want)
+	}
+
+	// Moved on the first replica, the reminder is re-armed on the second.
+	moved := Job{ID: id, Title: "shared", TZ: "UTC", RunAtUTC: run.Add(10 * time.Minute), Reminders: OffsetReminders([]int{5})}
+	if err := a.UpdateJob(testCtx, &moved); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Refill(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := deadline(b), run.Add(5*time.Minute); !got.Equal(want) {
+		t.Fatalf("armed for %v after the move, want %v", got, want)
+	}
+
+	// A Refill with nothing new leaves the timer alone.
+	before := b.Timers(id)
+
+	if err := b.Refill(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	for rid, tm := range b.Timers(id) {
+		if tm.TimerID != before[rid].TimerID {
+			t.Fatalf("reminder %d re-armed by an idle Refill", rid)
+		}
+	}
+}
+
+// TestClaimBeforeThrottle has two replicas race for the same reminders
+// under a rate limit of one delivery a minute: the one that loses a claim
+// keeps its token, and the one that waits keeps its claim while it does.
+func TestClaimBeforeThrottle(t *testing.T) {
+	store := NewMemStore()
+
+	a := NewScheduler(store, nil, newFakeWheel())
+	b := NewScheduler(store, nil, newFakeWheel())
+
+	for _, s := range []*Scheduler{a, b} {
+		s.Limiter = ratelimit.NewBucket(1.0/60, 1)
+	}
+
+	id := insert(t, store, "limited", 0, 10, 0)
+	j := get(t, store, id)
+	rs := reminders(t, store, id)
+
+	if claimed, delay, _ := a.claim(testCtx, j, rs[0]); !claimed || delay != 0 {
+		t.Fatalf("first claim = %v after %s, want true right away", claimed, delay)
+	}
+
+	if claimed, _, _ := b.claim(testCtx, j, rs[0]); claimed {
+		t.Fatal("both replicas claimed the reminder")
+	}
+
+	if wait := b.Limiter.Reserve(time.Now()); wait != 0 {
+		t.Errorf("losing the claim cost a token: next delivery waits %s", wait)
+	}
+
+	claimed, delay, ok := a.claim(testCtx, j, rs[1])
+	if !claimed || !ok || delay < 50*time.Second {
+		t.Fatalf("second claim = %v after %s (ok %v), want a wait of about a minute", claimed, delay, ok)
+	}
+
+	if ok, _ := store.Claim(testCtx, rs[1], time.Now().Add(claimLease+time.Second)); ok {
+		t.Error("the claim ran out while its delivery waited for the rate limiter")
+	}
+}
+
+// flakyPublisher fails the first fails publishes.
+type flakyPublisher struct {
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+func (p *flakyPublisher) PublishJSON(ctx context.Context, v any, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.calls <= p.fails {
+		return errors.New("broker down")
+	}
+
+	return nil
+}
+
+// TestRetryAfterPublishFailure has the broker fail the first two publishes
+// of a reminder: each failure re-arms it after a longer backoff, and the
+// third attempt delivers it.
+func TestRetryAfterPublishFailure(t *testing.T) {
+	store := NewMemStore()
+	wh := newFakeWheel()
+	pub := &flakyPublisher{fails: 2}
+	s := NewScheduler(store, pub, wh)
+
+	id := insert(t, store, "flaky", 0)
+
+	occs, err := store.PendingOccurrences(testCtx, []int64{id}, endOfTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ScheduleBatch(testCtx, occs); err != nil {
+		t.Fatal(err)
+	}
+
+	timer := func() TimerState {
+		t.Helper()
+
+		timers := s.Timers(id)
+		if len(timers) != 1 {
+			t.Fatalf("%d timers armed, want 1", len(timers))
+		}
+
+		for _, tm := range timers {
+			return tm
+		}
+
+		return TimerState{}
+	}
+
+	for attempt, backoff := range []time.Duration{retryBackoff, 2 * retryBackoff} {
+		before := time.Now()
+		wh.fire(t, timer().TimerID)
+
+		if pub.calls != attempt+1 {
+			t.Fatalf("%d publishes after attempt %d", pub.calls, attempt+1)
+		}
+
+		if got := statuses(t, store, id); got != "pending" {
+			t.Fatalf("reminder %s after a failed publish, want pending", got)
+		}
+
+		if d := timer().Deadline.Sub(before); d < backoff || d > backoff+time.Second {
+			t.Errorf("attempt %d re-armed %s later, want %s", attempt+2, d, backoff)
+		}
+	}
+
+	wh.fire(t, timer().TimerID)
+
+	if pub.calls != 3 {
+		t.Fatalf("%d publishes, want 3", pub.calls)
+	}
+
+	if got := statuses(t, store, id); got != "enqueued" {
+		t.Errorf("reminder %s after the third attempt, want enqueued", got)
+	}
+
+	if n := len(s.Timers(id)); n != 0 {
+		t.Errorf("%d timers left after delivery", n)
+	}
+
+	if got, want := kinds(t, store, id), "created,retried,retried,enqueued"; got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+
+	events, err := store.Events(testCtx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := events[1].Details; !strings.HasPrefix(d, "broker down; next attempt at ") {
+		t.Errorf("retried event details = %q, want the error and the next attempt", d)
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	s := NewScheduler(NewMemStore(), nil, newFakeWheel())
+
+	for _, c := range []*calendar.Calendar{
+		{Name: "office", Hours: map[string][]string{"mon": {"09:00-17:00"}}},
+		{Name: "strict", Hours: map[string][]string{"mon": {"09:00-17:00"}}, OnBlocked: calendar.ActionSkip},
+		{Name: "closed", Holidays: []string{"2030-01-07"}, Hours: map[string][]string{"mon": {"09:00-17:00"}}},
+	} {
+		if err := s.Calendars.Put(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// base is Monday 2030-01-07 12:00 UTC, 15:00 in Istanbul.
+	for _, tc := range []struct {
+		calendar string
+		tz       string
+		due      time.Time
+		want     time.Time
+		skip     bool
+	}{
+		{"", "UTC", base.Add(-6 * time.Hour), base.Add(-6 * time.Hour), false},
+		{"missing", "UTC", base.Add(-6 * time.Hour), base.Add(-6 * time.Hour), false},
+		{"office", "UTC", base, base, false},
+		{"office", "UTC", base.Add(-6 * time.Hour), base.Add(-3 * time.Hour), false},
+		{"office", "Europe/Istanbul", base.Add(3 * time.Hour), base.AddDate(0, 0, 7).Add(-6 * time.Hour), false},
+		{"strict", "UTC", base, base, false},
+		{"strict", "UTC", base.Add(-6 * time.Hour), base.Add(-6 * time.Hour), true},
+		{"closed", "UTC", base, base.AddDate(0, 0, 7).Add(-3 * time.Hour), false},
+	} {
+		got, skip := s.Adjust(Job{Calendar: tc.calendar, TZ: tc.tz}, tc.due)
+		if !got.Equal(tc.want) || skip != tc.skip {
+			t.Errorf("Adjust(%q in %s, %v) = %v, %v, want %v, %v", tc.calendar, tc.tz, tc.due, got, skip, tc.want, tc.skip)
+		}
+	}
+}
+
+// TestCalendarChangeRearms puts, changes and deletes the calendar of an
+// armed job: each change re-arms it for its new delivery time, and leaves
+// jobs on other calendars alone.
+func TestCalendarChangeRearms(t *testing.T) {
+	store := NewMemStore()
+	wh := newFakeWheel()
+	s := NewScheduler(store, nil, wh)
+
+	run := time.Now().UTC().Add(30 * time.Minute).Truncate(time.Second)
+	day := run.Format(time.DateOnly)
+	nextDay := time.Date(run.Year(), run.Month(), run.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	var ids []int64
+	for _, cal := range []string{"office", "other"} {
+		j := Job{Title: cal, TZ: "UTC", RunAtUTC: run, Calendar: cal, Reminders: OffsetReminders([]int{0})}
+
+		id, err := store.Insert(testCtx, &j)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := s.Warmup(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	timer := func(id int64) TimerState {
+		t.Helper()
+
+		for _, tm := range s.Timers(id) {
+			return tm
+		}
+
+		t.Fatalf("job %d has no timer", id)
+
+		return TimerState{}
+	}
+
+	other := timer(ids[1])
+
+	for _, step := range []struct {
+		name string
+		put  *calendar.Calendar // nil deletes the calendar
+		want time.Time          // zero for skipped
+	}{
+		{"holiday", &calendar.Calendar{Name: "office", Holidays: []string{day}}, nextDay},
+		{"no longer a holiday", &calendar.Calendar{Name: "office"}, run},
+		{"holiday again", &calendar.Calendar{Name: "office", Holidays: []string{day}}, nextDay},
+		{"deleted", nil, run},
+		{"skipped", &calendar.Calendar{Name: "office", Holidays: []string{day}, OnBlocked: calendar.ActionSkip}, time.Time{}},
+	} {
+		var err error
+		if step.put != nil {
+			err = s.PutCalendar(testCtx, step.put)
+		} else {
+			err = s.DeleteCalendar(testCtx, "office")
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if step.want.IsZero() {
+			if n := len(s.Timers(ids[0])); n != 0 || statuses(t, store, ids[0]) != "skipped" {
+				t.Errorf("%s: %d timers, reminder %s, want it skipped", step.name, n, statuses(t, store, ids[0]))
+			}
+		} else if got := timer(ids[0]).Deadline; !got.Equal(step.want) {
+			t.Errorf("%s: armed for %v, want %v", step.name, got, step.want)
+		}
+
+		if timer(ids[1]) != other {
+			t.Errorf("%s: re-armed a job on another calendar", step.name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package jobs
+
+import "strings"
+
+// searchWeights are the bm25 column weights of jobs_fts: a match in the
+// title counts ten times as much as one in the payload.
+const searchWeights = "10.0, 1.0"
+
+// tsRankWeights are the same weights for PostgreSQL's ts_rank, given for
+// the D, C, B and A labels; the title is A and the payload B.
+const tsRankWeights = "{0, 0, 0.1, 1.0}"
+
+// ftsQuery turns free text typed by a user into an FTS5 query. Every word
+// becomes a quoted prefix term, so operators and punctuation are matched
+// literally instead of failing to parse, and all words must match.
+func ftsQuery(q string) string {
+	var terms []string
+
+	for _, w := range strings.Fields(q) {
+		w = strings.ReplaceAll(w, `"`, "")
+		if w == "" {
+			continue
+		}
+
+		terms = append(terms, `"`+w+`"*`)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// tsQuery is ftsQuery for PostgreSQL's to_tsquery: quoted prefix lexemes
+// joined with &.
+func tsQuery(q string) string {
+	var terms []string
+
+	for _, w := range strings.Fields(q) {
+		w = strings.ReplaceAll(w, `"`, "")
+		if w == "" {
+			continue
+		}
+
+		w = strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(w)
+		terms = append(terms, `'`+w+`':*`)
+	}
+
+	return strings.Join(terms, " & ")
+}
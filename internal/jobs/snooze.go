@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrNotSnoozable = errors.New("job has no delivered reminder to snooze")
+
+// Snoozable reports whether Snooze would accept the job, judging by its
+// Reminders: it is not cancelled and one of them has been delivered.
+func (j Job) Snoozable() bool {
+	if j.Status == "cancelled" {
+		return false
+	}
+
+	for _, r := range j.Reminders {
+		if r.Status == "enqueued" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Snooze adds a follow-up reminder at the given time to the latest delivered
+// reminder of a job that is not cancelled, links it to that reminder and
+// puts the job back to pending, due at its next pending reminder. A job
+// with several offsets stays pending after its first delivery, so it is the
+// reminder that has to be delivered, not the job. It returns the job, with
+// its labels and the new reminder as its only entry in Reminders.
+func (r *Repo) Snooze(ctx context.Context, jobID int64, at time.Time) (Job, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Job{}, err
+	}
+
+	defer tx.Rollback()
+
+	j, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, jobID))
+	if err != nil {
+		return Job{}, err
+	}
+
+	if j.Status == "cancelled" {
+		return Job{}, ErrNotSnoozable
+	}
+
+	var orig Reminder
+	err = tx.QueryRowContext(ctx, `
+	  SELECT `+reminderColumns+`
+	  FROM job_reminders
+	  WHERE job_id = ? AND status = 'enqueued'
+	  ORDER BY due_at_utc DESC, id DESC
+	  LIMIT 1`, jobID).Scan(reminderDest(&orig)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotSnoozable
+	}
+
+	if err != nil {
+		return Job{}, err
+	}
+
+	at = at.UTC()
+	rem := Reminder{
+		JobID:         jobID,
+		OffsetMinutes: int(j.RunAtUTC.Sub(at) / time.Minute),
+		DueAtUTC:      at,
+		Status:        "pending",
+		SnoozedFrom:   orig.ID,
+		SnoozeCount:   orig.SnoozeCount + 1,
+	}
+
+	err = tx.QueryRowContext(ctx, `
+	  INSERT INTO job_reminders(job_id, offset_minutes, due_at_utc, status, snoozed_from, snooze_count)
+	  VALUES (?, ?, ?, 'pending', ?, ?)
+	  RETURNING id`,
+		rem.JobID, rem.OffsetMinutes, rem.DueAtUTC, rem.SnoozedFrom, rem.SnoozeCount).Scan(&rem.ID)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE jobs SET status = 'pending' WHERE id = ?`, jobID); err != nil {
+		return Job{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, settleJobsSQL+` AND id = ?`, jobID); err != nil {
+		return Job{}, err
+	}
+
+	j, err = scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, jobID))
+	if err != nil {
+		return Job{}, err
+	}
+
+	if _, err := addEvent(ctx, tx, jobID, rem.ID, EventSnoozed, snoozeDetails(at)); err != nil {
+		return Job{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Job{}, err
+	}
+
+	j.Reminders = []Reminder{rem}
+
+	labels, err := r.LabelsFor(ctx, []int64{jobID})
+	if err != nil {
+		return Job{}, err
+	}
+
+	j.Labels = labels[jobID]
+
+	return j, nil
+}
+
+// Snooze creates a follow-up reminder for a delivered job and arms it like
+// any other reminder.
+func (s *Scheduler) Snooze(ctx context.Context, jobID int64, at time.Time) (Reminder, error) {
+	j, err := s.Repo.Snooze(ctx, jobID, at)
+	if err != nil {
+		return Reminder{}, err
+	}
+
+	if err := s.ScheduleNew(ctx, j); err != nil {
+		return Reminder{}, err
+	}
+
+	return j.Reminders[0], nil
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+)
+
+// Store keeps jobs, their reminders, labels and history, calendar feeds
+// and calendars. *Repo stores them in SQLite or PostgreSQL and *MemStore in
+// memory; the methods are documented on Repo. Lookups of a missing job or
+// feed fail with sql.ErrNoRows in both.
+type Store interface {
+	Insert(ctx context.Context, j *Job) (int64, error)
+	InsertBatch(ctx context.Context, batch []*Job) error
+	Get(ctx context.Context, id int64) (Job, error)
+	Update(ctx context.Context, j *Job) error
+	GetUpcoming(ctx context.Context, limit int) ([]Job, error)
+	TimeZones(ctx context.Context) ([]string, error)
+	GetJobsPaginated(ctx context.Context, filter JobFilter) (*JobPage, error)
+	ListJobs(ctx context.Context, filter JobFilter) (*CursorPage, error)
+	Export(ctx context.Context, w io.Writer, format string, filter JobFilter) (int, error)
+
+	RemindersFor(ctx context.Context, jobIDs []int64) (map[int64][]Reminder, error)
+	LabelsFor(ctx context.Context, jobIDs []int64) (map[int64]map[string]string, error)
+	LoadPendingBetween(ctx context.Context, from, to time.Time) ([]Occurrence, error)
+	PendingOccurrences(ctx context.Context, jobIDs []int64, before time.Time) ([]Occurrence, error)
+
+	Claim(ctx context.Context, rem Reminder, now time.Time) (bool, error)
+	HoldClaim(ctx context.Context, reminderID int64, until time.Time) error
+	Release(ctx context.Context, reminderID int64, reason string) error
+	MarkEnqueued(ctx context.Context, reminderID int64, message string) error
+	MarkMissed(ctx context.Context, reminderIDs []int64) error
+	MarkSkipped(ctx context.Context, reminderIDs []int64) error
+	Snooze(ctx context.Context, jobID int64, at time.Time) (Job, error)
+
+	Events(ctx context.Context, jobID int64) ([]Event, error)
+	Ack(ctx context.Context, jobID, reminderID int64, details string) (Event, error)
+
+	Cancel(ctx context.Context, id int64) error
+	CancelJobs(ctx context.Context, sel Selection) ([]int64, error)
+	DeleteJobs(ctx context.Context, sel Selection) ([]int64, error)
+	ShiftJobs(ctx context.Context, sel Selection, d time.Duration) ([]int64, error)
+	RelabelJobs(ctx context.Context, sel Selection, set map[string]string, remove []string) ([]int64, error)
+	SyncExternal(ctx context.Context, series string, js []*Job, from, to time.Time) (SyncResult, error)
+
+	CreateFeed(ctx context.Context, name string, filter JobFilter) (Feed, error)
+	Feed(ctx context.Context, token string) (Feed, error)
+	ListFeeds(ctx context.Context) ([]Feed, error)
+	DeleteFeed(ctx context.Context, token string) error
+	FeedJobs(ctx context.Context, f Feed, now time.Time) ([]Job, error)
+
+	ListCalendars(ctx context.Context) ([]*calendar.Calendar, error)
+	UpsertCalendar(ctx context.Context, c *calendar.Calendar) error
+	DeleteCalendar(ctx context.Context, name string) error
+}
+
+var (
+	_ Store = (*Repo)(nil)
+	_ Store = (*MemStore)(nil)
+)
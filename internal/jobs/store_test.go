@@ -0,0 +1,1061 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/calendar"
+	"github.com/yplog/ticktockbox/internal/db"
+)
+
+// testStores returns constructors of fresh, empty stores for each
+// implementation the conformance suite runs against. The PostgreSQL one
+// needs a postgres:// URL in TICKTOCK_TEST_POSTGRES and gets a new schema
+// on that server, dropped afterwards.
+func testStores() map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemStore() },
+		"sqlite": func(t *testing.T) Store {
+			sqlDB, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { sqlDB.Close() })
+
+			if err := db.Migrate(context.Background(), sqlDB); err != nil {
+				t.Fatal(err)
+			}
+
+			return &Repo{DB: sqlDB}
+		},
+		"postgres": func(t *testing.T) Store {
+			dsn := os.Getenv("TICKTOCK_TEST_POSTGRES")
+			if dsn == "" {
+				t.Skip("TICKTOCK_TEST_POSTGRES is not set")
+			}
+
+			admin, err := db.Open(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { admin.Close() })
+
+			schema := fmt.Sprintf("ticktock_test_%d", time.Now().UnixNano())
+			if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+			u, err := url.Parse(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+
+			sqlDB, err := db.Open(u.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { sqlDB.Close() })
+
+			if err := db.Migrate(context.Background(), sqlDB); err != nil {
+				t.Fatal(err)
+			}
+
+			return &Repo{DB: sqlDB}
+		},
+	}
+}
+
+// storeTests is the conformance suite every Store must pass. Each test
+// gets an empty store.
+var storeTests = []struct {
+	name string
+	run  func(t *testing.T, s Store)
+}{
+	{"InsertAndGet", testInsertAndGet},
+	{"Missing", testMissing},
+	{"ListJobsCursor", testListJobsCursor},
+	{"Filters", testFilters},
+	{"Search", testSearch},
+	{"ClaimAndDeliver", testClaimAndDeliver},
+	{"SnoozeAndAck", testSnoozeAndAck},
+	{"SnoozeMultiOffset", testSnoozeMultiOffset},
+	{"MissedAndSkipped", testMissedAndSkipped},
+	{"Cancel", testCancel},
+	{"Bulk", testBulk},
+	{"Update", testUpdate},
+	{"SyncExternal", testSyncExternal},
+	{"Feeds", testFeeds},
+	{"Calendars", testCalendars},
+	{"Export", testExport},
+}
+
+func TestStore(t *testing.T) {
+	for name, open := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range storeTests {
+				t.Run(tc.name, func(t *testing.T) { tc.run(t, open(t)) })
+			}
+		})
+	}
+}
+
+// base is the run time test jobs are scheduled around, far enough ahead
+// that none of them is due.
+var base = time.Date(2030, 1, 7, 12, 0, 0, 0, time.UTC)
+
+var testCtx = WithActor(context.Background(), "tester")
+
+// insert stores a job running at base plus run, with the given reminder
+// offsets, and returns its id.
+func insert(t *testing.T, s Store, title string, run time.Duration, offsets ...int) int64 {
+	t.Helper()
+
+	if len(offsets) == 0 {
+		offsets = []int{0}
+	}
+
+	j := Job{
+		Title:     title,
+		TZ:        "UTC",
+		RunAtUTC:  base.Add(run),
+		Reminders: OffsetReminders(offsets),
+	}
+
+	id, err := s.Insert(testCtx, &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func get(t *testing.T, s Store, id int64) Job {
+	t.Helper()
+
+	j, err := s.Get(testCtx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func reminders(t *testing.T, s Store, id int64) []Reminder {
+	t.Helper()
+
+	rs, err := s.RemindersFor(testCtx, []int64{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs[id]
+}
+
+// statuses lists the statuses of a job's reminders in due order.
+func statuses(t *testing.T, s Store, id int64) string {
+	t.Helper()
+
+	var res []string
+	for _, r := range reminders(t, s, id) {
+		res = append(res, r.Status)
+	}
+
+	return strings.Join(res, ",")
+}
+
+// kinds lists the kinds of a job's events, oldest first.
+func kinds(t *testing.T, s Store, id int64) string {
+	t.Helper()
+
+	events, err := s.Events(testCtx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res []string
+	for _, e := range events {
+		res = append(res, e.Kind)
+	}
+
+	return strings.Join(res, ",")
+}
+
+func mustQuery(t *testing.T, s string) url.Values {
+	t.Helper()
+
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+func mustSelector(t *testing.T, s string) Selector {
+	t.Helper()
+
+	sel, err := ParseSelector(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sel
+}
+
+func ids(list []Job) []int64 {
+	res := make([]int64, len(list))
+	for i, j := range list {
+		res[i] = j.ID
+	}
+
+	return res
+}
+
+func testInsertAndGet(t *testing.T, s Store) {
+	j := Job{
+		Title:           "dentist",
+		TZ:              "Europe/Istanbul",
+		RunAtUTC:        base,
+		Reminders:       OffsetReminders([]int{60, 0}),
+		MisfirePolicy:   MisfireSkip,
+		Tenant:          "acme",
+		MaxDelaySeconds: 30,
+		Payload:         "bring the card",
+		Labels:          map[string]string{"team": "ops"},
+	}
+
+	id, err := s.Insert(testCtx, &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := get(t, s, id)
+	if got.Title != "dentist" || got.TZ != "Europe/Istanbul" || got.Status != "pending" || got.Tenant != "acme" ||
+		got.MisfirePolicy != MisfireSkip || got.MaxDelaySeconds != 30 || got.Payload != "bring the card" {
+		t.Errorf("Get = %+v", got)
+	}
+
+	if !got.RunAtUTC.Equal(base) || !got.DueAtUTC.Equal(base.Add(-time.Hour)) || got.RemindBeforeMinutes != 60 {
+		t.Errorf("run %s due %s remind %d, want %s, an hour earlier and 60", got.RunAtUTC, got.DueAtUTC, got.RemindBeforeMinutes, base)
+	}
+
+	rs := reminders(t, s, id)
+	if len(rs) != 2 || rs[0].OffsetMinutes != 60 || rs[1].OffsetMinutes != 0 || !rs[1].DueAtUTC.Equal(base) {
+		t.Errorf("reminders = %+v", rs)
+	}
+
+	labels, err := s.LabelsFor(testCtx, []int64{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !maps.Equal(labels[id], map[string]string{"team": "ops"}) {
+		t.Errorf("labels = %v", labels[id])
+	}
+
+	if k := kinds(t, s, id); k != "created" {
+		t.Errorf("events = %s, want created", k)
+	}
+
+	batch := []*Job{
+		{Title: "one", TZ: "UTC", RunAtUTC: base.Add(time.Hour), Reminders: OffsetReminders([]int{0})},
+		{Title: "two", TZ: "UTC", RunAtUTC: base.Add(2 * time.Hour), Reminders: OffsetReminders([]int{0})},
+	}
+
+	if err := s.InsertBatch(testCtx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if batch[0].ID == 0 || batch[1].ID <= batch[0].ID {
+		t.Errorf("batch ids = %d, %d", batch[0].ID, batch[1].ID)
+	}
+
+	up, err := s.GetUpcoming(testCtx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int64{id, batch[0].ID, batch[1].ID}; !slices.Equal(ids(up), want) {
+		t.Errorf("upcoming = %v, want %v", ids(up), want)
+	}
+}
+
+func testMissing(t *testing.T, s Store) {
+	if _, err := s.Get(testCtx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Get: %v", err)
+	}
+
+	if err := s.Update(testCtx, &Job{ID: 99}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Update: %v", err)
+	}
+
+	if _, err := s.Ack(testCtx, 99, 0, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Ack: %v", err)
+	}
+
+	if _, err := s.Feed(testCtx, "nope"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Feed: %v", err)
+	}
+}
+
+func testListJobsCursor(t *testing.T, s Store) {
+	var all []int64
+	for i := range 7 {
+		// Two jobs share each due time, so ties are broken by id.
+		all = append(all, insert(t, s, fmt.Sprintf("job %d", i), time.Duration(i/2)*time.Hour))
+	}
+
+	for _, desc := range []bool{false, true} {
+		want := slices.Clone(all)
+		if desc {
+			slices.Reverse(want)
+		}
+
+		f := JobFilter{Status: "all", Limit: 3, Desc: desc}
+
+		var (
+			got   []int64
+			pages []*CursorPage
+		)
+
+		for {
+			page, err := s.ListJobs(testCtx, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, ids(page.Jobs)...)
+			pages = append(pages, page)
+
+			if page.Next == "" {
+				break
+			}
+
+			f.Cursor = page.Next
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("desc=%v: forward = %v, want %v", desc, got, want)
+		}
+
+		// Back from the last page to the first.
+		got = ids(pages[len(pages)-1].Jobs)
+		for cur := pages[len(pages)-1].Prev; cur != ""; {
+			f.Cursor = cur
+
+			page, err := s.ListJobs(testCtx, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(ids(page.Jobs), got...)
+			cur = page.Prev
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("desc=%v: backward = %v, want %v", desc, got, want)
+		}
+	}
+
+	if _, err := s.ListJobs(testCtx, JobFilter{Cursor: "garbage"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("bad cursor: %v", err)
+	}
+
+	page, err := s.GetJobsPaginated(testCtx, JobFilter{Status: "all", Page: 2, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.Total != 7 || page.TotalPages != 3 || !page.HasNext || !page.HasPrev || !slices.Equal(ids(page.Jobs), all[3:6]) {
+		t.Errorf("page 2 = %+v", page)
+	}
+}
+
+func testFilters(t *testing.T, s Store) {
+	a := insert(t, s, "a", 0)
+	b := insert(t, s, "b", time.Hour)
+	c := insert(t, s, "c", 48*time.Hour)
+
+	if _, err := s.RelabelJobs(testCtx, Selection{IDs: []int64{a, b}}, map[string]string{"team": "ops"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RelabelJobs(testCtx, Selection{IDs: []int64{b}}, map[string]string{"env": "prod"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Cancel(testCtx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []int64
+	}{
+		{"status=pending", []int64{a, b}},
+		{"status=cancelled", []int64{c}},
+		{"status=all&labels=team=ops", []int64{a, b}},
+		{"status=all&labels=team=ops,env!=prod", []int64{a}},
+		{"status=all&labels=!env", []int64{a, c}},
+		{"status=all&run_from=2030-01-08", []int64{c}},
+		{"status=all&sort=title&order=desc", []int64{c, b, a}},
+	} {
+		f, err := ParseFilter(mustQuery(t, tc.query))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, err := s.ListJobs(testCtx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(ids(page.Jobs), tc.want) {
+			t.Errorf("%s = %v, want %v", tc.query, ids(page.Jobs), tc.want)
+		}
+	}
+
+	zones, err := s.TimeZones(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(zones, []string{"UTC"}) {
+		t.Errorf("time zones = %v", zones)
+	}
+}
+
+func testSearch(t *testing.T, s Store) {
+	dentist := insert(t, s, "dentist appointment", 0)
+	insert(t, s, "call plumber", time.Hour)
+
+	j := Job{Title: "weekly sync", TZ: "UTC", RunAtUTC: base, Payload: "ask the dentist about it", Reminders: OffsetReminders([]int{0})}
+
+	sync, err := s.Insert(testCtx, &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := s.GetJobsPaginated(testCtx, JobFilter{Status: "all", Q: "dentist", Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ids(page.Jobs)
+	slices.Sort(got)
+
+	if !slices.Equal(got, []int64{dentist, sync}) {
+		t.Errorf("search = %v, want %v", got, []int64{dentist, sync})
+	}
+
+	// The title match ranks above the payload match.
+	if page.Jobs[0].ID != dentist {
+		t.Errorf("first result = %d, want %d", page.Jobs[0].ID, dentist)
+	}
+}
+
+func testClaimAndDeliver(t *testing.T, s Store) {
+	id := insert(t, s, "deliver", 0, 60, 0)
+	insert(t, s, "later", 24*time.Hour)
+
+	occs, err := s.LoadPendingBetween(testCtx, base.Add(-2*time.Hour), base.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(occs) != 2 || occs[0].Job.ID != id || occs[0].Reminder.OffsetMinutes != 60 || occs[1].Reminder.OffsetMinutes != 0 {
+		t.Fatalf("occurrences = %+v", occs)
+	}
+
+	first := occs[0].Reminder
+	now := time.Now()
+
+	for _, step := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{now, true},
+		{now, false}, // held by the first claim
+		{now.Add(claimLease + time.Second), true}, // the lease ran out
+	} {
+		ok, err := s.Claim(testCtx, first, step.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != step.want {
+			t.Fatalf("claim at %s = %v, want %v", step.now, ok, step.want)
+		}
+	}
+
+	if err := s.Release(testCtx, first.ID, "broker down"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := s.Claim(testCtx, first, now); !ok {
+		t.Fatal("claim after release failed")
+	}
+
+	// A claim held for a rate-limited delivery outlasts the lease, then runs
+	// out like any other.
+	if err := s.HoldClaim(testCtx, first.ID, now.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := s.Claim(testCtx, first, now.Add(claimLease+time.Second)); ok {
+		t.Error("claimed a held reminder")
+	}
+
+	if ok, _ := s.Claim(testCtx, first, now.Add(5*time.Minute+claimLease+time.Second)); !ok {
+		t.Error("held claim did not run out")
+	}
+
+	moved := first
+	moved.DueAtUTC = first.DueAtUTC.Add(time.Minute)
+
+	if ok, _ := s.Claim(testCtx, moved, now.Add(time.Hour)); ok {
+		t.Error("claimed a reminder at a due time it no longer has")
+	}
+
+	if err := s.MarkEnqueued(testCtx, first.ID, `{"id":1}`); err != nil {
+		t.Fatal(err)
+	}
+
+	j := get(t, s, id)
+	if j.Status != "pending" || !j.DueAtUTC.Equal(base) {
+		t.Errorf("after the first reminder: %s due %s, want pending due %s", j.Status, j.DueAtUTC, base)
+	}
+
+	if ok, _ := s.Claim(testCtx, first, now.Add(time.Hour)); ok {
+		t.Error("claimed a delivered reminder")
+	}
+
+	if err := s.MarkEnqueued(testCtx, occs[1].Reminder.ID, `{"id":2}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := get(t, s, id).Status; st != "enqueued" {
+		t.Errorf("after both reminders: %s, want enqueued", st)
+	}
+
+	if k := kinds(t, s, id); k != "created,retried,enqueued,enqueued" {
+		t.Errorf("events = %s", k)
+	}
+
+	events, _ := s.Events(testCtx, id)
+	if e := events[1]; e.Details != "broker down" || e.ReminderID != first.ID || e.Actor != "tester" {
+		t.Errorf("retried event = %+v", e)
+	}
+
+	if e := events[2]; e.Details != `{"id":1}` {
+		t.Errorf("enqueued event details = %q", e.Details)
+	}
+
+	occs, err = s.PendingOccurrences(testCtx, []int64{id}, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(occs) != 0 {
+		t.Errorf("pending occurrences after delivery = %+v", occs)
+	}
+}
+
+func deliverAll(t *testing.T, s Store, id int64) {
+	t.Helper()
+
+	for _, r := range reminders(t, s, id) {
+		if r.Status != "pending" {
+			continue
+		}
+
+		if err := s.MarkEnqueued(testCtx, r.ID, "{}"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testSnoozeAndAck(t *testing.T, s Store) {
+	id := insert(t, s, "snooze", 0)
+
+	if _, err := s.Snooze(testCtx, id, base.Add(time.Hour)); !errors.Is(err, ErrNotSnoozable) {
+		t.Errorf("snooze before delivery: %v", err)
+	}
+
+	if _, err := s.Ack(testCtx, id, 0, ""); !errors.Is(err, ErrNotAckable) {
+		t.Errorf("ack before delivery: %v", err)
+	}
+
+	deliverAll(t, s, id)
+	orig := reminders(t, s, id)[0]
+
+	at := base.Add(10 * time.Minute)
+
+	j, err := s.Snooze(testCtx, id, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if j.Status != "pending" || !j.DueAtUTC.Equal(at) || len(j.Reminders) != 1 {
+		t.Fatalf("snoozed job = %+v", j)
+	}
+
+	r := j.Reminders[0]
+	if r.SnoozedFrom != orig.ID || r.SnoozeCount != 1 || r.OffsetMinutes != -10 || !r.DueAtUTC.Equal(at) {
+		t.Errorf("snooze reminder = %+v", r)
+	}
+
+	if got := get(t, s, id); got.Status != "pending" || !got.DueAtUTC.Equal(at) {
+		t.Errorf("stored job = %s due %s", got.Status, got.DueAtUTC)
+	}
+
+	e, err := s.Ack(WithActorNote(testCtx, "worker"), id, 0, "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Kind != EventAcked || e.ReminderID != orig.ID || e.Details != "done" || e.Actor != "tester" || e.ActorNote != "worker" {
+		t.Errorf("ack = %+v", e)
+	}
+
+	if events, _ := s.Events(testCtx, id); len(events) == 0 || events[len(events)-1] != e {
+		t.Errorf("stored ack = %+v, want %+v", events, e)
+	}
+
+	if _, err := s.Ack(testCtx, id, r.ID, ""); !errors.Is(err, ErrNotAckable) {
+		t.Errorf("ack of a pending snooze: %v", err)
+	}
+
+	if k := kinds(t, s, id); k != "created,enqueued,snoozed,acked" {
+		t.Errorf("events = %s", k)
+	}
+}
+
+// testSnoozeMultiOffset snoozes the first delivery of a job with two
+// reminders, which stays pending until the second is delivered.
+func testSnoozeMultiOffset(t *testing.T, s Store) {
+	id := insert(t, s, "two offsets", 0, 60, 0)
+	rs := reminders(t, s, id)
+
+	if err := s.MarkEnqueued(testCtx, rs[0].ID, "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := get(t, s, id)
+	stored.Reminders = reminders(t, s, id)
+
+	if stored.Status != "pending" || !stored.Snoozable() {
+		t.Fatalf("after the first delivery: %s, snoozable %v", stored.Status, stored.Snoozable())
+	}
+
+	// Snoozed past the next reminder, the job stays due at that one.
+	later := base.Add(10 * time.Minute)
+
+	j, err := s.Snooze(testCtx, id, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if j.Status != "pending" || !j.DueAtUTC.Equal(base) || j.Reminders[0].SnoozedFrom != rs[0].ID {
+		t.Errorf("snoozed past the next reminder: %s due %s, %+v", j.Status, j.DueAtUTC, j.Reminders)
+	}
+
+	// Snoozed before it, the job is due at the snooze.
+	sooner := base.Add(-30 * time.Minute)
+
+	j, err = s.Snooze(testCtx, id, sooner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := get(t, s, id); !j.DueAtUTC.Equal(sooner) || !got.DueAtUTC.Equal(sooner) || got.Status != "pending" {
+		t.Errorf("snoozed before the next reminder: returned due %s, stored %s due %s", j.DueAtUTC, got.Status, got.DueAtUTC)
+	}
+
+	if st := statuses(t, s, id); st != "enqueued,pending,pending,pending" {
+		t.Errorf("reminders = %s", st)
+	}
+
+	// Snoozes are left out of the job's offsets.
+	stored = get(t, s, id)
+	stored.Reminders = reminders(t, s, id)
+
+	if all, pending := stored.Offsets(), stored.Offsets("pending"); fmt.Sprint(all, pending) != "[60 0] [0]" {
+		t.Errorf("offsets = %v, pending %v", all, pending)
+	}
+
+	if err := s.Cancel(testCtx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Snooze(testCtx, id, later); !errors.Is(err, ErrNotSnoozable) {
+		t.Errorf("snooze of a cancelled job: %v", err)
+	}
+}
+
+func testMissedAndSkipped(t *testing.T, s Store) {
+	missed := insert(t, s, "missed", 0, 30, 0)
+	skipped := insert(t, s, "skipped", 0)
+
+	rs := reminders(t, s, missed)
+	if err := s.MarkMissed(testCtx, []int64{rs[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if j := get(t, s, missed); j.Status != "pending" || !j.DueAtUTC.Equal(base) {
+		t.Errorf("after one missed reminder: %s due %s", j.Status, j.DueAtUTC)
+	}
+
+	if err := s.MarkMissed(testCtx, []int64{rs[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := get(t, s, missed).Status; st != "missed" {
+		t.Errorf("status = %s, want missed", st)
+	}
+
+	if err := s.MarkSkipped(testCtx, []int64{reminders(t, s, skipped)[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := get(t, s, skipped).Status; st != "skipped" {
+		t.Errorf("status = %s, want skipped", st)
+	}
+
+	if k := kinds(t, s, missed); k != "created,missed,missed" {
+		t.Errorf("events = %s", k)
+	}
+}
+
+func testCancel(t *testing.T, s Store) {
+	id := insert(t, s, "cancel", 0, 30, 0)
+
+	for range 2 {
+		if err := s.Cancel(testCtx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if st := get(t, s, id).Status; st != "cancelled" {
+		t.Errorf("status = %s", st)
+	}
+
+	if st := statuses(t, s, id); st != "cancelled,cancelled" {
+		t.Errorf("reminders = %s", st)
+	}
+
+	// Cancelling twice records it once.
+	if k := kinds(t, s, id); k != "created,cancelled" {
+		t.Errorf("events = %s", k)
+	}
+}
+
+func testBulk(t *testing.T, s Store) {
+	a := insert(t, s, "a", 0)
+	b := insert(t, s, "b", time.Hour)
+	c := insert(t, s, "c", 2*time.Hour)
+	deliverAll(t, s, c)
+
+	for _, sel := range []Selection{{}, {Filter: &JobFilter{}}, {Filter: &JobFilter{Status: "all"}}} {
+		if _, err := s.DeleteJobs(testCtx, sel); err == nil {
+			t.Errorf("DeleteJobs(%+v) selected every job", sel)
+		}
+	}
+
+	shifted, err := s.ShiftJobs(testCtx, Selection{Filter: &JobFilter{Status: "all", TZ: "UTC"}}, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only pending jobs move.
+	if !slices.Equal(shifted, []int64{a, b}) {
+		t.Errorf("shifted = %v", shifted)
+	}
+
+	if j := get(t, s, a); !j.RunAtUTC.Equal(base.Add(30*time.Minute)) || !j.DueAtUTC.Equal(base.Add(30*time.Minute)) {
+		t.Errorf("shifted job runs %s due %s", j.RunAtUTC, j.DueAtUTC)
+	}
+
+	relabelled, err := s.RelabelJobs(testCtx, Selection{IDs: []int64{a, c, 99}}, map[string]string{"x": "1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(relabelled, []int64{a, c}) {
+		t.Errorf("relabelled = %v", relabelled)
+	}
+
+	cancelled, err := s.CancelJobs(testCtx, Selection{Filter: &JobFilter{Status: "all", Labels: mustSelector(t, "x=1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(cancelled, []int64{a}) {
+		t.Errorf("cancelled = %v", cancelled)
+	}
+
+	if k := kinds(t, s, a); k != "created,edited,edited,cancelled" {
+		t.Errorf("events of a = %s", k)
+	}
+
+	deleted, err := s.DeleteJobs(testCtx, Selection{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(deleted, []int64{a, b, c}) {
+		t.Errorf("deleted = %v", deleted)
+	}
+
+	if _, err := s.Get(testCtx, a); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Get after delete: %v", err)
+	}
+
+	// The history outlives the job.
+	if k := kinds(t, s, a); k != "created,edited,edited,cancelled,deleted" {
+		t.Errorf("events of a after delete = %s", k)
+	}
+}
+
+func testUpdate(t *testing.T, s Store) {
+	id := insert(t, s, "before", 0, 60, 0)
+	first := reminders(t, s, id)[0]
+
+	if err := s.MarkEnqueued(testCtx, first.ID, "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	j := Job{
+		ID:        id,
+		Title:     "after",
+		TZ:        "UTC",
+		RunAtUTC:  base,
+		Labels:    map[string]string{"b": "2"},
+		Payload:   "p",
+		Reminders: OffsetReminders([]int{60, 30}),
+	}
+
+	for range 2 {
+		if err := s.Update(testCtx, &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := get(t, s, id)
+	if got.Title != "after" || got.Payload != "p" || got.Status != "pending" || !got.DueAtUTC.Equal(base.Add(-30*time.Minute)) {
+		t.Errorf("updated job = %+v", got)
+	}
+
+	// The delivered 60 minute reminder is kept and not sent again.
+	rs := reminders(t, s, id)
+	if len(rs) != 2 || rs[0].ID != first.ID || rs[0].Status != "enqueued" || rs[1].OffsetMinutes != 30 || rs[1].Status != "pending" {
+		t.Errorf("reminders = %+v", rs)
+	}
+
+	events, _ := s.Events(testCtx, id)
+	if k := kinds(t, s, id); k != "created,enqueued,edited" {
+		t.Errorf("events = %s", k)
+	} else if d := events[2].Details; d != "title, reminders, labels, payload" {
+		t.Errorf("edited details = %q", d)
+	}
+
+	if err := s.Cancel(testCtx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Update(testCtx, &j); !errors.Is(err, ErrNotEditable) {
+		t.Errorf("update of a cancelled job: %v", err)
+	}
+}
+
+func testSyncExternal(t *testing.T, s Store) {
+	from, to := base.Add(-24*time.Hour), base.Add(24*time.Hour)
+
+	event := func(uid, title string, run time.Duration) *Job {
+		return &Job{
+			Title:      title,
+			TZ:         "UTC",
+			RunAtUTC:   base.Add(run),
+			ExternalID: "cal/" + uid,
+			Reminders:  OffsetReminders([]int{15}),
+		}
+	}
+
+	res, err := s.SyncExternal(testCtx, "cal", []*Job{event("a", "A", 0), event("b", "B", time.Hour)}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Created) != 2 {
+		t.Fatalf("first sync = %+v", res)
+	}
+
+	a, b := res.Created[0], res.Created[1]
+
+	res, err = s.SyncExternal(testCtx, "cal", []*Job{event("a", "A moved", 2*time.Hour)}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(res.Updated, []int64{a}) || !slices.Equal(res.Cancelled, []int64{b}) || len(res.Created) != 0 {
+		t.Errorf("second sync = %+v", res)
+	}
+
+	if j := get(t, s, a); j.Title != "A moved" || !j.RunAtUTC.Equal(base.Add(2*time.Hour)) || j.ExternalID != "cal/a" {
+		t.Errorf("updated job = %+v", j)
+	}
+
+	if st := get(t, s, b).Status; st != "cancelled" {
+		t.Errorf("removed event's job is %s", st)
+	}
+
+	res, err = s.SyncExternal(testCtx, "cal", []*Job{event("a", "A moved", 2*time.Hour)}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(res.Unchanged, []int64{a}) || len(res.IDs()) != 0 {
+		t.Errorf("third sync = %+v", res)
+	}
+}
+
+func testFeeds(t *testing.T, s Store) {
+	ops := insert(t, s, "ops", 0)
+	insert(t, s, "other", time.Hour)
+
+	if _, err := s.RelabelJobs(testCtx, Selection{IDs: []int64{ops}}, map[string]string{"team": "ops"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.CreateFeed(testCtx, "Ops", JobFilter{Status: "pending", Labels: mustSelector(t, "team=ops"), Page: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Feed(testCtx, f.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "Ops" || got.Filter != f.Filter || strings.Contains(got.Filter, "page") {
+		t.Errorf("feed = %+v, created %+v", got, f)
+	}
+
+	list, err := s.FeedJobs(testCtx, got, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ids(list), []int64{ops}) || len(list[0].Reminders) != 1 {
+		t.Errorf("feed jobs = %+v", list)
+	}
+
+	feeds, err := s.ListFeeds(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feeds) != 1 || feeds[0].Token != f.Token {
+		t.Errorf("feeds = %+v", feeds)
+	}
+
+	if err := s.DeleteFeed(testCtx, f.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Feed(testCtx, f.Token); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Feed after delete: %v", err)
+	}
+}
+
+func testCalendars(t *testing.T, s Store) {
+	c := &calendar.Calendar{
+		Name:     "office",
+		Hours:    map[string][]string{"mon": {"09:00-17:00"}},
+		Holidays: []string{"2030-01-01"},
+	}
+
+	if err := c.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := s.UpsertCalendar(testCtx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := s.ListCalendars(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name != "office" || list[0].OnBlocked != calendar.ActionShift || !slices.Equal(list[0].Holidays, c.Holidays) {
+		t.Errorf("calendars = %+v", list)
+	}
+
+	if err := s.DeleteCalendar(testCtx, "office"); err != nil {
+		t.Fatal(err)
+	}
+
+	if list, _ := s.ListCalendars(testCtx); len(list) != 0 {
+		t.Errorf("calendars after delete = %+v", list)
+	}
+}
+
+func testExport(t *testing.T, s Store) {
+	for i := range 5 {
+		insert(t, s, fmt.Sprintf("job %d", i), time.Duration(i)*time.Hour, 30, 0)
+	}
+
+	var buf bytes.Buffer
+
+	n, err := s.Export(testCtx, &buf, "ndjson", JobFilter{Status: "all", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if n != 5 || len(lines) != 5 || !strings.Contains(lines[0], `"remind_before":[30,0]`) {
+		t.Errorf("export wrote %d jobs:\n%s", n, buf.String())
+	}
+
+	// Cells a spreadsheet would run as formulas are quoted in CSV only.
+	insert(t, s, `=HYPERLINK("http://example.com")`, 10*time.Hour)
+
+	buf.Reset()
+
+	if _, err := s.Export(testCtx, &buf, "csv", JobFilter{Status: "all", RunFrom: base.Add(10 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 2 || recs[1][1] != `'=HYPERLINK("http://example.com")` || recs[1][2] != "pending" {
+		t.Errorf("CSV export = %q", recs)
+	}
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/yplog/ticktockbox/internal/ratelimit"
+)
+
+// DefaultMaxDelay caps how long a delivery may be postponed by rate limiting
+// when neither the job nor Scheduler.MaxDelay sets a cap.
+const DefaultMaxDelay = 5 * time.Minute
+
+func (s *Scheduler) maxDelay(j Job) time.Duration {
+	if j.MaxDelaySeconds > 0 {
+		return time.Duration(j.MaxDelaySeconds) * time.Second
+	}
+
+	if s.MaxDelay > 0 {
+		return s.MaxDelay
+	}
+
+	return DefaultMaxDelay
+}
+
+// throttle reserves a delivery slot in the global and tenant buckets and
+// returns how long the delivery has to wait for it. If that is more than the
+// job's max delay the reservation is given back and ok is false: the job is
+// delivered right away and flagged instead of being postponed further.
+func (s *Scheduler) throttle(j Job, now time.Time) (wait time.Duration, ok bool) {
+	var buckets []*ratelimit.Bucket
+
+	if s.Limiter != nil {
+		buckets = append(buckets, s.Limiter)
+	}
+
+	if s.TenantLimiter != nil && j.Tenant != "" {
+		buckets = append(buckets, s.TenantLimiter.Get(j.Tenant))
+	}
+
+	for _, b := range buckets {
+		wait = max(wait, b.Reserve(now))
+	}
+
+	if wait > s.maxDelay(j) {
+		for _, b := range buckets {
+			b.Release()
+		}
+
+		return 0, false
+	}
+
+	return wait, true
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills at rate tokens per second up to
+// burst. Reservations may drive the balance negative; the deficit is how
+// long the caller has to wait.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Reserve takes one token and returns how long to wait before using it.
+func (b *Bucket) Reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Release hands back a token taken by Reserve that will not be used.
+func (b *Bucket) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// idle reports whether the bucket is full at now and nothing has been
+// reserved from it for at least d.
+func (b *Bucket) idle(now time.Time, d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.last.IsZero() {
+		return b.tokens >= b.burst
+	}
+
+	elapsed := now.Sub(b.last)
+
+	return elapsed >= d && b.tokens+elapsed.Seconds()*b.rate >= b.burst
+}
+
+// Keyed keeps one Bucket per key, all with the same rate and burst. A
+// bucket that has been full and unused for longer than it takes to refill
+// one is dropped: a new one for its key starts out full just the same.
+type Keyed struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*Bucket
+
+	now   func() time.Time
+	swept time.Time
+}
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{rate: rate, burst: burst, buckets: make(map[string]*Bucket), now: time.Now}
+}
+
+// refill is how long an empty bucket takes to fill up.
+func (k *Keyed) refill() time.Duration {
+	return time.Duration(float64(max(k.burst, 1)) / k.rate * float64(time.Second))
+}
+
+func (k *Keyed) Get(key string) *Bucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now := k.now(); k.rate > 0 && now.Sub(k.swept) >= k.refill() {
+		k.sweep(now)
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+
+	return b
+}
+
+// sweep drops the buckets that have been idle for a refill period.
+func (k *Keyed) sweep(now time.Time) {
+	k.swept = now
+
+	for key, b := range k.buckets {
+		if b.idle(now, k.refill()) {
+			delete(k.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	t0 := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+
+	b := NewBucket(2, 3) // a token every 500ms, up to 3
+
+	for i, step := range []struct {
+		at      time.Duration // after t0
+		release bool          // release a token instead of reserving one
+		want    time.Duration
+	}{
+		{0, false, 0},
+		{0, false, 0},
+		{0, false, 0},
+		{0, false, 500 * ms}, // the burst is used up
+		{0, false, 1000 * ms},
+		{0, true, 0},          // hands back the last reservation
+		{0, false, 1000 * ms}, // so the next one waits as long
+		{1000 * ms, false, 500 * ms},
+		{1250 * ms, false, 750 * ms}, // refilled half a token
+		{10 * time.Second, false, 0}, // refilled up to the burst, no more
+		{10 * time.Second, false, 0},
+		{10 * time.Second, false, 0},
+		{10 * time.Second, false, 500 * ms},
+	} {
+		if step.release {
+			b.Release()
+			continue
+		}
+
+		if got := b.Reserve(t0.Add(step.at)); got != step.want {
+			t.Errorf("step %d: Reserve at +%s = %s, want %s", i, step.at, got, step.want)
+		}
+	}
+
+	// Releases never fill a bucket past its burst, which is at least 1.
+	b = NewBucket(1, 0)
+	b.Release()
+	b.Release()
+
+	if got := b.Reserve(t0); got != 0 {
+		t.Errorf("first Reserve = %s, want 0", got)
+	}
+
+	if got := b.Reserve(t0); got != time.Second {
+		t.Errorf("second Reserve = %s, want 1s", got)
+	}
+}
+
+// TestKeyedEvictsIdleBuckets drops the buckets that have been full and
+// unused for a refill period, and keeps the ones still paying off a
+// deficit.
+func TestKeyedEvictsIdleBuckets(t *testing.T) {
+	t0 := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0
+
+	k := NewKeyed(1, 5) // refills in 5s
+	k.now = func() time.Time { return now }
+
+	idle := k.Get("idle")
+	idle.Reserve(now)
+
+	busy := k.Get("busy")
+	for range 10 {
+		busy.Reserve(now) // 5 tokens in deficit
+	}
+
+	now = t0.Add(3 * time.Second)
+	if k.Get("idle") != idle || len(k.buckets) != 2 {
+		t.Fatalf("buckets dropped before a refill period: %d left", len(k.buckets))
+	}
+
+	now = t0.Add(6 * time.Second)
+	if k.Get("busy") != busy {
+		t.Error("dropped a bucket that is not full yet")
+	}
+
+	if _, ok := k.buckets["idle"]; ok {
+		t.Error("kept a bucket full and unused for a refill period")
+	}
+
+	if k.Get("idle") == idle {
+		t.Error("Get returned the dropped bucket")
+	}
+
+	now = t0.Add(12 * time.Second)
+	k.Get("other")
+
+	if _, ok := k.buckets["busy"]; ok {
+		t.Error("kept a bucket that has refilled and been unused for a refill period")
+	}
+}
@@ -0,0 +1,112 @@
+package twheel
+
+import "time"
+
+// Item is a single timer for AtBatch.
+type Item struct {
+	Deadline time.Time
+	Task     Task
+}
+
+type cancelBatchReq struct {
+	ids    []uint64
+	result chan int
+}
+
+// AtBatch arms all items in a single loop iteration and returns their IDs in
+// the same order. It is much cheaper than calling At in a loop when arming
+// many timers at once, e.g. on startup.
+func (w *Wheel) AtBatch(items []Item) []uint64 {
+	ids := make([]uint64, len(items))
+	for i := range ids {
+		ids[i] = w.idGen.Add(1)
+	}
+
+	w.addBatch(ids, items)
+
+	return ids
+}
+
+func (w *Wheel) addBatch(ids []uint64, items []Item) {
+	if len(items) == 0 {
+		return
+	}
+
+	reqs := make([]addReq, len(items))
+	for i, it := range items {
+		reqs[i] = addReq{id: ids[i], deadline: it.Deadline.UTC(), task: it.Task}
+	}
+
+	w.size.Add(int64(len(reqs)))
+	w.addBatchCh <- reqs
+}
+
+// CancelBatch cancels all given timers in a single loop iteration and
+// returns how many of them were still armed.
+func (w *Wheel) CancelBatch(ids []uint64) int {
+	if len(ids) == 0 {
+		return 0
+	}
+
+	res := make(chan int, 1)
+	w.cancelBatchCh <- cancelBatchReq{ids: ids, result: res}
+
+	return <-res
+}
+
+func (w *Wheel) placeBatch(reqs []addReq) {
+	for _, a := range reqs {
+		w.place(a)
+	}
+}
+
+func (w *Wheel) handleCancelBatch(c cancelBatchReq) {
+	w.flushAdds()
+
+	n := 0
+	for _, id := range c.ids {
+		if w.doCancel(id) {
+			n++
+		}
+	}
+
+	c.result <- n
+}
+
+func (s *Sharded) AtBatch(items []Item) []uint64 {
+	ids := make([]uint64, len(items))
+	perShard := make([][]int, len(s.shards))
+
+	for i := range items {
+		ids[i] = s.idGen.Add(1)
+		k := ids[i] % uint64(len(s.shards))
+		perShard[k] = append(perShard[k], i)
+	}
+
+	for k, idx := range perShard {
+		shardIDs := make([]uint64, len(idx))
+		shardItems := make([]Item, len(idx))
+		for n, i := range idx {
+			shardIDs[n], shardItems[n] = ids[i], items[i]
+		}
+
+		s.shards[k].addBatch(shardIDs, shardItems)
+	}
+
+	return ids
+}
+
+func (s *Sharded) CancelBatch(ids []uint64) int {
+	perShard := make([][]uint64, len(s.shards))
+	for _, id := range ids {
+		k := id % uint64(len(s.shards))
+		perShard[k] = append(perShard[k], id)
+	}
+
+	n := 0
+	for k, shardIDs := range perShard {
+		n += s.shards[k].CancelBatch(shardIDs)
+	}
+
+	return n
+}
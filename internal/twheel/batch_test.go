@@ -0,0 +1,149 @@
+package twheel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAtBatchCancelBatch arms a batch spanning several rotations, fires
+// part of it, and cancels a range that overlaps the fired timers: only
+// the ones still armed are counted, and only the rest fire.
+func TestAtBatchCancelBatch(t *testing.T) {
+	const (
+		tick  = time.Millisecond
+		slots = 8
+		n     = 40 // timer i is due i ticks after start: up to 4 rounds out
+	)
+
+	w, clock := startFake(t, tick, slots)
+	start := clock.now()
+
+	var (
+		mu    sync.Mutex
+		fired = make(map[int]bool)
+	)
+
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{Deadline: start.Add(time.Duration(i+1) * tick), Task: func() {
+			mu.Lock()
+			fired[i+1] = true
+			mu.Unlock()
+		}}
+	}
+
+	ids := w.AtBatch(items)
+	placed(w)
+
+	if len(ids) != n || w.Len() != n {
+		t.Fatalf("AtBatch returned %d ids and armed %d timers, want %d", len(ids), w.Len(), n)
+	}
+
+	seen := make(map[uint64]bool)
+	for i, id := range ids {
+		if seen[id] {
+			t.Fatalf("id %d returned twice", id)
+		}
+
+		seen[id] = true
+
+		// Slot 0 is due at start + tick, so timer i lands i-1 ticks on.
+		v, ok := w.timers.Load(id)
+		if !ok {
+			t.Fatalf("timer %d is not armed", i+1)
+		}
+
+		tm := v.(*timer)
+		if tm.bucket != w.wheel[i%slots] || tm.rounds != i/slots {
+			t.Errorf("timer %d is not in slot %d with %d rounds to go", i+1, i%slots, i/slots)
+		}
+	}
+
+	// waitFired waits for the timers due by the clock to have fired.
+	waitFired := func(want int) {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			mu.Lock()
+			got := len(fired)
+			mu.Unlock()
+
+			if got >= want {
+				w.tasks.Wait()
+				return
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("%d timers fired, want %d", got, want)
+			}
+		}
+	}
+
+	clock.set(start.Add(10 * tick))
+	waitFired(10)
+
+	// 6..10 have fired, 11..20 are armed; an unknown id and a repeated one
+	// are not counted.
+	cancel := append(append([]uint64{}, ids[5:20]...), ids[12], 1<<40)
+	if got := w.CancelBatch(cancel); got != 10 {
+		t.Errorf("CancelBatch = %d, want the 10 timers still armed", got)
+	}
+
+	if got := w.Len(); got != n-20 {
+		t.Errorf("%d timers armed after the cancel, want %d", got, n-20)
+	}
+
+	clock.set(start.Add(n * tick))
+	waitFired(n - 10)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 1; i <= n; i++ {
+		if want := i <= 10 || i > 20; fired[i] != want {
+			t.Errorf("timer %d fired = %v, want %v", i, fired[i], want)
+		}
+	}
+
+	if got := w.CancelBatch(ids); got != 0 {
+		t.Errorf("CancelBatch of fired timers = %d, want 0", got)
+	}
+
+	if got := w.CancelBatch(nil); got != 0 {
+		t.Errorf("CancelBatch(nil) = %d, want 0", got)
+	}
+}
+
+// TestShardedBatch spreads a batch over the shards and cancels part of it
+// across all of them.
+func TestShardedBatch(t *testing.T) {
+	s := NewSharded(3, time.Second, 8)
+	s.Start()
+
+	defer s.Stop(context.Background())
+
+	deadline := time.Now().Add(time.Hour)
+	items := make([]Item, 10)
+	for i := range items {
+		items[i] = Item{Deadline: deadline, Task: func() { t.Error("timer fired") }}
+	}
+
+	ids := s.AtBatch(items)
+	if len(ids) != len(items) {
+		t.Fatalf("AtBatch returned %d ids, want %d", len(ids), len(items))
+	}
+
+	if got := s.CancelBatch(ids[:7]); got != 7 {
+		t.Errorf("CancelBatch = %d, want 7", got)
+	}
+
+	if got := s.CancelBatch(ids); got != 3 {
+		t.Errorf("second CancelBatch = %d, want the 3 left", got)
+	}
+
+	if got := s.Len(); got != 0 {
+		t.Errorf("%d timers left", got)
+	}
+}
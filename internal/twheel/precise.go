@@ -0,0 +1,82 @@
+package twheel
+
+import (
+	"container/heap"
+	"time"
+)
+
+// timerHeap is a min-heap of timers ordered by deadline.
+type timerHeap []*timer
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*h = old[:n-1]
+
+	return t
+}
+
+// preciseStage holds timers that are closer than one tick to their deadline
+// and waits for them with a single runtime timer armed for the earliest one.
+type preciseStage struct {
+	h     timerHeap
+	timer *time.Timer
+}
+
+func newPreciseStage() *preciseStage {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &preciseStage{timer: t}
+}
+
+func (p *preciseStage) push(t *timer, now time.Time) {
+	heap.Push(&p.h, t)
+	p.rearm(now)
+}
+
+func (p *preciseStage) remove(t *timer, now time.Time) {
+	if t.index < 0 || t.index >= len(p.h) || p.h[t.index] != t {
+		return
+	}
+
+	heap.Remove(&p.h, t.index)
+	p.rearm(now)
+}
+
+func (p *preciseStage) popDue(now time.Time) (due []*timer) {
+	for len(p.h) > 0 && !p.h[0].deadline.After(now) {
+		due = append(due, heap.Pop(&p.h).(*timer))
+	}
+
+	p.rearm(now)
+
+	return due
+}
+
+func (p *preciseStage) rearm(now time.Time) {
+	if len(p.h) == 0 {
+		p.timer.Stop()
+		return
+	}
+
+	p.timer.Reset(max(p.h[0].deadline.Sub(now), 0))
+}
@@ -0,0 +1,89 @@
+package twheel
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPreciseFiresBetweenTicks arms timers a fraction of a tick after a
+// slot's tick. The tick hands them to the precise stage instead of firing
+// them, its runtime timer waits for the earliest deadline rather than the
+// next tick, and a cancelled timer leaves the heap.
+func TestPreciseFiresBetweenTicks(t *testing.T) {
+	const tick = time.Second
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+
+	// The loop is not started: the test delivers the tick and the precise
+	// timer itself, as loop would.
+	w := New(tick, 8, WithPrecision())
+	w.now = clock.now
+	w.next = start.Add(tick)
+
+	fired := make(chan uint64, 2)
+	arm := func(d time.Duration) uint64 {
+		id := w.idGen.Add(1)
+		w.size.Add(1)
+		w.place(addReq{id: id, deadline: start.Add(d), task: func() { fired <- id }})
+
+		return id
+	}
+
+	early := arm(tick + 10*time.Millisecond)
+	later := arm(tick + 40*time.Millisecond)
+
+	ticked := time.Now()
+	clock.set(start.Add(tick))
+	w.advance(w.now())
+
+	if len(w.precise.h) != 2 || w.precise.h[0].id != early {
+		t.Fatalf("precise heap holds %d timers after the tick, want both with %d first", len(w.precise.h), early)
+	}
+
+	select {
+	case id := <-fired:
+		t.Fatalf("timer %d fired on the tick before its deadline", id)
+	default:
+	}
+
+	// Cancelling the earliest timer takes it off the heap and re-arms the
+	// runtime timer for the next one.
+	v, _ := w.timers.Load(early)
+	if !w.doCancel(early) {
+		t.Fatal("cancel of a timer in the precise stage failed")
+	}
+
+	if tm := v.(*timer); tm.index != -1 || len(w.precise.h) != 1 || w.precise.h[0].id != later {
+		t.Fatalf("after cancel: index %d, %d timers on the heap", tm.index, len(w.precise.h))
+	}
+
+	select {
+	case <-w.precise.timer.C:
+	case <-time.After(tick / 2):
+		t.Fatal("precise timer did not go off before half a tick")
+	}
+
+	if waited := time.Since(ticked); waited < 40*time.Millisecond {
+		t.Errorf("precise timer went off after %s, before the remaining timer's deadline", waited)
+	}
+
+	// It goes off at the deadline on the wall clock; fake it.
+	clock.set(start.Add(tick + 40*time.Millisecond))
+	w.fire(w.precise.popDue(w.now()))
+	w.tasks.Wait()
+
+	if got := <-fired; got != later {
+		t.Errorf("timer %d fired, want %d", got, later)
+	}
+
+	if len(w.precise.h) != 0 || w.Len() != 0 {
+		t.Errorf("%d timers on the heap and %d armed after firing", len(w.precise.h), w.Len())
+	}
+
+	select {
+	case id := <-fired:
+		t.Errorf("cancelled timer %d fired", id)
+	default:
+	}
+}
@@ -0,0 +1,110 @@
+package twheel
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sharded spreads timers over several independent wheels, each with its own
+// loop goroutine and channels, so that adds and cancels from many callers do
+// not contend on a single loop. IDs come from one shared counter and encode
+// the owning shard, so Cancel is routed without a lookup table.
+type Sharded struct {
+	shards []*Wheel
+	idGen  atomic.Uint64
+}
+
+// NewSharded creates n wheels with the given tick, slot count and options.
+// If n < 1 it defaults to GOMAXPROCS.
+func NewSharded(n int, tick time.Duration, slots int, opts ...Option) *Sharded {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	s := &Sharded{shards: make([]*Wheel, n)}
+	for i := range s.shards {
+		s.shards[i] = New(tick, slots, opts...)
+	}
+
+	return s
+}
+
+func (s *Sharded) shardFor(id uint64) *Wheel {
+	return s.shards[id%uint64(len(s.shards))]
+}
+
+func (s *Sharded) Start() {
+	for _, w := range s.shards {
+		w.Start()
+	}
+}
+
+func (s *Sharded) Stop(ctx context.Context) error {
+	_, err := s.Shutdown(ctx, ShutdownOptions{})
+
+	return err
+}
+
+// Shutdown shuts all shards down concurrently and merges their unfired
+// timers. The first error reported by any shard is returned.
+func (s *Sharded) Shutdown(ctx context.Context, opts ShutdownOptions) ([]Pending, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		pending  []Pending
+		firstErr error
+	)
+
+	for _, w := range s.shards {
+		wg.Add(1)
+		go func(w *Wheel) {
+			defer wg.Done()
+
+			p, err := w.Shutdown(ctx, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			pending = append(pending, p...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Deadline.Before(pending[j].Deadline) })
+
+	return pending, firstErr
+}
+
+func (s *Sharded) AfterFunc(d time.Duration, f Task) uint64 {
+	id := s.idGen.Add(1)
+
+	return s.shardFor(id).add(id, time.Now().UTC().Add(d), f)
+}
+
+func (s *Sharded) At(deadline time.Time, f Task) uint64 {
+	id := s.idGen.Add(1)
+
+	return s.shardFor(id).add(id, deadline.UTC(), f)
+}
+
+func (s *Sharded) Cancel(id uint64) bool {
+	return s.shardFor(id).Cancel(id)
+}
+
+// Len returns the total number of timers across all shards.
+func (s *Sharded) Len() int {
+	n := 0
+	for _, w := range s.shards {
+		n += w.Len()
+	}
+
+	return n
+}
@@ -0,0 +1,58 @@
+package twheel
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// atter is what the At benchmarks need of a Wheel or a Sharded.
+type atter interface {
+	At(deadline time.Time, f Task) uint64
+	Cancel(id uint64) bool
+	Stop(ctx context.Context) error
+}
+
+// benchmarkAt arms timers an hour out from all goroutines at once, and
+// cancels every 64th to include the round trip through the loop. Run with
+// -cpu 1,2,4,8 to see how the wheel scales with callers.
+func benchmarkAt(b *testing.B, w atter) {
+	deadline := time.Now().Add(time.Hour)
+	noop := func() {}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		n := 0
+		for pb.Next() {
+			id := w.At(deadline, noop)
+
+			if n++; n%64 == 0 {
+				w.Cancel(id)
+			}
+		}
+	})
+
+	b.StopTimer()
+
+	if err := w.Stop(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkWheelAt(b *testing.B) {
+	w := New(time.Second, 512)
+	w.Start()
+
+	benchmarkAt(b, w)
+}
+
+// BenchmarkShardedAt runs one shard per GOMAXPROCS, which -cpu sets.
+func BenchmarkShardedAt(b *testing.B) {
+	w := NewSharded(runtime.GOMAXPROCS(0), time.Second, 512)
+	w.Start()
+
+	benchmarkAt(b, w)
+}
@@ -0,0 +1,113 @@
+package twheel
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Pending describes a timer that was still armed when the wheel shut down.
+type Pending struct {
+	ID       uint64
+	Deadline time.Time
+}
+
+type ShutdownOptions struct {
+	// Grace keeps the wheel ticking until every timer due within this
+	// window has fired, then stops. Zero stops right away.
+	Grace time.Duration
+
+	// WaitTasks blocks until task goroutines that were already started
+	// have returned.
+	WaitTasks bool
+}
+
+// Shutdown stops the wheel and returns the timers that never fired, ordered
+// by deadline. If ctx expires while draining the grace window the wheel is
+// stopped at once; if it expires while waiting for tasks, Shutdown returns
+// the unfired timers together with ctx.Err().
+func (w *Wheel) Shutdown(ctx context.Context, opts ShutdownOptions) ([]Pending, error) {
+	if w.ticker != nil {
+		w.drainOnce.Do(func() { w.drainCh <- w.now().Add(opts.Grace) })
+
+		if err := wait(ctx, &w.wg); err != nil {
+			w.stopOnce.Do(func() { close(w.stopCh) })
+			w.wg.Wait()
+		}
+	}
+
+	pending := w.unfired()
+
+	if opts.WaitTasks {
+		if err := wait(ctx, &w.tasks); err != nil {
+			return pending, err
+		}
+	}
+
+	return pending, ctx.Err()
+}
+
+// drained reports whether the grace window ending at until is over, either
+// because it has passed or because nothing is left to fire inside it.
+func (w *Wheel) drained(until time.Time) bool {
+	if !w.now().Before(until) {
+		return true
+	}
+
+	left := false
+	w.timers.Range(func(_, v any) bool {
+		left = !v.(*timer).deadline.After(until)
+		return !left
+	})
+
+	return !left
+}
+
+// unfired collects armed timers and add requests that never reached the
+// loop. It must only be called once the loop has exited.
+func (w *Wheel) unfired() []Pending {
+	var res []Pending
+
+	w.timers.Range(func(_, v any) bool {
+		t := v.(*timer)
+		res = append(res, Pending{ID: t.id, Deadline: t.deadline})
+		return true
+	})
+
+drain:
+	for {
+		select {
+		case a := <-w.addCh:
+			res = append(res, Pending{ID: a.id, Deadline: a.deadline})
+		case b := <-w.addBatchCh:
+			for _, a := range b {
+				res = append(res, Pending{ID: a.id, Deadline: a.deadline})
+			}
+		case c := <-w.cancelCh:
+			if c.result != nil {
+				c.result <- false
+			}
+		case c := <-w.cancelBatchCh:
+			c.result <- 0
+		default:
+			break drain
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Deadline.Before(res[j].Deadline) })
+
+	return res
+}
+
+func wait(ctx context.Context, wg interface{ Wait() }) error {
+	done := make(chan struct{})
+
+	go func() { wg.Wait(); close(done) }()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,157 @@
+package twheel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// startFake starts a wheel whose loop ticks in real time but reads the
+// fake clock, so slots only come due when the test moves the clock.
+func startFake(t *testing.T, tick time.Duration, slots int, opts ...Option) (*Wheel, *fakeClock) {
+	t.Helper()
+
+	clock := &fakeClock{t: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	w := New(tick, slots, opts...)
+	w.now = clock.now
+	w.Start()
+
+	t.Cleanup(func() { w.Stop(context.Background()) })
+
+	return w, clock
+}
+
+// placed waits until the loop has placed every timer armed so far: a
+// cancel is only handled after the adds queued before it.
+func placed(w *Wheel) { w.Cancel(0) }
+
+// TestShutdownGrace shuts down with a grace window: the timers due inside
+// it fire as the clock gets there, and the later ones are returned unfired.
+func TestShutdownGrace(t *testing.T) {
+	const tick = time.Millisecond
+
+	w, clock := startFake(t, tick, 8)
+	start := clock.now()
+
+	fired := make(chan time.Duration, 10)
+	arm := func(d time.Duration) uint64 {
+		return w.At(start.Add(d), func() { fired <- d })
+	}
+
+	arm(20 * time.Millisecond)
+	arm(50 * time.Millisecond)
+	late := arm(500 * time.Millisecond) // several rotations out
+	lateBatch := w.AtBatch([]Item{{Deadline: start.Add(time.Second), Task: func() { fired <- time.Second }}})
+	placed(w)
+
+	type result struct {
+		pending []Pending
+		err     error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		pending, err := w.Shutdown(context.Background(), ShutdownOptions{Grace: 100 * time.Millisecond})
+		done <- result{pending, err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned before the timers in its grace window fired")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.set(start.Add(50 * time.Millisecond))
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return once the grace window was drained")
+	}
+
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+
+	w.tasks.Wait()
+	close(fired)
+
+	var got []time.Duration
+	for d := range fired {
+		got = append(got, d)
+	}
+
+	if len(got) != 2 || got[0]+got[1] != 70*time.Millisecond {
+		t.Errorf("fired %v, want the timers at 20ms and 50ms", got)
+	}
+
+	want := []Pending{{late, start.Add(500 * time.Millisecond)}, {lateBatch[0], start.Add(time.Second)}}
+	if len(res.pending) != len(want) {
+		t.Fatalf("pending = %v, want %v", res.pending, want)
+	}
+
+	for i := range want {
+		if res.pending[i].ID != want[i].ID || !res.pending[i].Deadline.Equal(want[i].Deadline) {
+			t.Errorf("pending[%d] = %v, want %v", i, res.pending[i], want[i])
+		}
+	}
+}
+
+// TestShutdownWaitTasks blocks until the tasks already running return, or
+// until ctx is done.
+func TestShutdownWaitTasks(t *testing.T) {
+	w, clock := startFake(t, time.Millisecond, 8)
+	start := clock.now()
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+
+	w.At(start.Add(10*time.Millisecond), func() {
+		close(running)
+		<-release
+	})
+	placed(w)
+
+	clock.set(start.Add(10 * time.Millisecond))
+
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timer did not fire")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := w.Shutdown(ctx, ShutdownOptions{WaitTasks: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a running task and an expiring ctx = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := w.Shutdown(context.Background(), ShutdownOptions{WaitTasks: true})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v while a task was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the task did")
+	}
+}
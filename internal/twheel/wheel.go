@@ -18,6 +18,7 @@ type timer struct {
 
 	bucket *bucket
 	elem   *list.Element
+	index  int // position in the precise heap, -1 when not there
 }
 
 type addReq struct {
@@ -38,34 +39,63 @@ type Wheel struct {
 
 	ticker *time.Ticker
 	cur    int
+	next   time.Time // wall-clock instant at which slot cur is due
+	now    func() time.Time
 
-	addCh    chan addReq
-	cancelCh chan cancelReq
-	stopCh   chan struct{}
-	wg       sync.WaitGroup
+	addCh         chan addReq
+	cancelCh      chan cancelReq
+	addBatchCh    chan []addReq
+	cancelBatchCh chan cancelBatchReq
+	drainCh       chan time.Time
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+	tasks         sync.WaitGroup
+
+	drainOnce sync.Once
+	stopOnce  sync.Once
 
 	idGen  atomic.Uint64
 	timers sync.Map // id -> *timer
+	size   atomic.Int64
+
+	precise *preciseStage
+}
+
+type Option func(*Wheel)
+
+// WithPrecision hands timers that land in the current slot to a min-heap
+// backed by a single time.Timer, so they fire at their exact deadline
+// instead of on the next tick. Far-future timers still live in the wheel.
+func WithPrecision() Option {
+	return func(w *Wheel) { w.precise = newPreciseStage() }
 }
 
-func New(tick time.Duration, slots int) *Wheel {
+func New(tick time.Duration, slots int, opts ...Option) *Wheel {
 	if tick <= 0 || slots < 2 {
 		panic("invalid wheel config")
 	}
 
 	w := &Wheel{
-		tick:     tick,
-		slots:    slots,
-		wheel:    make([]*bucket, slots),
-		addCh:    make(chan addReq, 2048),
-		cancelCh: make(chan cancelReq, 2048),
-		stopCh:   make(chan struct{}),
+		tick:          tick,
+		slots:         slots,
+		wheel:         make([]*bucket, slots),
+		addCh:         make(chan addReq, 2048),
+		cancelCh:      make(chan cancelReq, 2048),
+		addBatchCh:    make(chan []addReq, 64),
+		cancelBatchCh: make(chan cancelBatchReq, 64),
+		drainCh:       make(chan time.Time, 1),
+		stopCh:        make(chan struct{}),
+		now:           func() time.Time { return time.Now().UTC() },
 	}
 
 	for i := 0; i < slots; i++ {
 		w.wheel[i] = newBucket()
 	}
 
+	for _, opt := range opts {
+		opt(w)
+	}
+
 	return w
 }
 
@@ -75,26 +105,18 @@ func (w *Wheel) Start() {
 	}
 
 	w.ticker = time.NewTicker(w.tick)
+	w.next = w.now().Add(w.tick)
 	w.wg.Add(1)
 
 	go w.loop()
 }
-func (w *Wheel) Stop(ctx context.Context) error {
-	if w.ticker == nil {
-		return nil
-	}
 
-	close(w.stopCh)
-	done := make(chan struct{})
-
-	go func() { w.wg.Wait(); close(done) }()
+// Stop halts the wheel immediately. Timers that have not fired are dropped
+// and running tasks are not waited for; use Shutdown for a graceful stop.
+func (w *Wheel) Stop(ctx context.Context) error {
+	_, err := w.Shutdown(ctx, ShutdownOptions{})
 
-	select {
-	case <-done:
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
-	}
+	return err
 }
 
 func ceilDiv(d, base time.Duration) int {
@@ -114,29 +136,38 @@ func ceilDiv(d, base time.Duration) int {
 func (w *Wheel) loop() {
 	defer w.wg.Done()
 
+	var preciseC <-chan time.Time
+	if w.precise != nil {
+		preciseC = w.precise.timer.C
+	}
+
+	var (
+		draining bool
+		until    time.Time
+	)
+
 	for {
+		if draining && w.drained(until) {
+			w.halt()
+			return
+		}
+
 		select {
+		case <-preciseC:
+			w.fire(w.precise.popDue(w.now()))
 		case <-w.ticker.C:
-			b := w.wheel[w.cur]
-			due, _ := b.drainDue()
-			for _, t := range due {
-				w.timers.Delete(t.id)
-				go func(t *timer) {
-					defer func() { _ = recover() }()
-					t.task()
-				}(t)
-			}
-			w.cur = (w.cur + 1) % w.slots
+			w.advance(w.now())
 		consume:
 			for {
 				select {
 				case a := <-w.addCh:
 					w.place(a)
 				case c := <-w.cancelCh:
-					ok := w.doCancel(c.id)
-					if c.result != nil {
-						c.result <- ok
-					}
+					w.handleCancel(c)
+				case b := <-w.addBatchCh:
+					w.placeBatch(b)
+				case c := <-w.cancelBatchCh:
+					w.handleCancelBatch(c)
 				default:
 					break consume
 				}
@@ -144,40 +175,138 @@ func (w *Wheel) loop() {
 		case a := <-w.addCh:
 			w.place(a)
 		case c := <-w.cancelCh:
-			ok := w.doCancel(c.id)
-			if c.result != nil {
-				c.result <- ok
-			}
+			w.handleCancel(c)
+		case b := <-w.addBatchCh:
+			w.placeBatch(b)
+		case c := <-w.cancelBatchCh:
+			w.handleCancelBatch(c)
+		case t := <-w.drainCh:
+			draining, until = true, t
 		case <-w.stopCh:
-			w.ticker.Stop()
+			w.halt()
 			return
 		}
 	}
 }
 
-func (w *Wheel) place(a addReq) {
-	now := time.Now().UTC()
-	delay := a.deadline.Sub(now)
+func (w *Wheel) halt() {
+	w.ticker.Stop()
+	if w.precise != nil {
+		w.precise.timer.Stop()
+	}
+}
 
-	ticksLater := max(ceilDiv(delay, w.tick), 0)
+// advance processes every slot whose tick is due at now. The ticker drops
+// ticks under load and after a suspend, so a single received tick may have
+// to catch up on several slots; they are drained in order.
+func (w *Wheel) advance(now time.Time) {
+	for !w.next.After(now) {
+		due, _ := w.wheel[w.cur].drainDue()
 
-	slot := (w.cur + (ticksLater % w.slots)) % w.slots
-	rounds := ticksLater / w.slots
+		if w.precise != nil {
+			due = w.handOff(due, now)
+		}
+
+		w.fire(due)
+
+		w.cur = (w.cur + 1) % w.slots
+		w.next = w.next.Add(w.tick)
+	}
+}
+
+// handOff moves timers whose deadline has not been reached yet into the
+// precise stage and returns the ones that are already due.
+func (w *Wheel) handOff(due []*timer, now time.Time) []*timer {
+	ready := due[:0]
+
+	for _, t := range due {
+		if t.deadline.After(now) {
+			w.precise.push(t, now)
+		} else {
+			ready = append(ready, t)
+		}
+	}
 
-	t := &timer{id: a.id, deadline: a.deadline, rounds: rounds, task: a.task}
+	return ready
+}
 
+func (w *Wheel) fire(due []*timer) {
+	for _, t := range due {
+		w.timers.Delete(t.id)
+		w.size.Add(-1)
+		w.tasks.Add(1)
+		go func(t *timer) {
+			defer w.tasks.Done()
+			defer func() { _ = recover() }()
+			t.task()
+		}(t)
+	}
+}
+
+func (w *Wheel) place(a addReq) {
+	// Slot cur fires at w.next, so offsets are measured from there rather
+	// than from now; otherwise a lagging wheel would push timers further out.
+	delay := a.deadline.Sub(w.next)
+
+	t := &timer{id: a.id, deadline: a.deadline, task: a.task, index: -1}
 	w.timers.Store(t.id, t)
+
+	var ticksLater int
+	if w.precise != nil {
+		// Land in the last slot at or before the deadline and let the
+		// precise stage cover the remaining sub-tick wait.
+		if delay < 0 {
+			w.precise.push(t, w.now())
+			return
+		}
+
+		ticksLater = int(delay / w.tick)
+	} else {
+		ticksLater = max(ceilDiv(delay, w.tick), 0)
+	}
+
+	slot := (w.cur + (ticksLater % w.slots)) % w.slots
+	t.rounds = ticksLater / w.slots
+
 	w.wheel[slot].add(t)
 }
 
+// handleCancel places every queued add before cancelling. A caller's At
+// happens before its Cancel, so the add is already in addCh; without this
+// the select could pick the cancel first and leave the timer armed.
+func (w *Wheel) handleCancel(c cancelReq) {
+	w.flushAdds()
+
+	ok := w.doCancel(c.id)
+	if c.result != nil {
+		c.result <- ok
+	}
+}
+
+func (w *Wheel) flushAdds() {
+	for {
+		select {
+		case a := <-w.addCh:
+			w.place(a)
+		case b := <-w.addBatchCh:
+			w.placeBatch(b)
+		default:
+			return
+		}
+	}
+}
+
 func (w *Wheel) doCancel(id uint64) bool {
 	if v, ok := w.timers.Load(id); ok {
 		t := v.(*timer)
 		if t.bucket != nil {
 			_ = t.bucket.removeByID(id)
+		} else if w.precise != nil {
+			w.precise.remove(t, w.now())
 		}
 
 		w.timers.Delete(id)
+		w.size.Add(-1)
 
 		return true
 	}
@@ -186,15 +315,16 @@ func (w *Wheel) doCancel(id uint64) bool {
 }
 
 func (w *Wheel) AfterFunc(d time.Duration, f Task) uint64 {
-	id := w.idGen.Add(1)
-	w.addCh <- addReq{id: id, deadline: time.Now().UTC().Add(d), task: f}
-
-	return id
+	return w.add(w.idGen.Add(1), time.Now().UTC().Add(d), f)
 }
 
 func (w *Wheel) At(deadline time.Time, f Task) uint64 {
-	id := w.idGen.Add(1)
-	w.addCh <- addReq{id: id, deadline: deadline.UTC(), task: f}
+	return w.add(w.idGen.Add(1), deadline.UTC(), f)
+}
+
+func (w *Wheel) add(id uint64, deadline time.Time, f Task) uint64 {
+	w.size.Add(1)
+	w.addCh <- addReq{id: id, deadline: deadline, task: f}
 
 	return id
 }
@@ -205,3 +335,8 @@ func (w *Wheel) Cancel(id uint64) bool {
 
 	return <-res
 }
+
+// Len returns the number of timers that are armed or waiting to be placed.
+func (w *Wheel) Len() int {
+	return int(w.size.Load())
+}
@@ -0,0 +1,109 @@
+package twheel
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a wall clock that only moves when told to.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.t
+}
+
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = t
+}
+
+// TestCatchUpAfterClockJump jumps the wheel's clock several rotations ahead,
+// as after a suspend, and hands it a single tick. That tick must fire every
+// timer due by then, slot by slot, and none that is due later.
+func TestCatchUpAfterClockJump(t *testing.T) {
+	const (
+		tick  = 10 * time.Millisecond
+		slots = 8
+		n     = 100
+		every = 7 * time.Millisecond // timer i is due at start + i*every
+	)
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+
+	// The loop is not started: the test places the timers and delivers the
+	// ticks itself, as loop would.
+	w := New(tick, slots)
+	w.now = clock.now
+	w.next = start.Add(tick)
+
+	var (
+		mu    sync.Mutex
+		fired = make(map[int]bool)
+		errs  []string
+	)
+
+	// slotOf is the tick, counted from start, at which timer i fires.
+	slotOf := func(i int) int { return ceilDiv(time.Duration(i)*every, tick) }
+
+	ids := make([]uint64, n+1)
+	for i := 1; i <= n; i++ {
+		ids[i] = w.idGen.Add(1)
+	}
+
+	for i := 1; i <= n; i++ {
+		w.size.Add(1)
+		w.place(addReq{id: ids[i], deadline: start.Add(time.Duration(i) * every), task: func() {
+			// Every timer of an earlier slot was handed out before this one.
+			for j := 1; j < i; j++ {
+				if _, ok := w.timers.Load(ids[j]); ok && slotOf(j) < slotOf(i) {
+					mu.Lock()
+					errs = append(errs, fmt.Sprintf("timer %d fired before timer %d", i, j))
+					mu.Unlock()
+				}
+			}
+
+			mu.Lock()
+			fired[i] = true
+			mu.Unlock()
+		}})
+	}
+
+	for _, jump := range []struct {
+		rotations int
+		fired     int
+	}{
+		{0, 0},
+		{3, 34},   // up to 240ms: timers 1..34
+		{10, 100}, // up to 800ms: all of them
+	} {
+		clock.set(start.Add(time.Duration(jump.rotations*slots) * tick))
+
+		w.advance(w.now())
+		w.tasks.Wait()
+
+		for i := 1; i <= n; i++ {
+			if want := i <= jump.fired; fired[i] != want {
+				t.Errorf("after %d rotations: timer %d fired = %v, want %v", jump.rotations, i, fired[i], want)
+			}
+		}
+
+		if got, want := w.Len(), n-jump.fired; got != want {
+			t.Errorf("after %d rotations: %d timers left, want %d", jump.rotations, got, want)
+		}
+	}
+
+	for _, e := range errs {
+		t.Error(e)
+	}
+}
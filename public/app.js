@@ -97,3 +97,31 @@ document.addEventListener('DOMContentLoaded', function(){
   fillDueBrowser();
   setInterval(tickDueIn, 30000);
 });
+
+function toggleAll(cb) {
+  document.querySelectorAll('input.bulk-id').forEach(el => { el.checked = cb.checked; });
+}
+
+function showBulkFields(sel) {
+  document.querySelectorAll('#bulk .bulk-reschedule').forEach(el => {
+    el.style.display = sel.value === 'reschedule' ? '' : 'none';
+  });
+  document.querySelectorAll('#bulk .bulk-retag').forEach(el => {
+    el.style.display = sel.value === 'retag' ? '' : 'none';
+  });
+}
+
+function confirmBulk(form) {
+  const action = form.elements['action'].value;
+  if (form.elements['scope'].value === 'filter') {
+    return confirm(`${action} every job matching the current filter?`);
+  }
+
+  const n = document.querySelectorAll('input.bulk-id:checked').length;
+  if (n === 0) {
+    alert('Select at least one job.');
+    return false;
+  }
+
+  return action !== 'delete' || confirm(`Delete ${n} job(s)? This cannot be undone.`);
+}